@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoAccessiblePath = errors.New("no accessible path between those stops")
+
+const (
+	wheelchairUnknown      = 0
+	wheelchairAccessible   = 1
+	wheelchairInaccessible = 2
+)
+
+// Accessibility is what we know about getting a wheelchair through each station: its elevators and
+// escalators, and which of them are out of service right now.
+type Accessibility struct {
+	// Facilities are keyed by the ID of the station they are in.
+	Facilities map[string][]Facility
+	// Outages are keyed by the ID of the facility that is out of service.
+	Outages map[string]Alert
+}
+
+func build_accessibility(facilities []Facility, alerts []Alert) Accessibility {
+	accessibility := Accessibility{Facilities: map[string][]Facility{}, Outages: map[string]Alert{}}
+	for _, facility := range facilities {
+		stopID := facility.Relationships.Stop.Data.ID
+		accessibility.Facilities[stopID] = append(accessibility.Facilities[stopID], facility)
+	}
+	for _, alert := range alerts {
+		for _, entity := range alert.Attribute.InformedEntity {
+			if entity.Facility != "" {
+				accessibility.Outages[entity.Facility] = alert
+			}
+		}
+	}
+	return accessibility
+}
+
+// fetch_accessibility costs two requests whatever the size of the network, one for every elevator and
+// escalator and one for every current outage.
+func fetch_accessibility(api MBTAWebServer) (Accessibility, error) {
+	facilities, err := api.GetFacilities()
+	if err != nil {
+		return Accessibility{}, err
+	}
+	alerts, err := api.GetAccessibilityAlerts()
+	if err != nil {
+		return Accessibility{}, err
+	}
+	return build_accessibility(facilities.Data, alerts.Data), nil
+}
+
+// stop_problem explains why a wheelchair can't get through a stop, or is empty if it can. A station with
+// one elevator out of several is still usable, so we only give up on it once every elevator is out.
+func (a Accessibility) stop_problem(stop Stop) string {
+	switch stop.Attribute.WheelchairBoarding {
+	case wheelchairInaccessible:
+		return "not wheelchair accessible"
+	case wheelchairUnknown:
+		return "no wheelchair accessibility information"
+	}
+
+	elevators, outages := 0, []Alert{}
+	for _, facility := range a.Facilities[stop.ID] {
+		if facility.Attribute.Type != "ELEVATOR" {
+			continue
+		}
+		elevators++
+		if alert, ok := a.Outages[facility.ID]; ok {
+			outages = append(outages, alert)
+		}
+	}
+	if elevators > 0 && len(outages) == elevators {
+		return fmt.Sprintf("every elevator is out of service (%s)", outages[0].Attribute.Header)
+	}
+	return ""
+}
+
+// blocked_stops is every stop a wheelchair can't board or leave a train at, with the reason why.
+func (a Accessibility) blocked_stops(network Network) map[Stop]string {
+	blocked := map[Stop]string{}
+	for _, stop := range network.Stops {
+		if problem := a.stop_problem(stop); problem != "" {
+			blocked[stop] = problem
+		}
+	}
+	return blocked
+}
+
+// with_accessibility fetches the accessibility data the planner needs when asked for accessible trips.
+func with_accessibility(api MBTAWebServer, options PlanOptions) (PlanOptions, error) {
+	if !options.Accessible {
+		return options, nil
+	}
+	accessibility, err := fetch_accessibility(api)
+	if err != nil {
+		return PlanOptions{}, err
+	}
+	options.Accessibility = accessibility
+	return options, nil
+}
+
+// rejection_reasons explains which of the stops an itinerary gets on or off at are blocked, in the order
+// the itinerary visits them.
+func rejection_reasons(itinerary Itinerary, blocked map[Stop]string) []string {
+	reasons := []string{}
+	seen := map[Stop]bool{}
+	visit := func(stop Stop) {
+		if problem, ok := blocked[stop]; ok && !seen[stop] {
+			seen[stop] = true
+			reasons = append(reasons, fmt.Sprintf("%s: %s", stop.Attribute.Name, problem))
+		}
+	}
+	for _, leg := range itinerary.Legs {
+		visit(leg.From)
+		visit(leg.To)
+	}
+	return reasons
+}
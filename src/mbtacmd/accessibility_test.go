@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// mock_accessibility_network goes from Alewife to Kenmore either through Park Street, or the long way
+// around through Haymarket on two other routes. Science Park isn't accessible.
+func mock_accessibility_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	orange := Route{ID: "Orange", Attribute: RouteAttribute{LongName: "Orange Line"}}
+	greenE := Route{ID: "Green-E", Attribute: RouteAttribute{LongName: "Green Line E"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife", WheelchairBoarding: wheelchairAccessible}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street", WheelchairBoarding: wheelchairAccessible}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore", WheelchairBoarding: wheelchairAccessible}}
+	haymarket := Stop{ID: "place-haecl", Attribute: StopAttribute{Name: "Haymarket", WheelchairBoarding: wheelchairAccessible}}
+	sciencePark := Stop{ID: "place-spmnl", Attribute: StopAttribute{Name: "Science Park", WheelchairBoarding: wheelchairInaccessible}}
+
+	return Network{
+		Routes: []Route{red, green, orange, greenE},
+		Stops:  []Stop{alewife, park, kenmore, haymarket, sciencePark},
+		RouteStops: map[Route][]Stop{
+			red:    []Stop{alewife, park},
+			green:  []Stop{park, kenmore},
+			orange: []Stop{alewife, haymarket},
+			greenE: []Stop{sciencePark, haymarket, kenmore},
+		},
+		StopRoutes: map[Stop][]Route{
+			alewife:     []Route{red, orange},
+			park:        []Route{red, green},
+			kenmore:     []Route{green, greenE},
+			haymarket:   []Route{orange, greenE},
+			sciencePark: []Route{greenE},
+		},
+	}
+}
+
+func mock_park_street_outage() Accessibility {
+	return build_accessibility(
+		[]Facility{
+			{ID: "804", Attribute: FacilityAttribute{Type: "ELEVATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-pktrm"}}}},
+			{ID: "805", Attribute: FacilityAttribute{Type: "ELEVATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-pktrm"}}}},
+			{ID: "806", Attribute: FacilityAttribute{Type: "ESCALATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-pktrm"}}}},
+		},
+		[]Alert{
+			{ID: "1", Attribute: AlertAttribute{Header: "Park Street elevator 804 unavailable", Effect: "ELEVATOR_CLOSURE", InformedEntity: []AlertEntity{{Stop: "place-pktrm", Facility: "804"}}}},
+			{ID: "2", Attribute: AlertAttribute{Header: "Park Street elevator 805 unavailable", Effect: "ELEVATOR_CLOSURE", InformedEntity: []AlertEntity{{Stop: "place-pktrm", Facility: "805"}}}},
+		},
+	)
+}
+
+func Test_stop_problem(t *testing.T) {
+	network := mock_accessibility_network()
+	park := network.Stops[1]
+
+	t.Run("happy path - accessible", func(t *testing.T) {
+		if problem := (Accessibility{}).stop_problem(park); problem != "" {
+			t.Errorf("expected no problem, got %q", problem)
+		}
+	})
+
+	t.Run("happy path - one elevator out of two", func(t *testing.T) {
+		accessibility := mock_park_street_outage()
+		delete(accessibility.Outages, "805")
+
+		if problem := accessibility.stop_problem(park); problem != "" {
+			t.Errorf("expected no problem, got %q", problem)
+		}
+	})
+
+	t.Run("sad path - every elevator out", func(t *testing.T) {
+		expected := "every elevator is out of service (Park Street elevator 804 unavailable)"
+
+		if problem := mock_park_street_outage().stop_problem(park); problem != expected {
+			t.Errorf("expected %q to be equal to %q", problem, expected)
+		}
+	})
+
+	t.Run("sad path - not accessible or unknown", func(t *testing.T) {
+		expected := []string{"not wheelchair accessible", "no wheelchair accessibility information"}
+
+		found := []string{
+			Accessibility{}.stop_problem(network.Stops[4]),
+			Accessibility{}.stop_problem(Stop{ID: "place-unknown"}),
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %s to be equal to %s", expected, found)
+		}
+	})
+}
+
+func Test_fetch_accessibility(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		expected := mock_park_street_outage()
+		facilities := []Facility{}
+		for _, stopFacilities := range expected.Facilities {
+			facilities = append(facilities, stopFacilities...)
+		}
+		mockAPI := &MockMBTAWebServer{
+			ReturnFacilityWrapper:           FacilityWrapper{Data: facilities},
+			ReturnAccessibilityAlertWrapper: AlertWrapper{Data: []Alert{expected.Outages["804"], expected.Outages["805"]}},
+		}
+
+		found, err := fetch_accessibility(mockAPI)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("sad path - alerts fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := &MockMBTAWebServer{ReturnAccessibilityAlertWrapperError: myErr}
+
+		_, err := with_accessibility(mockAPI, PlanOptions{Accessible: true})
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+}
+
+func Test_plan_accessible(t *testing.T) {
+	network := mock_accessibility_network()
+	alewife, kenmore, sciencePark := network.Stops[0], network.Stops[2], network.Stops[4]
+
+	t.Run("happy path - nothing in the way", func(t *testing.T) {
+		found, err := plan_itinerary(network, alewife, kenmore, PlanOptions{Accessible: true})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual([]Route{network.Routes[0], network.Routes[1]}, found.Routes()) || found.Rejected != nil {
+			t.Errorf("expected the route through Park Street with nothing rejected, got %+v", found)
+		}
+	})
+
+	t.Run("happy path - around an elevator outage", func(t *testing.T) {
+		found, err := plan_itinerary(network, alewife, kenmore, PlanOptions{Accessible: true, Accessibility: mock_park_street_outage()})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expectedRoutes := []Route{network.Routes[2], network.Routes[3]}
+		expectedRejected := []string{"Park Street: every elevator is out of service (Park Street elevator 804 unavailable)"}
+		if !reflect.DeepEqual(expectedRoutes, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expectedRoutes, found.Routes())
+		}
+		if !reflect.DeepEqual(expectedRejected, found.Rejected) {
+			t.Errorf("expected %s to be equal to %s", expectedRejected, found.Rejected)
+		}
+
+		expected := `Take the following routes to get from Alewife to Kenmore:
+Orange Line
+Green Line E
+This avoids a quicker trip through stations that are not accessible:
+  Park Street: every elevator is out of service (Park Street elevator 804 unavailable)
+`
+		out := &bytes.Buffer{}
+		print_itinerary(out, "Alewife", "Kenmore", found)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - riding through an inaccessible station", func(t *testing.T) {
+		accessibility := mock_park_street_outage()
+		network := mock_accessibility_network()
+		haymarket := network.Stops[3]
+		greenE := network.Routes[3]
+		// Put Science Park in the middle of the line rather than at the end.
+		network.RouteStops[greenE] = []Stop{haymarket, sciencePark, kenmore}
+
+		found, err := plan_itinerary(network, haymarket, kenmore, PlanOptions{Accessible: true, Accessibility: accessibility})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual([]Leg{{Route: greenE, From: haymarket, To: kenmore, Stops: 2}}, found.Legs) {
+			t.Errorf("expected to ride straight through Science Park, got %+v", found.Legs)
+		}
+	})
+
+	t.Run("sad path - inaccessible destination", func(t *testing.T) {
+		_, err := plan_itinerary(network, alewife, sciencePark, PlanOptions{Accessible: true})
+		if !errors.Is(err, ErrNoAccessiblePath) {
+			t.Errorf("expected error %s to be %s", err, ErrNoAccessiblePath)
+		}
+
+		expected := "no accessible path between those stops: Science Park: not wheelchair accessible"
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q to be %q", err, expected)
+		}
+	})
+}
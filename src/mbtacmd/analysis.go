@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownMode = errors.New("unknown mode, expected light, heavy, commuter, bus or ferry")
+
+// modeNames are the GTFS route types, in the order of their numbers.
+var modeNames = []string{"light", "heavy", "commuter", "bus", "ferry"}
+
+func mode_description(mode int) string {
+	switch mode {
+	case 0:
+		return "light rail"
+	case 1:
+		return "heavy rail"
+	case 2:
+		return "commuter rail"
+	case 3:
+		return "bus"
+	case 4:
+		return "ferry"
+	}
+	return fmt.Sprintf("route type %d", mode)
+}
+
+// parse_modes reads a comma separated list of modes like "light,heavy" as route types.
+func parse_modes(list string) ([]int, error) {
+	modes := []int{}
+	for _, name := range split_names(list) {
+		found := false
+		for mode, modeName := range modeNames {
+			if strings.TrimSpace(name) == modeName {
+				modes = append(modes, mode)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrUnknownMode
+		}
+	}
+	return modes, nil
+}
+
+// network_modes are the route types in the network, in the order its routes first use them.
+func network_modes(network Network) []int {
+	modes := []int{}
+	seen := map[int]bool{}
+	for _, route := range network.Routes {
+		if !seen[route.Attribute.Type] {
+			seen[route.Attribute.Type] = true
+			modes = append(modes, route.Attribute.Type)
+		}
+	}
+	return modes
+}
+
+// filter_network_modes keeps only the routes of the given types, along with the stops they serve.
+func filter_network_modes(network Network, modes []int) (Network, error) {
+	names := []string{}
+	for _, route := range network.Routes {
+		for _, mode := range modes {
+			if route.Attribute.Type == mode {
+				names = append(names, route.ID)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return Network{Routes: []Route{}, Stops: []Stop{}, RouteStops: map[Route][]Stop{}, StopRoutes: map[Stop][]Route{}}, nil
+	}
+	return filter_network_routes(network, names)
+}
+
+// stop_graph is the network as an undirected graph of stops, numbered in the order of network.Stops, with
+// an edge between stops that are next to each other on any branch of any route (see network_edges). Two routes running
+// between the same two stops are one edge, since closing either stop closes both.
+type stop_graph struct {
+	stops    []Stop
+	adjacent [][]int
+	routes   map[[2]int][]Route
+}
+
+func build_stop_graph(network Network) stop_graph {
+	graph := stop_graph{stops: network.Stops, adjacent: make([][]int, len(network.Stops)), routes: map[[2]int][]Route{}}
+	index := map[Stop]int{}
+	for i, stop := range network.Stops {
+		index[stop] = i
+	}
+
+	for _, edge := range network_edges(network) {
+		from, fromOK := index[edge.From]
+		to, toOK := index[edge.To]
+		if !fromOK || !toOK || from == to {
+			continue
+		}
+		key := [2]int{min(from, to), max(from, to)}
+		if _, ok := graph.routes[key]; !ok {
+			graph.adjacent[from] = append(graph.adjacent[from], to)
+			graph.adjacent[to] = append(graph.adjacent[to], from)
+		}
+		graph.routes[key] = append(graph.routes[key], edge.Route)
+	}
+	return graph
+}
+
+// cut_points finds the articulation points (stops whose closure splits the graph) and the bridges (links
+// whose closure does) in one depth-first search, with Tarjan's low-link values: a stop is a cut point when
+// nothing below one of its children in the search tree reaches back above it.
+func (g stop_graph) cut_points() ([]int, [][2]int) {
+	order := make([]int, len(g.stops))
+	low := make([]int, len(g.stops))
+	for i := range order {
+		order[i] = -1
+	}
+	isArticulation := make([]bool, len(g.stops))
+	bridges := [][2]int{}
+	counter := 0
+
+	var visit func(stop int, parent int)
+	visit = func(stop int, parent int) {
+		order[stop], low[stop] = counter, counter
+		counter++
+		children := 0
+		for _, next := range g.adjacent[stop] {
+			if next == parent {
+				continue
+			}
+			if order[next] >= 0 {
+				low[stop] = min(low[stop], order[next])
+				continue
+			}
+			children++
+			visit(next, stop)
+			low[stop] = min(low[stop], low[next])
+			if parent >= 0 && low[next] >= order[stop] {
+				isArticulation[stop] = true
+			}
+			if low[next] > order[stop] {
+				bridges = append(bridges, [2]int{min(stop, next), max(stop, next)})
+			}
+		}
+		if parent < 0 && children > 1 {
+			isArticulation[stop] = true
+		}
+	}
+	for stop := range g.stops {
+		if order[stop] < 0 {
+			visit(stop, -1)
+		}
+	}
+
+	articulation := []int{}
+	for stop, is := range isArticulation {
+		if is {
+			articulation = append(articulation, stop)
+		}
+	}
+	sort.Slice(bridges, func(i, j int) bool {
+		if bridges[i][0] != bridges[j][0] {
+			return bridges[i][0] < bridges[j][0]
+		}
+		return bridges[i][1] < bridges[j][1]
+	})
+	return articulation, bridges
+}
+
+// components are the groups of stops that can reach each other, biggest first.
+func (g stop_graph) components() [][]int {
+	seen := make([]bool, len(g.stops))
+	components := [][]int{}
+	for start := range g.stops {
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		component := []int{}
+		queue := []int{start}
+		for len(queue) > 0 {
+			stop := queue[0]
+			queue = queue[1:]
+			component = append(component, stop)
+			for _, next := range g.adjacent[stop] {
+				if !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		sort.Ints(component)
+		components = append(components, component)
+	}
+	sort.SliceStable(components, func(i, j int) bool { return len(components[i]) > len(components[j]) })
+	return components
+}
+
+// betweenness is how many of the shortest paths between every other pair of stops go through each stop,
+// counting a pair with several shortest paths fractionally, by Brandes' algorithm.
+func (g stop_graph) betweenness() []float64 {
+	centrality := make([]float64, len(g.stops))
+	for source := range g.stops {
+		stack := []int{}
+		predecessors := make([][]int, len(g.stops))
+		paths := make([]float64, len(g.stops))
+		distance := make([]int, len(g.stops))
+		for i := range distance {
+			distance[i] = -1
+		}
+		paths[source], distance[source] = 1, 0
+
+		queue := []int{source}
+		for len(queue) > 0 {
+			stop := queue[0]
+			queue = queue[1:]
+			stack = append(stack, stop)
+			for _, next := range g.adjacent[stop] {
+				if distance[next] < 0 {
+					distance[next] = distance[stop] + 1
+					queue = append(queue, next)
+				}
+				if distance[next] == distance[stop]+1 {
+					paths[next] += paths[stop]
+					predecessors[next] = append(predecessors[next], stop)
+				}
+			}
+		}
+
+		dependency := make([]float64, len(g.stops))
+		for i := len(stack) - 1; i >= 0; i-- {
+			stop := stack[i]
+			for _, previous := range predecessors[stop] {
+				dependency[previous] += paths[previous] / paths[stop] * (1 + dependency[stop])
+			}
+			if stop != source {
+				centrality[stop] += dependency[stop]
+			}
+		}
+	}
+	// Every pair was counted once from each end.
+	for i := range centrality {
+		centrality[i] /= 2
+	}
+	return centrality
+}
+
+type ModeComponents struct {
+	Modes      []int
+	Components [][]Stop
+}
+
+type StopCentrality struct {
+	Stop Stop
+	// Betweenness is the share of the shortest paths between other pairs of stops that pass through
+	// this one, from 0 to 1.
+	Betweenness float64
+}
+
+type NetworkAnalysis struct {
+	Modes              []int
+	Stops              int
+	Connections        int
+	ArticulationPoints []Stop
+	Bridges            []GraphEdge
+	// BridgeRoutes are every route running along each bridge, in the same order as Bridges.
+	BridgeRoutes [][]Route
+	// Components are for all of Modes together, and then for each on its own when there are several.
+	Components []ModeComponents
+	// Centrality is every stop, most central first.
+	Centrality []StopCentrality
+}
+
+// analyze_network looks for the weak points of the routes of the given types (every type in the
+// network when there are none): the stations and links that would split it if closed, how it falls
+// apart by mode, and which stations the most trips go through.
+func analyze_network(network Network, modes []int) (NetworkAnalysis, error) {
+	if len(modes) == 0 {
+		modes = network_modes(network)
+	}
+	selected, err := filter_network_modes(network, modes)
+	if err != nil {
+		return NetworkAnalysis{}, err
+	}
+	graph := build_stop_graph(selected)
+
+	analysis := NetworkAnalysis{
+		Modes:              modes,
+		Stops:              len(graph.stops),
+		Connections:        len(graph.routes),
+		ArticulationPoints: []Stop{},
+		Bridges:            []GraphEdge{},
+		BridgeRoutes:       [][]Route{},
+		Components:         []ModeComponents{},
+		Centrality:         []StopCentrality{},
+	}
+
+	articulation, bridges := graph.cut_points()
+	for _, stop := range articulation {
+		analysis.ArticulationPoints = append(analysis.ArticulationPoints, graph.stops[stop])
+	}
+	for _, bridge := range bridges {
+		routes := graph.routes[bridge]
+		analysis.Bridges = append(analysis.Bridges, GraphEdge{From: graph.stops[bridge[0]], To: graph.stops[bridge[1]], Route: routes[0]})
+		analysis.BridgeRoutes = append(analysis.BridgeRoutes, routes)
+	}
+
+	selections := [][]int{modes}
+	if len(modes) > 1 {
+		for _, mode := range modes {
+			selections = append(selections, []int{mode})
+		}
+	}
+	for _, selection := range selections {
+		modeNetwork, err := filter_network_modes(selected, selection)
+		if err != nil {
+			return NetworkAnalysis{}, err
+		}
+		modeGraph := build_stop_graph(modeNetwork)
+		components := ModeComponents{Modes: selection, Components: [][]Stop{}}
+		for _, component := range modeGraph.components() {
+			stops := []Stop{}
+			for _, stop := range component {
+				stops = append(stops, modeGraph.stops[stop])
+			}
+			components.Components = append(components.Components, stops)
+		}
+		analysis.Components = append(analysis.Components, components)
+	}
+
+	pairs := float64(len(graph.stops)-1) * float64(len(graph.stops)-2) / 2
+	for stop, betweenness := range graph.betweenness() {
+		if pairs > 0 {
+			betweenness /= pairs
+		}
+		analysis.Centrality = append(analysis.Centrality, StopCentrality{Stop: graph.stops[stop], Betweenness: betweenness})
+	}
+	sort.SliceStable(analysis.Centrality, func(i, j int) bool {
+		return analysis.Centrality[i].Betweenness > analysis.Centrality[j].Betweenness
+	})
+
+	return analysis, nil
+}
+
+func modes_description(modes []int) string {
+	descriptions := []string{}
+	for _, mode := range modes {
+		descriptions = append(descriptions, mode_description(mode))
+	}
+	return strings.Join(descriptions, " and ")
+}
+
+// print_analysis prints the analysis, with only the top most central stations.
+func print_analysis(out io.Writer, analysis NetworkAnalysis, top int) {
+	fmt.Fprintf(out, "The %s network has %d stations and %d connections between them.\n", modes_description(analysis.Modes), analysis.Stops, analysis.Connections)
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Connected components:")
+	for _, mode := range analysis.Components {
+		sizes := []string{}
+		for _, component := range mode.Components {
+			sizes = append(sizes, fmt.Sprintf("%d", len(component)))
+		}
+		fmt.Fprintf(out, "  %s: %d (%s stations)\n", modes_description(mode.Modes), len(mode.Components), strings.Join(sizes, ", "))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Stations that would split the network if closed: %d\n", len(analysis.ArticulationPoints))
+	for _, stop := range analysis.ArticulationPoints {
+		fmt.Fprintf(out, "  %s\n", stop.Attribute.Name)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Connections that would split the network if closed: %d\n", len(analysis.Bridges))
+	for i, bridge := range analysis.Bridges {
+		fmt.Fprintf(out, "  %s - %s (%s)\n", bridge.From.Attribute.Name, bridge.To.Attribute.Name, build_route_list_name(analysis.BridgeRoutes[i]))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Most central stations (share of shortest paths through them):")
+	for i, stop := range analysis.Centrality {
+		if i >= top {
+			break
+		}
+		fmt.Fprintf(out, "  %s: %.1f%%\n", stop.Stop.Attribute.Name, stop.Betweenness*100)
+	}
+}
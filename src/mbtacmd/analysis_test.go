@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// mock_analysis_network is a heavy rail line from A through B to C, and a light rail loop from C through
+// D and E back to C, so only the line can be cut.
+func mock_analysis_network() Network {
+	line := Route{ID: "Line", Attribute: RouteAttribute{LongName: "Line", Type: int(RouteRailTypeHeavyRail)}}
+	loop := Route{ID: "Loop", Attribute: RouteAttribute{LongName: "Loop", Type: int(RouteRailTypeLightRail)}}
+	a := Stop{ID: "a", Attribute: StopAttribute{Name: "A"}}
+	b := Stop{ID: "b", Attribute: StopAttribute{Name: "B"}}
+	c := Stop{ID: "c", Attribute: StopAttribute{Name: "C"}}
+	d := Stop{ID: "d", Attribute: StopAttribute{Name: "D"}}
+	e := Stop{ID: "e", Attribute: StopAttribute{Name: "E"}}
+
+	return Network{
+		Routes: []Route{line, loop},
+		Stops:  []Stop{a, b, c, d, e},
+		RouteStops: map[Route][]Stop{
+			line: []Stop{a, b, c},
+			loop: []Stop{c, d, e, c},
+		},
+		StopRoutes: map[Stop][]Route{
+			a: []Route{line},
+			b: []Route{line},
+			c: []Route{line, loop},
+			d: []Route{loop},
+			e: []Route{loop},
+		},
+	}
+}
+
+func Test_analyze_network(t *testing.T) {
+	network := mock_analysis_network()
+	line := network.Routes[0]
+	a, b, c, d, e := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3], network.Stops[4]
+
+	t.Run("happy path - cut points", func(t *testing.T) {
+		analysis, err := analyze_network(network, nil)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expectedPoints := []Stop{b, c}
+		if !reflect.DeepEqual(expectedPoints, analysis.ArticulationPoints) {
+			t.Errorf("expected %+v to be equal to %+v", expectedPoints, analysis.ArticulationPoints)
+		}
+		expectedBridges := []GraphEdge{{From: a, To: b, Route: line}, {From: b, To: c, Route: line}}
+		if !reflect.DeepEqual(expectedBridges, analysis.Bridges) {
+			t.Errorf("expected %+v to be equal to %+v", expectedBridges, analysis.Bridges)
+		}
+	})
+
+	t.Run("happy path - cut points along branches", func(t *testing.T) {
+		// Each branch is a dead end from JFK/UMass, and no train runs between Ashmont and North Quincy for
+		// a closure to cut.
+		network := mock_branching_network()
+		red := network.Routes[0]
+		alewife, jfk, savin, ashmont, quincy, braintree := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3], network.Stops[4], network.Stops[5]
+
+		analysis, err := analyze_network(network, nil)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expectedPoints := []Stop{jfk, savin, quincy}
+		if !reflect.DeepEqual(expectedPoints, analysis.ArticulationPoints) {
+			t.Errorf("expected %+v to be equal to %+v", expectedPoints, analysis.ArticulationPoints)
+		}
+		expectedBridges := []GraphEdge{
+			{From: alewife, To: jfk, Route: red},
+			{From: jfk, To: savin, Route: red},
+			{From: jfk, To: quincy, Route: red},
+			{From: savin, To: ashmont, Route: red},
+			{From: quincy, To: braintree, Route: red},
+		}
+		if !reflect.DeepEqual(expectedBridges, analysis.Bridges) {
+			t.Errorf("expected %+v to be equal to %+v", expectedBridges, analysis.Bridges)
+		}
+	})
+
+	t.Run("happy path - components per mode", func(t *testing.T) {
+		expected := []ModeComponents{
+			{Modes: []int{1, 0}, Components: [][]Stop{{a, b, c, d, e}}},
+			{Modes: []int{1}, Components: [][]Stop{{a, b, c}}},
+			{Modes: []int{0}, Components: [][]Stop{{c, d, e}}},
+		}
+
+		analysis, err := analyze_network(network, nil)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, analysis.Components) {
+			t.Errorf("expected %+v to be equal to %+v", expected, analysis.Components)
+		}
+	})
+
+	t.Run("happy path - betweenness", func(t *testing.T) {
+		// C is on the paths from A and B to D and E, B on those from A to C, D and E, out of six pairs each.
+		expected := map[string]float64{"C": 4.0 / 6, "B": 3.0 / 6, "A": 0, "D": 0, "E": 0}
+
+		analysis, err := analyze_network(network, nil)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if analysis.Centrality[0].Stop != c || analysis.Centrality[1].Stop != b {
+			t.Errorf("expected C and then B to be the most central, got %+v", analysis.Centrality)
+		}
+		for _, stop := range analysis.Centrality {
+			if math.Abs(stop.Betweenness-expected[stop.Stop.Attribute.Name]) > 1e-9 {
+				t.Errorf("expected %s to have betweenness %v, got %v", stop.Stop.Attribute.Name, expected[stop.Stop.Attribute.Name], stop.Betweenness)
+			}
+		}
+	})
+
+	t.Run("happy path - one mode", func(t *testing.T) {
+		analysis, err := analyze_network(network, []int{int(RouteRailTypeLightRail)})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if analysis.Stops != 3 || analysis.Connections != 3 || len(analysis.ArticulationPoints) != 0 || len(analysis.Components) != 1 {
+			t.Errorf("expected only the loop with no cut points, got %+v", analysis)
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		analysis, err := analyze_network(network, nil)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `The heavy rail and light rail network has 5 stations and 5 connections between them.
+
+Connected components:
+  heavy rail and light rail: 1 (5 stations)
+  heavy rail: 1 (3 stations)
+  light rail: 1 (3 stations)
+
+Stations that would split the network if closed: 2
+  B
+  C
+
+Connections that would split the network if closed: 2
+  A - B (Line)
+  B - C (Line)
+
+Most central stations (share of shortest paths through them):
+  C: 66.7%
+  B: 50.0%
+`
+		out := &bytes.Buffer{}
+		print_analysis(out, analysis, 2)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+}
+
+func Test_parse_modes(t *testing.T) {
+	t.Run("happy path - light and heavy", func(t *testing.T) {
+		expected := []int{0, 1}
+
+		found, err := parse_modes("light, heavy")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("sad path - unknown mode", func(t *testing.T) {
+		_, err := parse_modes("monorail")
+		if err != ErrUnknownMode {
+			t.Errorf("expected error %s to be %s", err, ErrUnknownMode)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DepartureBoard is everything shown on one frame of the platform-style departure board.
+// A failed refresh keeps the last good departures on screen and records the error in RefreshErr,
+// since one rate-limited request shouldn't blank the whole board.
+type DepartureBoard struct {
+	Stop       Stop
+	Groups     []DepartureGroup
+	Alerts     []string
+	UpdatedAt  time.Time
+	RefreshErr error
+}
+
+const (
+	boardDeparturesPerRow = 4
+	boardTickerSeparator  = "   *   "
+)
+
+func build_departure_board(api MBTAWebServer, network Network, stop Stop, now time.Time) (DepartureBoard, error) {
+	predictions, err := api.GetPredictions(stop)
+	if err != nil {
+		return DepartureBoard{}, err
+	}
+
+	alerts, err := api.GetAlerts(stop)
+	if err != nil {
+		return DepartureBoard{}, err
+	}
+
+	board := DepartureBoard{
+		Stop:      stop,
+		Groups:    group_departures(network, predictions.Data, now, boardDeparturesPerRow),
+		Alerts:    []string{},
+		UpdatedAt: now,
+	}
+	for _, alert := range alerts.Data {
+		board.Alerts = append(board.Alerts, alert.Attribute.Header)
+	}
+
+	return board, nil
+}
+
+// render_departure_board lays the board out as exactly height lines of at most width characters.
+// A height of zero means to use as many lines as the board needs, which is what -once output uses.
+// The alert ticker is scrolled along by one character for every tick.
+func render_departure_board(board DepartureBoard, now time.Time, width int, height int, tick int) []string {
+	rows := []string{}
+	for _, group := range board.Groups {
+		rows = append(rows, pad_between(group.Label, strings.Join(group.Times, "  "), width))
+	}
+	if len(rows) == 0 {
+		rows = append(rows, fit_to_width("No upcoming departures", width))
+	}
+
+	ticker := "No alerts"
+	if len(board.Alerts) > 0 {
+		ticker = ticker_window(strings.Join(board.Alerts, boardTickerSeparator)+boardTickerSeparator, width-2, tick)
+		ticker = "! " + ticker
+	}
+
+	footer := fmt.Sprintf("q quit  r refresh  updated %s", board.UpdatedAt.Format("15:04:05"))
+	if board.RefreshErr != nil {
+		footer = fmt.Sprintf("refresh failed: %s", board.RefreshErr)
+	}
+
+	header := pad_between(" "+strings.ToUpper(board.Stop.Attribute.Name), now.Format("15:04:05")+" ", width)
+	separator := strings.Repeat("-", width)
+
+	if height > 0 {
+		// The header, two separators, ticker and footer take five lines, and the departures get the rest.
+		available := height - 5
+		if available < 0 {
+			available = 0
+		}
+		if len(rows) > available {
+			rows = rows[:available]
+		}
+		for len(rows) < available {
+			rows = append(rows, "")
+		}
+	}
+
+	lines := []string{header, separator}
+	lines = append(lines, rows...)
+	lines = append(lines, separator, fit_to_width(ticker, width), fit_to_width(footer, width))
+	return lines
+}
+
+func pad_between(left string, right string, width int) string {
+	leftRunes := []rune(left)
+	rightRunes := []rune(right)
+	if len(leftRunes)+len(rightRunes)+1 > width {
+		keep := width - len(rightRunes) - 1
+		if keep < 0 {
+			return fit_to_width(right, width)
+		}
+		leftRunes = leftRunes[:keep]
+	}
+	return string(leftRunes) + strings.Repeat(" ", width-len(leftRunes)-len(rightRunes)) + string(rightRunes)
+}
+
+func fit_to_width(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text
+}
+
+func ticker_window(text string, width int, offset int) string {
+	runes := []rune(text)
+	if len(runes) == 0 || width <= 0 {
+		return ""
+	}
+	window := make([]rune, width)
+	for i := range window {
+		window[i] = runes[(offset+i)%len(runes)]
+	}
+	return string(window)
+}
+
+func run_departure_board(api MBTAWebServer, stopName string, refresh time.Duration, once bool, in *os.File, out *os.File) error {
+	network, err := build_route_network(api)
+	if err != nil {
+		return err
+	}
+	stop, ok := network.find_stop_by_name(stopName)
+	if !ok {
+		return ErrNoStop
+	}
+
+	board, err := build_departure_board(api, network, stop, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if once {
+		for _, line := range render_departure_board(board, time.Now(), 80, 0, 0) {
+			fmt.Fprintln(out, strings.TrimRight(line, " "))
+		}
+		return nil
+	}
+
+	restore, err := make_raw(in.Fd())
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// Switch to the alternate screen and hide the cursor, putting both back however we leave.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan byte)
+	go read_keys(in, keys)
+
+	scroll := time.NewTicker(300 * time.Millisecond)
+	defer scroll.Stop()
+	reload := time.NewTicker(refresh)
+	defer reload.Stop()
+
+	tick := 0
+	for {
+		draw_departure_board(out, board, tick)
+
+		select {
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 'Q' || key == 3 {
+				return nil
+			}
+			if key == 'r' || key == 'R' {
+				board = refresh_departure_board(api, network, board)
+			}
+		case <-scroll.C:
+			tick++
+		case <-reload.C:
+			board = refresh_departure_board(api, network, board)
+		}
+	}
+}
+
+func refresh_departure_board(api MBTAWebServer, network Network, board DepartureBoard) DepartureBoard {
+	refreshed, err := build_departure_board(api, network, board.Stop, time.Now())
+	if err != nil {
+		board.RefreshErr = err
+		return board
+	}
+	return refreshed
+}
+
+func draw_departure_board(out *os.File, board DepartureBoard, tick int) {
+	width, height, err := terminal_size(out.Fd())
+	if err != nil || width == 0 || height == 0 {
+		width, height = 80, 24
+	}
+	lines := render_departure_board(board, time.Now(), width, height, tick)
+	lines[0] = "\x1b[7m" + lines[0] + "\x1b[0m"
+	fmt.Fprintf(out, "\x1b[H%s\x1b[J", strings.Join(lines, "\x1b[K\r\n"))
+}
+
+func read_keys(in io.Reader, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			close(keys)
+			return
+		}
+		keys <- buf[0]
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_build_departure_board(t *testing.T) {
+	network := mock_repl_network()
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("happy path", func(t *testing.T) {
+		mockAPI := &MockMBTAWebServer{
+			ReturnPredictionWrapper: map[string]PredictionWrapper{
+				"place-pktrm": PredictionWrapper{
+					Data: []Prediction{
+						{
+							Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:02:00Z"},
+							Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Green-B"}}},
+						},
+					},
+				},
+			},
+			ReturnAlertWrapper: map[string]AlertWrapper{
+				"place-pktrm": AlertWrapper{
+					Data: []Alert{{Attribute: AlertAttribute{Header: "Elevator closed"}}},
+				},
+			},
+		}
+
+		expected := DepartureBoard{
+			Stop:      park,
+			Groups:    []DepartureGroup{{Label: "Green Line B (direction 0)", Times: []string{"2 min"}}},
+			Alerts:    []string{"Elevator closed"},
+			UpdatedAt: now,
+		}
+
+		board, err := build_departure_board(mockAPI, network, park, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, board) {
+			t.Errorf("expected %+v to be equal to %+v", expected, board)
+		}
+	})
+
+	t.Run("sad path - predictions fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := &MockMBTAWebServer{ReturnPredictionWrapperError: myErr}
+
+		_, err := build_departure_board(mockAPI, network, park, now)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+
+	t.Run("sad path - alerts fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := &MockMBTAWebServer{ReturnAlertWrapperError: myErr}
+
+		_, err := build_departure_board(mockAPI, network, park, now)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+}
+
+func Test_refresh_departure_board(t *testing.T) {
+	myErr := errors.New("custom mock error")
+	board := DepartureBoard{
+		Stop:   Stop{ID: "place-pktrm"},
+		Groups: []DepartureGroup{{Label: "Red Line (direction 0)", Times: []string{"1 min"}}},
+	}
+
+	refreshed := refresh_departure_board(&MockMBTAWebServer{ReturnPredictionWrapperError: myErr}, mock_repl_network(), board)
+	if refreshed.RefreshErr != myErr {
+		t.Errorf("expected error %s to be %s", refreshed.RefreshErr, myErr)
+	}
+	if !reflect.DeepEqual(board.Groups, refreshed.Groups) {
+		t.Errorf("expected the last good departures %+v to be kept, got %+v", board.Groups, refreshed.Groups)
+	}
+}
+
+func Test_render_departure_board(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	board := DepartureBoard{
+		Stop: Stop{Attribute: StopAttribute{Name: "Park Street"}},
+		Groups: []DepartureGroup{
+			{Label: "Red Line (direction 0)", Times: []string{"now", "5 min"}},
+			{Label: "Green Line B (direction 1)", Times: []string{"3 min"}},
+		},
+		Alerts:    []string{"Delays"},
+		UpdatedAt: now,
+	}
+
+	t.Run("happy path - fixed height", func(t *testing.T) {
+		expected := []string{
+			" PARK STREET         12:00:00 ",
+			"------------------------------",
+			"Red Line (direction now  5 min",
+			"Green Line B (direction  3 min",
+			"",
+			"------------------------------",
+			"! elays   *   Delays   *   Del",
+			"q quit  r refresh  updated 12:",
+		}
+
+		lines := render_departure_board(board, now, 30, 8, 1)
+		if !reflect.DeepEqual(expected, lines) {
+			t.Errorf("expected %q to be equal to %q", expected, lines)
+		}
+	})
+
+	t.Run("happy path - no departures or alerts and a failed refresh", func(t *testing.T) {
+		empty := DepartureBoard{
+			Stop:       Stop{Attribute: StopAttribute{Name: "Kenmore"}},
+			UpdatedAt:  now,
+			RefreshErr: ErrWebFailure,
+		}
+
+		lines := render_departure_board(empty, now, 40, 0, 0)
+		if len(lines) != 6 {
+			t.Fatalf("expected 6 lines, got %q", lines)
+		}
+		if lines[2] != "No upcoming departures" || lines[4] != "No alerts" {
+			t.Errorf("expected placeholders, got %q", lines)
+		}
+		if lines[5] != fit_to_width("refresh failed: "+ErrWebFailure.Error(), 40) {
+			t.Errorf("expected the refresh error, got %q", lines[5])
+		}
+	})
+}
+
+func Test_ticker_window(t *testing.T) {
+	result := ticker_window("abc", 5, 2)
+	if result != "cabca" {
+		t.Errorf("expected %q to be equal to %q", result, "cabca")
+	}
+
+	if ticker_window("", 5, 2) != "" {
+		t.Error("expected an empty ticker for empty text")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FakeAPI is a stand-in for the parts of the MBTA V3 API we use, answering from a Snapshot. It filters,
+// pages and rate-limits the way the real API does, and can fail every so often, so that
+// ConcreteMBTAWebServer can be run against it in tests and developers can work without the real thing.
+type FakeAPI struct {
+	Snapshot Snapshot
+	// RateLimit is how many requests are allowed every RateLimitWindow before the rest get a 429, or 0 for
+	// no limit. The real API allows 20 a minute without a key and 1000 a minute with one.
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// FailEvery fails every nth request with FailStatus, or none when 0.
+	FailEvery  int
+	FailStatus int
+
+	now func() time.Time
+
+	mu             sync.Mutex
+	requests       int
+	windowStart    time.Time
+	windowRequests int
+}
+
+func new_fake_api(snapshot Snapshot) *FakeAPI {
+	return &FakeAPI{Snapshot: snapshot, RateLimitWindow: time.Minute, FailStatus: http.StatusServiceUnavailable, now: time.Now}
+}
+
+// APIPage is the JSON:API document every endpoint answers with.
+type APIPage struct {
+	Data     []interface{}     `json:"data"`
+	Included []interface{}     `json:"included,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+	JSONAPI  map[string]string `json:"jsonapi"`
+}
+
+type APIError struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+type APIErrors struct {
+	Errors []APIError `json:"errors"`
+}
+
+func (f *FakeAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes", f.handle_routes)
+	mux.HandleFunc("/stops", f.handle_stops)
+	mux.HandleFunc("/predictions", f.handle_predictions)
+	mux.HandleFunc("/alerts", f.handle_alerts)
+	mux.HandleFunc("/shapes", f.handle_shapes)
+	mux.HandleFunc("/facilities", f.handle_facilities)
+	mux.HandleFunc("/schedules", f.handle_schedules)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		write_api_error(w, http.StatusNotFound, "not_found", "Resource not found")
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := f.admit(w.Header()); !ok {
+			if status == http.StatusTooManyRequests {
+				write_api_error(w, status, "rate_limited", "You have exceeded your allowed usage rate.")
+			} else {
+				write_api_error(w, status, "injected_failure", "Failed on purpose (-fail-every).")
+			}
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// admit counts the request against the rate limit and sets the rate-limit headers, and says whether the
+// request should be answered, or failed with the status it returns.
+func (f *FakeAPI) admit(header http.Header) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.RateLimit > 0 {
+		now := f.now()
+		if f.windowStart.IsZero() || now.Sub(f.windowStart) >= f.RateLimitWindow {
+			f.windowStart, f.windowRequests = now, 0
+		}
+		f.windowRequests++
+		header.Set("x-ratelimit-limit", strconv.Itoa(f.RateLimit))
+		header.Set("x-ratelimit-remaining", strconv.Itoa(max(f.RateLimit-f.windowRequests, 0)))
+		header.Set("x-ratelimit-reset", strconv.FormatInt(f.windowStart.Add(f.RateLimitWindow).Unix(), 10))
+		if f.windowRequests > f.RateLimit {
+			return http.StatusTooManyRequests, false
+		}
+	}
+	if f.FailEvery > 0 && f.requests%f.FailEvery == 0 {
+		return f.FailStatus, false
+	}
+	return http.StatusOK, true
+}
+
+func write_api_error(w http.ResponseWriter, status int, code string, detail string) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIErrors{Errors: []APIError{{Status: strconv.Itoa(status), Code: code, Detail: detail}}})
+}
+
+// filter_values are the comma separated values of filter[name], or nil when the request doesn't filter on it.
+func filter_values(r *http.Request, name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(r.URL.Query().Get("filter["+name+"]"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+func contains_value(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// write_api_page writes the page of data that page[offset] and page[limit] ask for (all of it when there is
+// no limit), with the links to the other pages as the real API gives them.
+func write_api_page(w http.ResponseWriter, r *http.Request, data []interface{}, included []interface{}) {
+	query := r.URL.Query()
+	offset, limit := 0, 0
+	var err error
+	if value := query.Get("page[offset]"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			write_api_error(w, http.StatusBadRequest, "bad_request", "Invalid page[offset]")
+			return
+		}
+	}
+	if value := query.Get("page[limit]"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			write_api_error(w, http.StatusBadRequest, "bad_request", "Invalid page[limit]")
+			return
+		}
+	}
+
+	page := APIPage{Data: []interface{}{}, Included: included, JSONAPI: map[string]string{"version": "1.0"}}
+	end := len(data)
+	if limit > 0 {
+		end = min(offset+limit, len(data))
+		link := func(at int) string {
+			linkQuery := r.URL.Query()
+			linkQuery.Set("page[offset]", strconv.Itoa(at))
+			return r.URL.Path + "?" + linkQuery.Encode()
+		}
+		page.Links = map[string]string{"self": r.URL.RequestURI(), "first": link(0), "last": link(max(len(data)-1, 0) / limit * limit)}
+		if end < len(data) {
+			page.Links["next"] = link(end)
+		}
+		if offset > 0 {
+			page.Links["prev"] = link(max(offset-limit, 0))
+		}
+	}
+	if offset < end {
+		page.Data = data[offset:end]
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (f *FakeAPI) handle_routes(w http.ResponseWriter, r *http.Request) {
+	types, ids := filter_values(r, "type"), filter_values(r, "id")
+	data := []interface{}{}
+	for _, route := range f.Snapshot.Routes {
+		if types != nil && !contains_value(types, strconv.Itoa(route.Attribute.Type)) {
+			continue
+		}
+		if ids != nil && !contains_value(ids, route.ID) {
+			continue
+		}
+		data = append(data, route)
+	}
+	write_api_page(w, r, data, nil)
+}
+
+// handle_stops lists the stops of the routes asked for, in route order, or every stop when there's no
+// route filter.
+func (f *FakeAPI) handle_stops(w http.ResponseWriter, r *http.Request) {
+	routes, ids := filter_values(r, "route"), filter_values(r, "id")
+	if routes == nil {
+		for _, route := range f.Snapshot.Routes {
+			routes = append(routes, route.ID)
+		}
+	}
+	data := []interface{}{}
+	seen := map[string]bool{}
+	for _, route := range routes {
+		for _, stop := range f.Snapshot.RouteStops[route] {
+			if seen[stop.ID] || (ids != nil && !contains_value(ids, stop.ID)) {
+				continue
+			}
+			seen[stop.ID] = true
+			data = append(data, stop)
+		}
+	}
+	write_api_page(w, r, data, nil)
+}
+
+func prediction_time(prediction Prediction) time.Time {
+	at, err := time.Parse(time.RFC3339, prediction.Attribute.DepartureTime)
+	if err != nil {
+		at, _ = time.Parse(time.RFC3339, prediction.Attribute.ArrivalTime)
+	}
+	return at
+}
+
+func (f *FakeAPI) handle_predictions(w http.ResponseWriter, r *http.Request) {
+	stops, routes := filter_values(r, "stop"), filter_values(r, "route")
+	if stops == nil && routes == nil {
+		write_api_error(w, http.StatusBadRequest, "bad_request", "At least one filter[] is required.")
+		return
+	}
+	if stops == nil {
+		for stop := range f.Snapshot.Predictions {
+			stops = append(stops, stop)
+		}
+		sort.Strings(stops)
+	}
+
+	predictions := []Prediction{}
+	for _, stop := range stops {
+		for _, prediction := range f.Snapshot.Predictions[stop] {
+			if routes == nil || contains_value(routes, prediction.Relationships.Route.Data.ID) {
+				predictions = append(predictions, prediction)
+			}
+		}
+	}
+	switch sortBy := r.URL.Query().Get("sort"); strings.TrimPrefix(sortBy, "-") {
+	case "":
+	case "departure_time", "arrival_time":
+		descending := strings.HasPrefix(sortBy, "-")
+		sort.SliceStable(predictions, func(i, j int) bool {
+			if descending {
+				return prediction_time(predictions[j]).Before(prediction_time(predictions[i]))
+			}
+			return prediction_time(predictions[i]).Before(prediction_time(predictions[j]))
+		})
+	default:
+		write_api_error(w, http.StatusBadRequest, "bad_request", "Invalid sort key.")
+		return
+	}
+
+	data := []interface{}{}
+	for _, prediction := range predictions {
+		data = append(data, prediction)
+	}
+	write_api_page(w, r, data, nil)
+}
+
+// handle_alerts has every alert in the snapshot: the ones recorded for each stop, and the accessibility
+// alerts. filter[datetime] is accepted and ignored, since the snapshot only has the alerts current when it
+// was taken.
+func (f *FakeAPI) handle_alerts(w http.ResponseWriter, r *http.Request) {
+	stops, effects := filter_values(r, "stop"), filter_values(r, "effect")
+	alerts := []Alert{}
+	if stops == nil {
+		for stop := range f.Snapshot.Alerts {
+			stops = append(stops, stop)
+		}
+		sort.Strings(stops)
+		alerts = append(alerts, f.Snapshot.AccessibilityAlerts...)
+	} else {
+		for _, alert := range f.Snapshot.AccessibilityAlerts {
+			for _, entity := range alert.Attribute.InformedEntity {
+				if contains_value(stops, entity.Stop) {
+					alerts = append(alerts, alert)
+					break
+				}
+			}
+		}
+	}
+	for _, stop := range stops {
+		alerts = append(alerts, f.Snapshot.Alerts[stop]...)
+	}
+
+	data := []interface{}{}
+	seen := map[string]bool{}
+	for _, alert := range alerts {
+		if seen[alert.ID] || (effects != nil && !contains_value(effects, alert.Attribute.Effect)) {
+			continue
+		}
+		seen[alert.ID] = true
+		data = append(data, alert)
+	}
+	write_api_page(w, r, data, nil)
+}
+
+func (f *FakeAPI) handle_shapes(w http.ResponseWriter, r *http.Request) {
+	routes := filter_values(r, "route")
+	if routes == nil {
+		write_api_error(w, http.StatusBadRequest, "bad_request", "filter[route] is required.")
+		return
+	}
+	data := []interface{}{}
+	for _, route := range routes {
+		for _, shape := range f.Snapshot.Shapes[route] {
+			data = append(data, shape)
+		}
+	}
+	write_api_page(w, r, data, nil)
+}
+
+func (f *FakeAPI) handle_facilities(w http.ResponseWriter, r *http.Request) {
+	types, stops := filter_values(r, "type"), filter_values(r, "stop")
+	data := []interface{}{}
+	for _, facility := range f.Snapshot.Facilities {
+		if types != nil && !contains_value(types, facility.Attribute.Type) {
+			continue
+		}
+		if stops != nil && !contains_value(stops, facility.Relationships.Stop.Data.ID) {
+			continue
+		}
+		data = append(data, facility)
+	}
+	write_api_page(w, r, data, nil)
+}
+
+// handle_schedules answers with the schedules recorded for each route, whatever the time filters, since
+// the snapshot was taken with the ones ConcreteMBTAWebServer always asks for.
+func (f *FakeAPI) handle_schedules(w http.ResponseWriter, r *http.Request) {
+	routes := filter_values(r, "route")
+	if routes == nil {
+		write_api_error(w, http.StatusBadRequest, "bad_request", "At least one filter[] is required.")
+		return
+	}
+	data, included := []interface{}{}, []interface{}{}
+	seen := map[string]bool{}
+	for _, route := range routes {
+		schedules := f.Snapshot.Schedules[route]
+		for _, schedule := range schedules.Data {
+			data = append(data, schedule)
+		}
+		for _, stop := range schedules.Included {
+			if !seen[stop.ID] {
+				seen[stop.ID] = true
+				included = append(included, stop)
+			}
+		}
+	}
+	if r.URL.Query().Get("include") != "stop" {
+		included = nil
+	}
+	write_api_page(w, r, data, included)
+}
+
+// run_fake_api serves the snapshot at addr until it is sent SIGINT or SIGTERM, as run_server does.
+func run_fake_api(api *FakeAPI, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return serve_until_done(ctx, &http.Server{Addr: addr, Handler: api.handler()})
+}
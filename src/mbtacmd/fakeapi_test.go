@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mock_fake_api_snapshot() Snapshot {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line", Type: 1, SortOrder: 10010}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B", Type: 0, SortOrder: 10032}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore"}}
+	prediction := func(id string, route string, departure string) Prediction {
+		return Prediction{
+			ID:            id,
+			Attribute:     PredictionAttribute{DepartureTime: departure},
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: route}}},
+		}
+	}
+
+	return Snapshot{
+		Routes:     []Route{red, green},
+		RouteStops: map[string][]Stop{"Red": {alewife, park}, "Green-B": {park, kenmore}},
+		Shapes:     map[string][]Shape{"Red": {{ID: "931_0009", Attribute: ShapeAttribute{Polyline: "_p~iF~ps|U"}}}, "Green-B": {}},
+		Predictions: map[string][]Prediction{
+			"place-alfcl": {},
+			"place-pktrm": {
+				prediction("prediction 2", "Green-B", "2020-01-01T12:09:00Z"),
+				prediction("prediction 1", "Red", "2020-01-01T12:03:00Z"),
+			},
+			"place-kencl": {},
+		},
+		Alerts: map[string][]Alert{
+			"place-alfcl": {{ID: "alert 1", Attribute: AlertAttribute{Header: "Shuttle buses", Effect: "SHUTTLE"}}},
+			"place-pktrm": {},
+			"place-kencl": {},
+		},
+		Facilities: []Facility{
+			{ID: "804", Attribute: FacilityAttribute{Type: "ELEVATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-pktrm"}}}},
+		},
+		Schedules: map[string]ScheduleWrapper{
+			"Red": {
+				Data:     []Schedule{mock_schedule("trip 1", "70061", 1, "", "2020-01-01T08:00:00-05:00")},
+				Included: []ScheduleStop{{ID: "70061", Relationships: ScheduleStopRelationships{ParentStation: Relationship{Data: RelationshipData{ID: "place-alfcl"}}}}},
+			},
+			"Green-B": {Data: []Schedule{}},
+		},
+		AccessibilityAlerts: []Alert{{ID: "alert 2", Attribute: AlertAttribute{Effect: "ELEVATOR_CLOSURE", InformedEntity: []AlertEntity{{Facility: "804"}}}}},
+	}
+}
+
+func get_api_page(t *testing.T, url string) (int, http.Header, APIPage) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	defer resp.Body.Close()
+	page := APIPage{}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	}
+	return resp.StatusCode, resp.Header, page
+}
+
+func Test_FakeAPI(t *testing.T) {
+	snapshot := mock_fake_api_snapshot()
+	server := httptest.NewServer(new_fake_api(snapshot).handler())
+	defer server.Close()
+	api := ConcreteMBTAWebServer{BaseURL: server.URL}
+
+	t.Run("happy path - a snapshot taken through it is the same snapshot", func(t *testing.T) {
+		found, err := take_snapshot(api, true, snapshot.TakenAt)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if !reflect.DeepEqual(snapshot.Routes, found.Routes) || !reflect.DeepEqual(snapshot.RouteStops, found.RouteStops) {
+			t.Errorf("expected %+v to be equal to %+v", snapshot.RouteStops, found.RouteStops)
+		}
+		if !reflect.DeepEqual(snapshot.Shapes, found.Shapes) || !reflect.DeepEqual(snapshot.Schedules, found.Schedules) {
+			t.Errorf("expected %+v to be equal to %+v", snapshot.Schedules, found.Schedules)
+		}
+		if !reflect.DeepEqual(snapshot.Facilities, found.Facilities) || !reflect.DeepEqual(snapshot.AccessibilityAlerts, found.AccessibilityAlerts) {
+			t.Errorf("expected %+v to be equal to %+v", snapshot.AccessibilityAlerts, found.AccessibilityAlerts)
+		}
+		if !reflect.DeepEqual(snapshot.Alerts, found.Alerts) {
+			t.Errorf("expected %+v to be equal to %+v", snapshot.Alerts, found.Alerts)
+		}
+
+		// The predictions come back in departure order.
+		expected := []Prediction{snapshot.Predictions["place-pktrm"][1], snapshot.Predictions["place-pktrm"][0]}
+		if !reflect.DeepEqual(expected, found.Predictions["place-pktrm"]) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Predictions["place-pktrm"])
+		}
+	})
+
+	t.Run("happy path - filters", func(t *testing.T) {
+		_, _, page := get_api_page(t, server.URL+"/routes?filter[type]=1")
+		if len(page.Data) != 1 {
+			t.Errorf("expected only the heavy rail route, got %+v", page.Data)
+		}
+
+		_, _, page = get_api_page(t, server.URL+"/stops?filter[route]=Red,Green-B")
+		if len(page.Data) != 3 {
+			t.Errorf("expected each stop once, got %+v", page.Data)
+		}
+
+		_, _, page = get_api_page(t, server.URL+"/predictions?filter[stop]=place-pktrm&filter[route]=Green-B")
+		if len(page.Data) != 1 {
+			t.Errorf("expected only the Green Line B prediction, got %+v", page.Data)
+		}
+
+		_, _, page = get_api_page(t, server.URL+"/alerts?filter[effect]=SHUTTLE")
+		if len(page.Data) != 1 {
+			t.Errorf("expected only the shuttle alert, got %+v", page.Data)
+		}
+	})
+
+	t.Run("happy path - pages", func(t *testing.T) {
+		status, _, page := get_api_page(t, server.URL+"/stops?page[offset]=1&page[limit]=1")
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if len(page.Data) != 1 || page.Data[0].(map[string]interface{})["id"] != "place-pktrm" {
+			t.Errorf("expected the second stop, got %+v", page.Data)
+		}
+		expected := map[string]string{
+			"self":  "/stops?page[offset]=1&page[limit]=1",
+			"first": "/stops?page%5Blimit%5D=1&page%5Boffset%5D=0",
+			"prev":  "/stops?page%5Blimit%5D=1&page%5Boffset%5D=0",
+			"next":  "/stops?page%5Blimit%5D=1&page%5Boffset%5D=2",
+			"last":  "/stops?page%5Blimit%5D=1&page%5Boffset%5D=2",
+		}
+		if !reflect.DeepEqual(expected, page.Links) {
+			t.Errorf("expected %+v to be equal to %+v", expected, page.Links)
+		}
+	})
+
+	for name, path := range map[string]string{
+		"predictions without a filter": "/predictions",
+		"shapes without a route":       "/shapes",
+		"a bad page limit":             "/routes?page[limit]=0",
+		"a bad sort":                   "/predictions?filter[stop]=place-pktrm&sort=color",
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			status, _, _ := get_api_page(t, server.URL+path)
+			if status != http.StatusBadRequest {
+				t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+
+	t.Run("sad path - unknown resource", func(t *testing.T) {
+		status, _, _ := get_api_page(t, server.URL+"/vehicles")
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d to be %d", status, http.StatusNotFound)
+		}
+	})
+}
+
+func Test_FakeAPI_limits(t *testing.T) {
+	t.Run("happy path - rate limited until the window passes", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		fake := new_fake_api(mock_fake_api_snapshot())
+		fake.RateLimit = 2
+		fake.now = func() time.Time { return now }
+		server := httptest.NewServer(fake.handler())
+		defer server.Close()
+
+		for i, expected := range []string{"1", "0"} {
+			status, header, _ := get_api_page(t, server.URL+"/routes")
+			if status != http.StatusOK || header.Get("x-ratelimit-remaining") != expected {
+				t.Errorf("expected request %d to be allowed with %s remaining, got %d and %s", i+1, expected, status, header.Get("x-ratelimit-remaining"))
+			}
+		}
+		status, header, _ := get_api_page(t, server.URL+"/routes")
+		if status != http.StatusTooManyRequests || header.Get("x-ratelimit-reset") != "1577880060" {
+			t.Errorf("expected a 429 until 12:01, got %d and %s", status, header.Get("x-ratelimit-reset"))
+		}
+		if _, err := (ConcreteMBTAWebServer{BaseURL: server.URL}).GetFacilities(); err != ErrWebFailure {
+			t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+		}
+
+		now = now.Add(time.Minute)
+		status, _, _ = get_api_page(t, server.URL+"/routes")
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+	})
+
+	t.Run("happy path - the reports stay within the anonymous limit", func(t *testing.T) {
+		// Eight routes, as many as the real heavy and light rail network has.
+		snapshot := mock_fake_api_snapshot()
+		for i := 0; i < 6; i++ {
+			route := Route{ID: fmt.Sprintf("route-%d", i), Attribute: RouteAttribute{LongName: fmt.Sprintf("Route %d", i), SortOrder: 10100 + i}}
+			snapshot.Routes = append(snapshot.Routes, route)
+			snapshot.RouteStops[route.ID] = []Stop{{ID: fmt.Sprintf("stop-%d", i), Attribute: StopAttribute{Name: fmt.Sprintf("Stop %d", i)}}}
+			snapshot.Schedules[route.ID] = ScheduleWrapper{Data: []Schedule{}}
+		}
+		fake := new_fake_api(snapshot)
+		fake.RateLimit = 20
+		fake.now = func() time.Time { return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC) }
+		server := httptest.NewServer(fake.handler())
+		defer server.Close()
+
+		out := &bytes.Buffer{}
+		err := print_reports(ConcreteMBTAWebServer{BaseURL: server.URL}, PlanOptions{}, strings.NewReader("Alewife\nKenmore\n"), out)
+		if err != nil {
+			t.Errorf("did not expect an error after %d requests: %s", fake.requests, err)
+		}
+		// One for the route list, and one for the routes, the stops and the schedules of each route.
+		if fake.requests != 18 {
+			t.Errorf("expected %d requests to be 18", fake.requests)
+		}
+	})
+
+	t.Run("happy path - failing every other request", func(t *testing.T) {
+		fake := new_fake_api(mock_fake_api_snapshot())
+		fake.FailEvery = 2
+		server := httptest.NewServer(fake.handler())
+		defer server.Close()
+		api := ConcreteMBTAWebServer{BaseURL: server.URL}
+
+		if _, err := api.GetRoutes(RouteRailTypeLightRail, RouteRailTypeHeavyRail); err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		if _, err := api.GetRoutes(RouteRailTypeLightRail, RouteRailTypeHeavyRail); err != ErrWebFailure {
+			t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+		}
+		if _, err := api.GetRoutes(RouteRailTypeLightRail, RouteRailTypeHeavyRail); err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrBadFareData = errors.New("could not read fare data")
+
+// GTFS-Fares v2 fare_transfer_type values, which say how the transfer's cost combines with the legs on
+// either side of it.
+const (
+	// fareTransferAddToFrom pays the first leg and then the transfer instead of the second leg.
+	fareTransferAddToFrom = 0
+	// fareTransferAddToBoth pays both legs and the transfer on top.
+	fareTransferAddToBoth = 1
+	// fareTransferReplaceBoth pays only the transfer for the two legs together.
+	fareTransferReplaceBoth = 2
+)
+
+// GTFS-Fares v2 duration_limit_type values, which say which ends of the first leg of a run of transfers and
+// of the leg after the transfer a duration limit is measured between.
+const (
+	fareDurationStartToStart = 0
+	fareDurationStartToEnd   = 1
+	fareDurationEndToStart   = 2
+	fareDurationEndToEnd     = 3
+)
+
+type FareProduct struct {
+	ID   string
+	Name string
+	// Media and RiderCategory are IDs, and empty when the product is the same on every medium or for every rider.
+	Media         string
+	RiderCategory string
+	// Amount is in cents, so that adding up fares never rounds.
+	Amount   int
+	Currency string
+}
+
+// FareLegRule prices a ride on one network between two areas, where an empty network or area matches
+// any. The highest Priority wins when several match.
+type FareLegRule struct {
+	LegGroup string
+	Network  string
+	FromArea string
+	ToArea   string
+	Product  string
+	Priority int
+}
+
+// FareTransferRule prices changing from a ride in one leg group to a ride in another. An empty Product
+// is a free transfer.
+type FareTransferRule struct {
+	FromLegGroup string
+	ToLegGroup   string
+	// TransferCount is how many transfers in a row the rule applies to, or -1 for any number.
+	TransferCount int
+	// DurationLimit is the seconds the transfer has to be made in, or 0 for no limit, measured from the
+	// first leg of the transfers in a row to the leg after this one as DurationLimitType says.
+	DurationLimit     int
+	DurationLimitType int
+	TransferType      int
+	Product           string
+}
+
+// FareRules are the fares read from a directory of GTFS-Fares v2 files (see load_fare_rules), so the
+// fares can change without the code changing.
+type FareRules struct {
+	MediaNames           map[string]string
+	RiderCategoryNames   map[string]string
+	DefaultRiderCategory string
+	Products             map[string][]FareProduct
+	// RouteNetworks and StopAreas are keyed by route and stop ID.
+	RouteNetworks map[string]string
+	StopAreas     map[string][]string
+	LegRules      []FareLegRule
+	TransferRules []FareTransferRule
+	// Options are the medium and rider category pairs there are products for, in the order the products
+	// file first lists them.
+	Options []FareOption
+}
+
+type FareOption struct {
+	Media         string
+	RiderCategory string
+}
+
+// Fare is what an itinerary costs paying one way, e.g. with a CharlieCard at the reduced fare.
+type Fare struct {
+	Media         string
+	RiderCategory string
+	// Amount is in cents, like FareProduct.Amount.
+	Amount   int
+	Currency string
+}
+
+func (f Fare) String() string {
+	name := f.Media
+	if f.RiderCategory != "" {
+		name = fmt.Sprintf("%s (%s)", name, f.RiderCategory)
+	}
+	if f.Currency == "" || f.Currency == "USD" {
+		return fmt.Sprintf("%s $%s", name, format_cents(f.Amount))
+	}
+	return fmt.Sprintf("%s %s %s", name, format_cents(f.Amount), f.Currency)
+}
+
+// parse_cents reads an amount like "2.40" as 240 cents, without going through a float. It takes at most
+// two decimal places, which is all a fare in dollars has.
+func parse_cents(amount string) (int, error) {
+	sign := 1
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = -1, amount[1:]
+	}
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if whole == "" && fraction == "" {
+		return 0, ErrBadFareData
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > 2 || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return 0, ErrBadFareData
+	}
+	dollars, err := strconv.Atoi(whole)
+	if err != nil {
+		return 0, ErrBadFareData
+	}
+	cents, _ := strconv.Atoi(fraction + strings.Repeat("0", 2-len(fraction)))
+	return sign * (dollars*100 + cents), nil
+}
+
+// format_cents writes cents back out as an amount like "2.40".
+func format_cents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// read_gtfs_table reads a CSV file with a header row into one map per row, keyed by column name, since
+// GTFS files can have their columns in any order and leave optional ones out. A missing file is no rows.
+func read_gtfs_table(path string) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrBadFareData, filepath.Base(path), err)
+	}
+	// Spreadsheets like to start CSV files with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	rows := []map[string]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrBadFareData, filepath.Base(path), err)
+		}
+		row := map[string]string{}
+		for i, column := range header {
+			row[strings.TrimSpace(column)] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, row)
+	}
+}
+
+// load_fare_rules reads fare_products.txt and fare_leg_rules.txt, which are required, and the optional
+// fare_media.txt, rider_categories.txt, route_networks.txt, stop_areas.txt and fare_transfer_rules.txt
+// from a directory, using the columns GTFS-Fares v2 gives them.
+func load_fare_rules(dir string) (FareRules, error) {
+	tables := map[string][]map[string]string{}
+	for _, name := range []string{"fare_media", "rider_categories", "fare_products", "route_networks", "stop_areas", "fare_leg_rules", "fare_transfer_rules"} {
+		rows, err := read_gtfs_table(filepath.Join(dir, name+".txt"))
+		if err != nil {
+			return FareRules{}, err
+		}
+		tables[name] = rows
+	}
+	if len(tables["fare_products"]) == 0 || len(tables["fare_leg_rules"]) == 0 {
+		return FareRules{}, fmt.Errorf("%w: %s needs fare_products.txt and fare_leg_rules.txt", ErrBadFareData, dir)
+	}
+
+	rules := FareRules{
+		MediaNames:         map[string]string{},
+		RiderCategoryNames: map[string]string{},
+		Products:           map[string][]FareProduct{},
+		RouteNetworks:      map[string]string{},
+		StopAreas:          map[string][]string{},
+		LegRules:           []FareLegRule{},
+		TransferRules:      []FareTransferRule{},
+		Options:            []FareOption{},
+	}
+	for _, row := range tables["fare_media"] {
+		rules.MediaNames[row["fare_media_id"]] = row["fare_media_name"]
+	}
+	for _, row := range tables["rider_categories"] {
+		rules.RiderCategoryNames[row["rider_category_id"]] = row["rider_category_name"]
+		if row["is_default_fare_category"] == "1" {
+			rules.DefaultRiderCategory = row["rider_category_id"]
+		}
+	}
+	for _, row := range tables["fare_products"] {
+		amount, err := parse_cents(row["amount"])
+		if err != nil {
+			return FareRules{}, fmt.Errorf("%w: fare_products.txt: bad amount %q", ErrBadFareData, row["amount"])
+		}
+		product := FareProduct{
+			ID:            row["fare_product_id"],
+			Name:          row["fare_product_name"],
+			Media:         row["fare_media_id"],
+			RiderCategory: row["rider_category_id"],
+			Amount:        amount,
+			Currency:      row["currency"],
+		}
+		if product.RiderCategory == "" {
+			product.RiderCategory = rules.DefaultRiderCategory
+		}
+		rules.Products[product.ID] = append(rules.Products[product.ID], product)
+
+		option := FareOption{Media: product.Media, RiderCategory: product.RiderCategory}
+		if !contains_fare_option(rules.Options, option) {
+			rules.Options = append(rules.Options, option)
+		}
+	}
+	for _, row := range tables["route_networks"] {
+		rules.RouteNetworks[row["route_id"]] = row["network_id"]
+	}
+	for _, row := range tables["stop_areas"] {
+		rules.StopAreas[row["stop_id"]] = append(rules.StopAreas[row["stop_id"]], row["area_id"])
+	}
+	for _, row := range tables["fare_leg_rules"] {
+		priority := 0
+		if row["rule_priority"] != "" {
+			parsed, err := strconv.Atoi(row["rule_priority"])
+			if err != nil {
+				return FareRules{}, fmt.Errorf("%w: fare_leg_rules.txt: bad rule_priority %q", ErrBadFareData, row["rule_priority"])
+			}
+			priority = parsed
+		}
+		rules.LegRules = append(rules.LegRules, FareLegRule{
+			LegGroup: row["leg_group_id"],
+			Network:  row["network_id"],
+			FromArea: row["from_area_id"],
+			ToArea:   row["to_area_id"],
+			Product:  row["fare_product_id"],
+			Priority: priority,
+		})
+	}
+	sort.SliceStable(rules.LegRules, func(i, j int) bool { return rules.LegRules[i].Priority > rules.LegRules[j].Priority })
+	for _, row := range tables["fare_transfer_rules"] {
+		transferType, err := strconv.Atoi(row["fare_transfer_type"])
+		if err != nil {
+			return FareRules{}, fmt.Errorf("%w: fare_transfer_rules.txt: bad fare_transfer_type %q", ErrBadFareData, row["fare_transfer_type"])
+		}
+		transferCount := -1
+		if row["transfer_count"] != "" {
+			transferCount, err = strconv.Atoi(row["transfer_count"])
+			if err != nil || transferCount == 0 || transferCount < -1 {
+				return FareRules{}, fmt.Errorf("%w: fare_transfer_rules.txt: bad transfer_count %q", ErrBadFareData, row["transfer_count"])
+			}
+		}
+		durationLimit, durationLimitType := 0, 0
+		if row["duration_limit"] != "" {
+			durationLimit, err = strconv.Atoi(row["duration_limit"])
+			if err != nil || durationLimit <= 0 {
+				return FareRules{}, fmt.Errorf("%w: fare_transfer_rules.txt: bad duration_limit %q", ErrBadFareData, row["duration_limit"])
+			}
+			durationLimitType, err = strconv.Atoi(row["duration_limit_type"])
+			if err != nil || durationLimitType < fareDurationStartToStart || durationLimitType > fareDurationEndToEnd {
+				return FareRules{}, fmt.Errorf("%w: fare_transfer_rules.txt: bad duration_limit_type %q", ErrBadFareData, row["duration_limit_type"])
+			}
+		}
+		rules.TransferRules = append(rules.TransferRules, FareTransferRule{
+			FromLegGroup:      row["from_leg_group_id"],
+			ToLegGroup:        row["to_leg_group_id"],
+			TransferCount:     transferCount,
+			DurationLimit:     durationLimit,
+			DurationLimitType: durationLimitType,
+			TransferType:      transferType,
+			Product:           row["fare_product_id"],
+		})
+	}
+	return rules, nil
+}
+
+func contains_fare_option(options []FareOption, option FareOption) bool {
+	for _, other := range options {
+		if other == option {
+			return true
+		}
+	}
+	return false
+}
+
+// product_for finds what a product costs paying with the given option, if it can be paid that way at all.
+func (r FareRules) product_for(id string, option FareOption) (FareProduct, bool) {
+	for _, product := range r.Products[id] {
+		if (product.Media == "" || product.Media == option.Media) && product.RiderCategory == option.RiderCategory {
+			return product, true
+		}
+	}
+	return FareProduct{}, false
+}
+
+func (r FareRules) in_area(stop Stop, area string) bool {
+	if area == "" {
+		return true
+	}
+	for _, stopArea := range r.StopAreas[stop.ID] {
+		if stopArea == area {
+			return true
+		}
+	}
+	return false
+}
+
+// leg_rule is the highest priority rule matching a ride that can be paid for with the given option.
+func (r FareRules) leg_rule(leg Leg, option FareOption) (FareLegRule, FareProduct, bool) {
+	for _, rule := range r.LegRules {
+		if rule.Network != "" && rule.Network != r.RouteNetworks[leg.Route.ID] {
+			continue
+		}
+		if !r.in_area(leg.From, rule.FromArea) || !r.in_area(leg.To, rule.ToArea) {
+			continue
+		}
+		if product, ok := r.product_for(rule.Product, option); ok {
+			return rule, product, true
+		}
+	}
+	return FareLegRule{}, FareProduct{}, false
+}
+
+// transfer_for finds the transfer between two rides and what it costs paying with the given option, after
+// transfers in a row since the last leg paid in full. A transfer whose product can't be paid for that way
+// (e.g. a discount only on a CharlieCard), that has been made too many times in a row, or that takes longer
+// than its limit by elapsed (in minutes, for a duration_limit_type) doesn't apply.
+func (r FareRules) transfer_for(from FareLegRule, to FareLegRule, option FareOption, transfers int, elapsed func(int) float64) (FareTransferRule, int, bool) {
+	for _, rule := range r.TransferRules {
+		if rule.FromLegGroup != from.LegGroup || rule.ToLegGroup != to.LegGroup {
+			continue
+		}
+		if rule.TransferCount >= 0 && transfers >= rule.TransferCount {
+			continue
+		}
+		if rule.DurationLimit > 0 && elapsed(rule.DurationLimitType)*60 > float64(rule.DurationLimit) {
+			continue
+		}
+		if rule.Product == "" {
+			return rule, 0, true
+		}
+		if product, ok := r.product_for(rule.Product, option); ok {
+			return rule, product.Amount, true
+		}
+	}
+	return FareTransferRule{}, 0, false
+}
+
+// fare_leg_times are when each leg of an itinerary starts and ends, in minutes from the start of the trip,
+// going by its estimate. Without an estimate every leg is at the start, so no duration limit runs out.
+func fare_leg_times(itinerary Itinerary, estimate TripEstimate) ([]float64, []float64) {
+	starts, ends := make([]float64, len(itinerary.Legs)), make([]float64, len(itinerary.Legs))
+	if len(estimate.Legs) != len(itinerary.Legs) {
+		return starts, ends
+	}
+	minutes := 0.0
+	for i, leg := range estimate.Legs {
+		starts[i] = minutes + leg.WaitMinutes
+		minutes += leg.TotalMinutes()
+		ends[i] = minutes
+	}
+	return starts, ends
+}
+
+// fare is what an itinerary costs paying with one option, or false when one of its rides can't be paid
+// for that way. Walks are free and don't break a transfer. A transfer that replaces both legs takes back
+// what was charged for the leg before it, so after an earlier transfer it only takes back that transfer.
+func (r FareRules) fare(itinerary Itinerary, estimate TripEstimate, option FareOption) (Fare, bool) {
+	fare := Fare{Media: r.MediaNames[option.Media], RiderCategory: r.RiderCategoryNames[option.RiderCategory]}
+	if fare.Media == "" {
+		fare.Media = option.Media
+	}
+	if option.RiderCategory == r.DefaultRiderCategory {
+		fare.RiderCategory = ""
+	}
+
+	starts, ends := fare_leg_times(itinerary, estimate)
+	var previousRule FareLegRule
+	previousCharged := 0
+	// first is the leg the transfers in a row started from, the last one paid for in full.
+	first, transfers := 0, 0
+	rides := 0
+	for i, leg := range itinerary.Legs {
+		if leg.Walk {
+			continue
+		}
+		rule, product, ok := r.leg_rule(leg, option)
+		if !ok {
+			return Fare{}, false
+		}
+		fare.Currency = product.Currency
+		amount := product.Amount
+
+		transferred := false
+		if rides > 0 {
+			elapsed := func(limitType int) float64 {
+				from, to := starts[first], starts[i]
+				if limitType == fareDurationEndToStart || limitType == fareDurationEndToEnd {
+					from = ends[first]
+				}
+				if limitType == fareDurationStartToEnd || limitType == fareDurationEndToEnd {
+					to = ends[i]
+				}
+				return to - from
+			}
+			if transfer, transferAmount, ok := r.transfer_for(previousRule, rule, option, transfers, elapsed); ok {
+				switch transfer.TransferType {
+				case fareTransferAddToFrom:
+					amount = transferAmount
+				case fareTransferAddToBoth:
+					amount += transferAmount
+				case fareTransferReplaceBoth:
+					amount = transferAmount - previousCharged
+				}
+				transferred = true
+			}
+		}
+		if transferred {
+			transfers++
+		} else {
+			first, transfers = i, 0
+		}
+
+		fare.Amount += amount
+		previousRule, previousCharged = rule, amount
+		rides++
+	}
+	return fare, true
+}
+
+// itinerary_fares is what an itinerary costs every way it can be paid for, timing its transfers by estimate.
+func (r FareRules) itinerary_fares(itinerary Itinerary, estimate TripEstimate) []Fare {
+	fares := []Fare{}
+	if len(itinerary.Routes()) == 0 {
+		return fares
+	}
+	for _, option := range r.Options {
+		if fare, ok := r.fare(itinerary, estimate, option); ok {
+			fares = append(fares, fare)
+		}
+	}
+	return fares
+}
+
+func print_fares(out io.Writer, indent string, fares []Fare) {
+	if len(fares) == 0 {
+		return
+	}
+	names := []string{}
+	for _, fare := range fares {
+		names = append(names, fare.String())
+	}
+	fmt.Fprintf(out, "%sFare: %s\n", indent, strings.Join(names, ", "))
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_load_fare_rules(t *testing.T) {
+	t.Run("happy path - testdata", func(t *testing.T) {
+		expected := []FareOption{{Media: "card", RiderCategory: "adult"}, {Media: "ticket", RiderCategory: "adult"}, {Media: "card", RiderCategory: "reduced"}}
+
+		rules, err := load_fare_rules("testdata/fares")
+		if err != nil {
+			t.Errorf("did not expect an error, got %s", err)
+		}
+		if !reflect.DeepEqual(expected, rules.Options) {
+			t.Errorf("expected %+v to be equal to %+v", expected, rules.Options)
+		}
+		if len(rules.LegRules) != 4 || rules.LegRules[0].Priority != 1 {
+			t.Errorf("expected the zone rules first, got %+v", rules.LegRules)
+		}
+	})
+
+	t.Run("happy path - amounts in cents", func(t *testing.T) {
+		rules, err := load_fare_rules("testdata/fares")
+		if err != nil {
+			t.Errorf("did not expect an error, got %s", err)
+		}
+		expected := FareProduct{ID: "bus", Name: "Bus", Media: "card", RiderCategory: "reduced", Amount: 85, Currency: "USD"}
+		if !reflect.DeepEqual(expected, rules.Products["bus"][2]) {
+			t.Errorf("expected %+v to be equal to %+v", expected, rules.Products["bus"][2])
+		}
+	})
+
+	t.Run("sad path - no fares there", func(t *testing.T) {
+		_, err := load_fare_rules(t.TempDir())
+		if !errors.Is(err, ErrBadFareData) {
+			t.Errorf("expected error %s to be %s", err, ErrBadFareData)
+		}
+	})
+
+	t.Run("sad path - transfer count of zero", func(t *testing.T) {
+		dir := write_fare_files(t, map[string]string{
+			"fare_products.txt":       "fare_product_id,amount\nbus,1.70\n",
+			"fare_leg_rules.txt":      "leg_group_id,fare_product_id\nbus,bus\n",
+			"fare_transfer_rules.txt": "from_leg_group_id,to_leg_group_id,transfer_count,fare_transfer_type\nbus,bus,0,0\n",
+		})
+
+		_, err := load_fare_rules(dir)
+		if !errors.Is(err, ErrBadFareData) {
+			t.Errorf("expected error %s to be %s", err, ErrBadFareData)
+		}
+	})
+
+	t.Run("sad path - duration limit without a type", func(t *testing.T) {
+		dir := write_fare_files(t, map[string]string{
+			"fare_products.txt":       "fare_product_id,amount\nbus,1.70\n",
+			"fare_leg_rules.txt":      "leg_group_id,fare_product_id\nbus,bus\n",
+			"fare_transfer_rules.txt": "from_leg_group_id,to_leg_group_id,duration_limit,fare_transfer_type\nbus,bus,7200,0\n",
+		})
+
+		_, err := load_fare_rules(dir)
+		if !errors.Is(err, ErrBadFareData) {
+			t.Errorf("expected error %s to be %s", err, ErrBadFareData)
+		}
+	})
+
+	t.Run("sad path - bad amount", func(t *testing.T) {
+		dir := write_fare_files(t, map[string]string{
+			"fare_products.txt":  "fare_product_id,amount\nsubway,free\n",
+			"fare_leg_rules.txt": "leg_group_id,fare_product_id\nsubway,subway\n",
+		})
+
+		_, err := load_fare_rules(dir)
+		if !errors.Is(err, ErrBadFareData) {
+			t.Errorf("expected error %s to be %s", err, ErrBadFareData)
+		}
+	})
+}
+
+func Test_itinerary_fares(t *testing.T) {
+	rules, err := load_fare_rules("testdata/fares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	bus := Route{ID: "39", Attribute: RouteAttribute{LongName: "Forest Hills - Back Bay Station"}}
+	rail := Route{ID: "CR-Providence", Attribute: RouteAttribute{LongName: "Providence/Stoughton Line"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore"}}
+	southStation := Stop{ID: "place-sstat", Attribute: StopAttribute{Name: "South Station"}}
+	quincy := Stop{ID: "place-qnctr", Attribute: StopAttribute{Name: "Quincy Center"}}
+
+	t.Run("happy path - free transfer between subway lines", func(t *testing.T) {
+		expected := []Fare{
+			{Media: "Card", Amount: 240, Currency: "USD"},
+			{Media: "Ticket", Amount: 240, Currency: "USD"},
+			{Media: "Card", RiderCategory: "Reduced", Amount: 110, Currency: "USD"},
+		}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: red, From: alewife, To: park, Stops: 1},
+			{Route: green, From: park, To: kenmore, Stops: 1},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - bus to subway upgrade only on a card", func(t *testing.T) {
+		expected := []Fare{
+			{Media: "Card", Amount: 240, Currency: "USD"},
+			{Media: "Ticket", Amount: 410, Currency: "USD"},
+			{Media: "Card", RiderCategory: "Reduced", Amount: 110, Currency: "USD"},
+		}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: bus, From: kenmore, To: park, Stops: 5},
+			{Route: red, From: park, To: alewife, Stops: 1},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - commuter rail zones", func(t *testing.T) {
+		expected := []Fare{{Media: "Ticket", Amount: 650, Currency: "USD"}}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{{Route: rail, From: southStation, To: quincy, Stops: 2}}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - nothing to pay for", func(t *testing.T) {
+		expected := []Fare{}
+
+		found := rules.itinerary_fares(Itinerary{}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("sad path - a route with no fare", func(t *testing.T) {
+		expected := []Fare{}
+		unknown := Route{ID: "Ferry"}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{{Route: unknown, From: park, To: kenmore, Stops: 1}}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func write_fare_files(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func Test_fare_replacing_both_legs(t *testing.T) {
+	// Changing between subway lines is free, and a subway ride and a bus ride together cost $3.00 either way.
+	rules, err := load_fare_rules(write_fare_files(t, map[string]string{
+		"fare_products.txt":       "fare_product_id,fare_media_id,amount,currency\nsubway,card,2.40,USD\nbus,card,1.70,USD\ncombo,card,3.00,USD\n",
+		"route_networks.txt":      "network_id,route_id\nsubway,Red\nsubway,Green-B\nbus,39\n",
+		"fare_leg_rules.txt":      "leg_group_id,network_id,fare_product_id\nsubway,subway,subway\nbus,bus,bus\n",
+		"fare_transfer_rules.txt": "from_leg_group_id,to_leg_group_id,fare_transfer_type,fare_product_id\nsubway,subway,0,\nsubway,bus,2,combo\nbus,subway,2,combo\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := Route{ID: "Red"}
+	green := Route{ID: "Green-B"}
+	bus := Route{ID: "39"}
+	alewife := Stop{ID: "place-alfcl"}
+	park := Stop{ID: "place-pktrm"}
+	kenmore := Stop{ID: "place-kencl"}
+
+	t.Run("happy path - one transfer", func(t *testing.T) {
+		expected := []Fare{{Media: "card", Amount: 300, Currency: "USD"}}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: red, From: alewife, To: park, Stops: 1},
+			{Route: bus, From: park, To: kenmore, Stops: 5},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - two transfers in a row", func(t *testing.T) {
+		// The free transfer to Green Line B leaves nothing charged for that leg, so the combo takes nothing
+		// back and is paid on top of the Red Line fare.
+		expected := []Fare{{Media: "card", Amount: 540, Currency: "USD"}}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: red, From: alewife, To: park, Stops: 1},
+			{Route: green, From: park, To: kenmore, Stops: 1},
+			{Route: bus, From: kenmore, To: park, Stops: 5},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - three legs in a chain", func(t *testing.T) {
+		// The bus leg is charged the $0.60 the combo adds to the Red Line fare, so the combo back to the
+		// subway takes back only that.
+		expected := []Fare{{Media: "card", Amount: 540, Currency: "USD"}}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: red, From: alewife, To: park, Stops: 1},
+			{Route: bus, From: park, To: kenmore, Stops: 5},
+			{Route: green, From: kenmore, To: park, Stops: 1},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func Test_fare_transfer_limits(t *testing.T) {
+	// A bus can be changed for another bus once for free, and a bus for the subway within an hour of
+	// getting on the bus to getting off the subway.
+	rules, err := load_fare_rules(write_fare_files(t, map[string]string{
+		"fare_products.txt":  "fare_product_id,fare_media_id,amount,currency\nsubway,card,2.40,USD\nbus,card,1.70,USD\n",
+		"route_networks.txt": "network_id,route_id\nsubway,Red\nbus,39\nbus,1\n",
+		"fare_leg_rules.txt": "leg_group_id,network_id,fare_product_id\nsubway,subway,subway\nbus,bus,bus\n",
+		"fare_transfer_rules.txt": "from_leg_group_id,to_leg_group_id,transfer_count,duration_limit,duration_limit_type,fare_transfer_type,fare_product_id\n" +
+			"bus,bus,1,,,0,\nbus,subway,,3600,1,0,\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := Route{ID: "Red"}
+	bus39 := Route{ID: "39"}
+	bus1 := Route{ID: "1"}
+	park := Stop{ID: "place-pktrm"}
+	kenmore := Stop{ID: "place-kencl"}
+	busToRed := Itinerary{Legs: []Leg{
+		{Route: bus39, From: kenmore, To: park, Stops: 5},
+		{Route: red, From: park, To: kenmore, Stops: 1},
+	}}
+
+	t.Run("happy path - a transfer only so many times in a row", func(t *testing.T) {
+		expected := []Fare{{Media: "card", Amount: 340, Currency: "USD"}}
+
+		found := rules.itinerary_fares(Itinerary{Legs: []Leg{
+			{Route: bus39, From: kenmore, To: park, Stops: 5},
+			{Route: bus1, From: park, To: kenmore, Stops: 5},
+			{Route: bus39, From: kenmore, To: park, Stops: 5},
+		}}, TripEstimate{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - a transfer within its time limit", func(t *testing.T) {
+		expected := []Fare{{Media: "card", Amount: 170, Currency: "USD"}}
+		estimate := TripEstimate{Legs: []LegEstimate{{WaitMinutes: 5, InVehicleMinutes: 20}, {WaitMinutes: 5, InVehicleMinutes: 15}}}
+
+		found := rules.itinerary_fares(busToRed, estimate)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("sad path - a transfer past its time limit", func(t *testing.T) {
+		expected := []Fare{{Media: "card", Amount: 410, Currency: "USD"}}
+		estimate := TripEstimate{Legs: []LegEstimate{{WaitMinutes: 5, InVehicleMinutes: 20}, {WaitMinutes: 30, InVehicleMinutes: 15}}}
+
+		found := rules.itinerary_fares(busToRed, estimate)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func Test_parse_cents(t *testing.T) {
+	for amount, expected := range map[string]int{"2.40": 240, "2.4": 240, "2": 200, ".85": 85, "0.07": 7, "-0.50": -50} {
+		t.Run("happy path - "+amount, func(t *testing.T) {
+			found, err := parse_cents(amount)
+			if err != nil {
+				t.Error("did not expect an error")
+			}
+			if found != expected || format_cents(found) != format_cents(expected) {
+				t.Errorf("expected %d to be equal to %d", expected, found)
+			}
+		})
+	}
+
+	for _, amount := range []string{"", ".", "2.405", "free", "1e2", "2.-4"} {
+		t.Run("sad path - "+amount, func(t *testing.T) {
+			_, err := parse_cents(amount)
+			if err != ErrBadFareData {
+				t.Errorf("expected error %s to be %s", ErrBadFareData, err)
+			}
+		})
+	}
+}
+
+func Test_format_cents(t *testing.T) {
+	for cents, expected := range map[int]string{240: "2.40", 7: "0.07", 0: "0.00", -50: "-0.50", 1205: "12.05"} {
+		found := format_cents(cents)
+		if found != expected {
+			t.Errorf("expected %q to be equal to %q", expected, found)
+		}
+	}
+}
+
+func Test_plan_with_fares(t *testing.T) {
+	rules, err := load_fare_rules("testdata/fares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := mock_accessibility_network()
+	alewife, kenmore := network.Stops[0], network.Stops[2]
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		itinerary, err := plan_itinerary(network, alewife, kenmore, PlanOptions{Fares: &rules})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `Take the following routes to get from Alewife to Kenmore:
+Red Line
+Green Line B
+Fare: Card $2.40, Ticket $2.40, Card (Reduced) $1.10
+`
+		out := &bytes.Buffer{}
+		print_itinerary(out, "Alewife", "Kenmore", itinerary)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+}
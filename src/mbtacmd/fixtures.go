@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrNoFixture = errors.New("no recorded fixture for request")
+
+// Fixture is one recorded response from the MBTA API, saved as JSON so that it can be read and edited by hand.
+type Fixture struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// Body is kept as it came, since the API sends JSON but an error page might not be.
+	Body string `json:"body"`
+}
+
+var fixtureNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// fixture_path is where the response to a request is recorded: the path and query flattened into a file
+// name, e.g. routes-filter-type-0-1.json, which is readable and doesn't depend on the host, so a recording
+// from the real API replays against any base URL.
+func fixture_path(dir string, request *http.Request) string {
+	name := strings.Trim(fixtureNameUnsafe.ReplaceAllString(request.URL.Path+"?"+request.URL.RawQuery, "-"), "-")
+	return filepath.Join(dir, name+".json")
+}
+
+// RecordingTransport passes every request on to Transport (http.DefaultTransport when nil) and saves the
+// response to a fixture file in Dir, for ReplayTransport to answer the same request with later.
+type RecordingTransport struct {
+	Dir       string
+	Transport http.RoundTripper
+}
+
+func (t RecordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{URL: request.URL.String(), Status: response.StatusCode, Header: response.Header, Body: string(body)}
+	if err := save_fixture(fixture_path(t.Dir, request), fixture); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ReplayTransport answers every request from the fixture files RecordingTransport saved in Dir, without
+// touching the network, and fails any request it has no fixture for.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t ReplayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	fixture, err := load_fixture(fixture_path(t.Dir, request))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoFixture, request.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := fixture.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       request,
+	}, nil
+}
+
+func save_fixture(path string, fixture Fixture) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fixture)
+}
+
+func load_fixture(path string) (Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Fixture{}, err
+	}
+	defer file.Close()
+
+	fixture := Fixture{}
+	if err := json.NewDecoder(file).Decode(&fixture); err != nil {
+		return Fixture{}, err
+	}
+	return fixture, nil
+}
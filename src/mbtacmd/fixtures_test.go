@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replay_api answers from the responses recorded in testdata/fixtures, going through the same URL building
+// and JSON decoding as a request to the real API.
+func replay_api(metrics *MetricsRegistry) ConcreteMBTAWebServer {
+	return ConcreteMBTAWebServer{Metrics: metrics, Client: &http.Client{Transport: ReplayTransport{Dir: filepath.Join("testdata", "fixtures")}}}
+}
+
+func Test_ConcreteMBTAWebServer_replay(t *testing.T) {
+	t.Run("happy path - the route network", func(t *testing.T) {
+		network, err := build_network(replay_api(nil))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := []string{"Red Line", "Green Line B"}
+		if !reflect.DeepEqual(expected, network.route_names()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, network.route_names())
+		}
+		red := network.Routes[0]
+		expectedAttribute := RouteAttribute{
+			LongName:              "Red Line",
+			Description:           "Rapid Transit",
+			Color:                 "DA291C",
+			TextColor:             "FFFFFF",
+			SortOrder:             10010,
+			Type:                  1,
+			DirectionNames:        [2]string{"South", "North"},
+			DirectionDestinations: [2]string{"Ashmont/Braintree", "Alewife"},
+		}
+		if red.Attribute != expectedAttribute {
+			t.Errorf("expected %+v to be equal to %+v", expectedAttribute, red.Attribute)
+		}
+		boylston, _ := network.find_stop_by_name("Boylston")
+		if boylston.Attribute.WheelchairBoarding != wheelchairInaccessible || boylston.Attribute.Latitude != 42.35302 {
+			t.Errorf("expected Boylston's attributes to be decoded, got %+v", boylston)
+		}
+
+		itinerary, err := plan_itinerary(network, network.Stops[0], network.Stops[4], PlanOptions{})
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		out := &bytes.Buffer{}
+		print_itinerary(out, "Alewife", "Kenmore", itinerary)
+		expectedPlan := "Take the following routes to get from Alewife to Kenmore:\nTake the Red Line toward Ashmont/Braintree\nTake the Green Line B toward Boston College\n"
+		if out.String() != expectedPlan {
+			t.Errorf("expected %q to be equal to %q", out.String(), expectedPlan)
+		}
+	})
+
+	t.Run("happy path - predictions and alerts", func(t *testing.T) {
+		api := replay_api(nil)
+		network, err := build_network(api)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		park, _ := network.find_stop_by_name("Park Street")
+
+		predictions, err := api.GetPredictions(park)
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		now := time.Date(2024, 3, 5, 13, 0, 0, 0, time.UTC)
+		expected := []string{"Red Line (direction 0): 3 min", "Green Line B (direction 0): 5 min", "Red Line (direction 1): 11 min"}
+		found := format_departures(network, predictions.Data, now)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+
+		alerts, err := api.GetAlerts(park)
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		if len(alerts.Data) != 1 || alerts.Data[0].Attribute.InformedEntity[0].Facility != "804" {
+			t.Errorf("expected the elevator alert to be decoded, got %+v", alerts)
+		}
+	})
+
+	t.Run("happy path - schedules", func(t *testing.T) {
+		api := replay_api(nil)
+		red := Route{ID: "Red"}
+
+		schedules, err := api.GetSchedules(red)
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		expected := map[[2]string]float64{
+			{"place-alfcl", "place-davis"}: 3,
+			{"place-davis", "place-pktrm"}: 14,
+		}
+		found := build_travel_times(map[Route]ScheduleWrapper{red: schedules})
+		if !reflect.DeepEqual(expected, found.Segments) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Segments)
+		}
+	})
+
+	t.Run("sad path - rate limited", func(t *testing.T) {
+		metrics := new_mbta_metrics_registry()
+
+		_, err := replay_api(metrics).GetShapes(Route{ID: "Red"})
+		if err != ErrWebFailure {
+			t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+		}
+		out := &bytes.Buffer{}
+		metrics.write_text(out)
+		for _, expected := range []string{`mbta_api_requests_total{endpoint="shapes",code="429"} 1`, `mbta_api_ratelimit_remaining 0`} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q to contain %q", out.String(), expected)
+			}
+		}
+	})
+
+	t.Run("sad path - nothing recorded", func(t *testing.T) {
+		_, err := replay_api(nil).GetFacilities()
+		if !errors.Is(err, ErrNoFixture) {
+			t.Errorf("expected error %s to be %s", err, ErrNoFixture)
+		}
+	})
+}
+
+func Test_RecordingTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-remaining", "7")
+		if r.URL.Path == "/stops" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "not found")
+			return
+		}
+		io.WriteString(w, `{"data": [{"id": "Red", "attributes": {"long_name": "Red Line", "sort_order": 10010}}]}`)
+	}))
+	defer upstream.Close()
+	dir := t.TempDir()
+
+	t.Run("happy path - recorded and replayed", func(t *testing.T) {
+		recorder := ConcreteMBTAWebServer{Client: &http.Client{Transport: RecordingTransport{Dir: dir}}}
+		recorded := RouteWrapper{}
+		if err := recorder.get_json(upstream.URL+"/routes?filter[type]=0,1", &recorded); err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "routes-filter-type-0-1.json")); err != nil {
+			t.Errorf("expected the fixture to be saved: %s", err)
+		}
+
+		// Replaying doesn't depend on the host, so it works with the server gone.
+		replayer := ConcreteMBTAWebServer{Client: &http.Client{Transport: ReplayTransport{Dir: dir}}}
+		replayed := RouteWrapper{}
+		if err := replayer.get_json("https://api-v3.mbta.com/routes?filter[type]=0,1", &replayed); err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		if !reflect.DeepEqual(recorded, replayed) || replayed.Data[0].Attribute.SortOrder != 10010 {
+			t.Errorf("expected %+v to be equal to %+v", recorded, replayed)
+		}
+	})
+
+	t.Run("happy path - errors are recorded too", func(t *testing.T) {
+		recorder := ConcreteMBTAWebServer{Client: &http.Client{Transport: RecordingTransport{Dir: dir}}}
+		if err := recorder.get_json(upstream.URL+"/stops?filter[route]=Purple", &StopWrapper{}); err != ErrWebFailure {
+			t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+		}
+
+		fixture, err := load_fixture(filepath.Join(dir, "stops-filter-route-Purple.json"))
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+		if fixture.Status != http.StatusNotFound || fixture.Body != "not found" || fixture.Header.Get("x-ratelimit-remaining") != "7" {
+			t.Errorf("expected the 404 to be recorded, got %+v", fixture)
+		}
+
+		replayer := ConcreteMBTAWebServer{Client: &http.Client{Transport: ReplayTransport{Dir: dir}}}
+		if err := replayer.get_json("https://api-v3.mbta.com/stops?filter[route]=Purple", &StopWrapper{}); err != ErrWebFailure {
+			t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+		}
+	})
+
+	t.Run("sad path - upstream unreachable", func(t *testing.T) {
+		recorder := ConcreteMBTAWebServer{Client: &http.Client{Transport: RecordingTransport{Dir: dir}}}
+		if err := recorder.get_json("http://127.0.0.1:0/alerts", &AlertWrapper{}); err == nil {
+			t.Error("expected an error for an unreachable server")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "alerts.json")); !os.IsNotExist(err) {
+			t.Error("expected nothing to be recorded")
+		}
+	})
+}
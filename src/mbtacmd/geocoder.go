@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoAddress     = errors.New("could not find address")
+	ErrBadAddressRow = errors.New("expected address rows as address,latitude,longitude")
+)
+
+// Geocoder turns an address into a coordinate, so a trip can start or end somewhere other than a stop.
+type Geocoder interface {
+	Geocode(address string) (Coordinate, error)
+}
+
+// FileGeocoder looks addresses up in a list we loaded from a file, which is enough for the handful of
+// places someone travels between regularly and needs no network access or API key. Anything smarter
+// (a geocoding web service, say) only needs to implement Geocoder too.
+type FileGeocoder struct {
+	Addresses map[string]Coordinate
+}
+
+func (g FileGeocoder) Geocode(address string) (Coordinate, error) {
+	coordinate, ok := g.Addresses[normalize_address(address)]
+	if !ok {
+		return Coordinate{}, ErrNoAddress
+	}
+	return coordinate, nil
+}
+
+// normalize_address makes lookups ignore case and spacing, since nobody types an address the same way twice.
+func normalize_address(address string) string {
+	return strings.ToLower(strings.Join(strings.Fields(address), " "))
+}
+
+// read_file_geocoder reads CSV rows of address,latitude,longitude, skipping lines starting with #.
+// Addresses with commas in them need quotes, as usual for CSV.
+func read_file_geocoder(in io.Reader) (FileGeocoder, error) {
+	reader := csv.NewReader(in)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	geocoder := FileGeocoder{Addresses: map[string]Coordinate{}}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return geocoder, nil
+		}
+		if err != nil {
+			return FileGeocoder{}, ErrBadAddressRow
+		}
+
+		latitude, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			return FileGeocoder{}, ErrBadAddressRow
+		}
+		longitude, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return FileGeocoder{}, ErrBadAddressRow
+		}
+		geocoder.Addresses[normalize_address(row[0])] = Coordinate{Latitude: latitude, Longitude: longitude}
+	}
+}
+
+func load_file_geocoder(path string) (FileGeocoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileGeocoder{}, err
+	}
+	defer file.Close()
+
+	return read_file_geocoder(file)
+}
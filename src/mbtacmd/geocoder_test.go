@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_read_file_geocoder(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		in := strings.NewReader(`# address,latitude,longitude
+1 City Hall Square,42.3603,-71.0580
+"24 Beacon St, Boston", 42.3581, -71.0636
+`)
+
+		geocoder, err := read_file_geocoder(in)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := map[string]Coordinate{
+			"1 city hall square":   {Latitude: 42.3603, Longitude: -71.0580},
+			"24 beacon st, boston": {Latitude: 42.3581, Longitude: -71.0636},
+		}
+		if !reflect.DeepEqual(expected, geocoder.Addresses) {
+			t.Errorf("expected %+v to be equal to %+v", expected, geocoder.Addresses)
+		}
+
+		coordinate, err := geocoder.Geocode("  24 BEACON St,   Boston ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if coordinate != expected["24 beacon st, boston"] {
+			t.Errorf("expected %+v to be equal to %+v", coordinate, expected["24 beacon st, boston"])
+		}
+	})
+
+	t.Run("sad path - unknown address", func(t *testing.T) {
+		_, err := FileGeocoder{Addresses: map[string]Coordinate{}}.Geocode("1 City Hall Square")
+		if err != ErrNoAddress {
+			t.Errorf("expected error %s to be %s", err, ErrNoAddress)
+		}
+	})
+
+	t.Run("sad path - bad rows", func(t *testing.T) {
+		for _, input := range []string{"1 City Hall Square,42.3603\n", "1 City Hall Square,north,west\n"} {
+			_, err := read_file_geocoder(strings.NewReader(input))
+			if err != ErrBadAddressRow {
+				t.Errorf("expected error %s to be %s", err, ErrBadAddressRow)
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var ErrBadPolyline = errors.New("malformed encoded polyline")
+
+type Coordinate struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// decode_polyline decodes Google's encoded polyline format, which is what the MBTA API uses for shapes:
+// https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+// Each point is stored as the difference from the one before it, in units of 1e-5 degrees, with each
+// number written five bits at a time as printable characters.
+func decode_polyline(encoded string) ([]Coordinate, error) {
+	coordinates := []Coordinate{}
+	latitude, longitude := 0, 0
+
+	for i := 0; i < len(encoded); {
+		deltas := [2]int{}
+		for j := range deltas {
+			result, shift := 0, 0
+			for {
+				if i >= len(encoded) {
+					return nil, ErrBadPolyline
+				}
+				b := int(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, ErrBadPolyline
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+
+		latitude += deltas[0]
+		longitude += deltas[1]
+		coordinates = append(coordinates, Coordinate{
+			Latitude:  float64(latitude) / 1e5,
+			Longitude: float64(longitude) / 1e5,
+		})
+	}
+
+	return coordinates, nil
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type string `json:"type"`
+	// Coordinates are [longitude, latitude] pairs, longitude first as GeoJSON requires.
+	Coordinates interface{} `json:"coordinates"`
+}
+
+func geojson_position(coordinate Coordinate) []float64 {
+	return []float64{coordinate.Longitude, coordinate.Latitude}
+}
+
+func stop_coordinate(stop Stop) Coordinate {
+	return Coordinate{Latitude: stop.Attribute.Latitude, Longitude: stop.Attribute.Longitude}
+}
+
+func stop_feature(network Network, stop Stop) GeoJSONFeature {
+	routeNames := []string{}
+	for _, route := range network.StopRoutes[stop] {
+		routeNames = append(routeNames, route.Attribute.LongName)
+	}
+
+	return GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: GeoJSONGeometry{Type: "Point", Coordinates: geojson_position(stop_coordinate(stop))},
+		Properties: map[string]interface{}{
+			"stop_id":  stop.ID,
+			"name":     stop.Attribute.Name,
+			"routes":   routeNames,
+			"transfer": is_transfer_stop(network, stop),
+		},
+	}
+}
+
+// build_geojson has a Point for every stop, followed by a LineString for every shape of every route.
+// A route has a shape for each pattern it runs (each branch and direction, plus some short-turns).
+func build_geojson(network Network, routeShapes map[Route][]Shape) (GeoJSONFeatureCollection, error) {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+
+	for _, stop := range network.Stops {
+		collection.Features = append(collection.Features, stop_feature(network, stop))
+	}
+
+	for _, route := range network.Routes {
+		for _, shape := range routeShapes[route] {
+			coordinates, err := decode_polyline(shape.Attribute.Polyline)
+			if err != nil {
+				return GeoJSONFeatureCollection{}, err
+			}
+			positions := [][]float64{}
+			for _, coordinate := range coordinates {
+				positions = append(positions, geojson_position(coordinate))
+			}
+
+			collection.Features = append(collection.Features, GeoJSONFeature{
+				Type:     "Feature",
+				Geometry: GeoJSONGeometry{Type: "LineString", Coordinates: positions},
+				Properties: map[string]interface{}{
+					"shape_id":   shape.ID,
+					"route_id":   route.ID,
+					"route_name": route.Attribute.LongName,
+					"color":      route_color(route),
+				},
+			})
+		}
+	}
+
+	return collection, nil
+}
+
+func fetch_route_shapes(api MBTAWebServer, network Network) (map[Route][]Shape, error) {
+	routeShapes := map[Route][]Shape{}
+	for _, route := range network.Routes {
+		shapes, err := api.GetShapes(route)
+		if err != nil {
+			return nil, err
+		}
+		routeShapes[route] = shapes.Data
+	}
+	return routeShapes, nil
+}
+
+func write_geojson(w io.Writer, collection GeoJSONFeatureCollection) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(collection)
+}
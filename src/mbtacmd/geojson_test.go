@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_decode_polyline(t *testing.T) {
+	t.Run("happy path - documented example", func(t *testing.T) {
+		expected := []Coordinate{
+			{Latitude: 38.5, Longitude: -120.2},
+			{Latitude: 40.7, Longitude: -120.95},
+			{Latitude: 43.252, Longitude: -126.453},
+		}
+
+		coordinates, err := decode_polyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, coordinates) {
+			t.Errorf("expected %+v to be equal to %+v", expected, coordinates)
+		}
+	})
+
+	t.Run("happy path - empty", func(t *testing.T) {
+		coordinates, err := decode_polyline("")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(coordinates) != 0 {
+			t.Errorf("expected %+v to be empty", coordinates)
+		}
+	})
+
+	t.Run("sad path - truncated", func(t *testing.T) {
+		_, err := decode_polyline("_p~iF~ps|U_ulL")
+		if err != ErrBadPolyline {
+			t.Errorf("expected error %s to be %s", err, ErrBadPolyline)
+		}
+	})
+
+	t.Run("sad path - out of range character", func(t *testing.T) {
+		_, err := decode_polyline("_p~iF ps|U")
+		if err != ErrBadPolyline {
+			t.Errorf("expected error %s to be %s", err, ErrBadPolyline)
+		}
+	})
+}
+
+func Test_build_geojson(t *testing.T) {
+	network := mock_graph_network()
+
+	t.Run("happy path", func(t *testing.T) {
+		routeShapes := map[Route][]Shape{
+			network.Routes[0]: []Shape{{ID: "shape 1", Attribute: ShapeAttribute{Polyline: "_p~iF~ps|U_ulLnnqC"}}},
+		}
+
+		collection, err := build_geojson(network, routeShapes)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		out := &bytes.Buffer{}
+		if err := write_geojson(out, collection); err != nil {
+			t.Error("did not expect an error")
+		}
+
+		decoded := map[string]interface{}{}
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("did not expect an error decoding: %s", err)
+		}
+		features := decoded["features"].([]interface{})
+		if decoded["type"] != "FeatureCollection" || len(features) != 4 {
+			t.Fatalf("expected a collection of 3 stops and 1 shape, got %+v", decoded)
+		}
+
+		expectedStop := map[string]interface{}{
+			"type":     "Feature",
+			"geometry": map[string]interface{}{"type": "Point", "coordinates": []interface{}{-71.14, 42.39}},
+			"properties": map[string]interface{}{
+				"stop_id":  "place-alfcl",
+				"name":     "Alewife",
+				"routes":   []interface{}{"Red Line"},
+				"transfer": false,
+			},
+		}
+		if !reflect.DeepEqual(expectedStop, features[0]) {
+			t.Errorf("expected %+v to be equal to %+v", expectedStop, features[0])
+		}
+
+		expectedShape := map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "LineString",
+				"coordinates": []interface{}{[]interface{}{-120.2, 38.5}, []interface{}{-120.95, 40.7}},
+			},
+			"properties": map[string]interface{}{
+				"shape_id":   "shape 1",
+				"route_id":   "Red",
+				"route_name": "Red Line",
+				"color":      "#DA291C",
+			},
+		}
+		if !reflect.DeepEqual(expectedShape, features[3]) {
+			t.Errorf("expected %+v to be equal to %+v", expectedShape, features[3])
+		}
+	})
+
+	t.Run("sad path - bad polyline", func(t *testing.T) {
+		routeShapes := map[Route][]Shape{
+			network.Routes[1]: []Shape{{ID: "shape 1", Attribute: ShapeAttribute{Polyline: "_p~"}}},
+		}
+
+		_, err := build_geojson(network, routeShapes)
+		if err != ErrBadPolyline {
+			t.Errorf("expected error %s to be %s", err, ErrBadPolyline)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+type GraphEdge struct {
+	From  Stop
+	To    Stop
+	Route Route
+}
+
+// network_edges links each stop to the next one along every branch of every route (see
+// Network.branches), once for each route however many of its branches share the link.
+func network_edges(network Network) []GraphEdge {
+	edges := []GraphEdge{}
+	seen := map[[3]string]struct{}{}
+
+	for _, route := range network.Routes {
+		for _, stops := range network.branches(route) {
+			for i := 1; i < len(stops); i++ {
+				from, to := stops[i-1], stops[i]
+				key := [3]string{route.ID, from.ID, to.ID}
+				if from.ID > to.ID {
+					key = [3]string{route.ID, to.ID, from.ID}
+				}
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				edges = append(edges, GraphEdge{From: from, To: to, Route: route})
+			}
+		}
+	}
+
+	return edges
+}
+
+func route_color(route Route) string {
+	if route.Attribute.Color == "" {
+		return "#000000"
+	}
+	return "#" + route.Attribute.Color
+}
+
+func is_transfer_stop(network Network, stop Stop) bool {
+	return len(network.StopRoutes[stop]) > 1
+}
+
+func write_graph(w io.Writer, network Network, format string) error {
+	switch format {
+	case "dot":
+		return write_dot(w, network)
+	case "graphml":
+		return write_graphml(w, network)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+func write_dot(w io.Writer, network Network) error {
+	lines := []string{
+		"graph mbta {",
+		`  node [shape=circle, style=filled, fillcolor="#FFFFFF", fontsize=10];`,
+	}
+
+	for _, stop := range network.Stops {
+		if is_transfer_stop(network, stop) {
+			lines = append(lines, fmt.Sprintf(`  %s [label=%s, shape=doublecircle, fillcolor="#FFD200", penwidth=2];`, dot_quote(stop.ID), dot_quote(stop.Attribute.Name)))
+		} else {
+			lines = append(lines, fmt.Sprintf(`  %s [label=%s];`, dot_quote(stop.ID), dot_quote(stop.Attribute.Name)))
+		}
+	}
+
+	for _, edge := range network_edges(network) {
+		lines = append(lines, fmt.Sprintf(`  %s -- %s [color=%s, penwidth=3, tooltip=%s];`,
+			dot_quote(edge.From.ID), dot_quote(edge.To.ID), dot_quote(route_color(edge.Route)), dot_quote(edge.Route.Attribute.LongName)))
+	}
+
+	lines = append(lines, "}")
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+func dot_quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+type graphml_document struct {
+	XMLName xml.Name      `xml:"graphml"`
+	XMLNS   string        `xml:"xmlns,attr"`
+	Keys    []graphml_key `xml:"key"`
+	Graph   graphml_graph `xml:"graph"`
+}
+
+type graphml_key struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphml_graph struct {
+	ID          string         `xml:"id,attr"`
+	EdgeDefault string         `xml:"edgedefault,attr"`
+	Nodes       []graphml_node `xml:"node"`
+	Edges       []graphml_edge `xml:"edge"`
+}
+
+type graphml_node struct {
+	ID   string         `xml:"id,attr"`
+	Data []graphml_data `xml:"data"`
+}
+
+type graphml_edge struct {
+	Source string         `xml:"source,attr"`
+	Target string         `xml:"target,attr"`
+	Data   []graphml_data `xml:"data"`
+}
+
+type graphml_data struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func write_graphml(w io.Writer, network Network) error {
+	document := graphml_document{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphml_key{
+			{ID: "name", For: "node", AttrName: "name", AttrType: "string"},
+			{ID: "transfer", For: "node", AttrName: "transfer", AttrType: "boolean"},
+			{ID: "routes", For: "node", AttrName: "routes", AttrType: "string"},
+			{ID: "route", For: "edge", AttrName: "route", AttrType: "string"},
+			{ID: "color", For: "edge", AttrName: "color", AttrType: "string"},
+		},
+		Graph: graphml_graph{
+			ID:          "mbta",
+			EdgeDefault: "undirected",
+			Nodes:       []graphml_node{},
+			Edges:       []graphml_edge{},
+		},
+	}
+
+	for _, stop := range network.Stops {
+		document.Graph.Nodes = append(document.Graph.Nodes, graphml_node{
+			ID: stop.ID,
+			Data: []graphml_data{
+				{Key: "name", Value: stop.Attribute.Name},
+				{Key: "transfer", Value: fmt.Sprint(is_transfer_stop(network, stop))},
+				{Key: "routes", Value: build_route_list_name(network.StopRoutes[stop])},
+			},
+		})
+	}
+
+	for _, edge := range network_edges(network) {
+		document.Graph.Edges = append(document.Graph.Edges, graphml_edge{
+			Source: edge.From.ID,
+			Target: edge.To.ID,
+			Data: []graphml_data{
+				{Key: "route", Value: edge.Route.Attribute.LongName},
+				{Key: "color", Value: route_color(edge.Route)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func mock_graph_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line", Color: "DA291C"}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife", Latitude: 42.39, Longitude: -71.14}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: `Kenmore "Square"`}}
+
+	return Network{
+		Routes: []Route{red, green},
+		Stops:  []Stop{alewife, park, kenmore},
+		RouteStops: map[Route][]Stop{
+			red:   []Stop{alewife, park, alewife},
+			green: []Stop{park, kenmore},
+		},
+		StopRoutes: map[Stop][]Route{
+			alewife: []Route{red},
+			park:    []Route{red, green},
+			kenmore: []Route{green},
+		},
+	}
+}
+
+func Test_network_edges(t *testing.T) {
+	t.Run("happy path - one edge per pair of stops", func(t *testing.T) {
+		network := mock_graph_network()
+
+		expected := []GraphEdge{
+			{From: network.Stops[0], To: network.Stops[1], Route: network.Routes[0]},
+			{From: network.Stops[1], To: network.Stops[2], Route: network.Routes[1]},
+		}
+
+		edges := network_edges(network)
+		if !reflect.DeepEqual(expected, edges) {
+			t.Errorf("expected %+v to be equal to %+v", expected, edges)
+		}
+	})
+
+	t.Run("happy path - along each branch", func(t *testing.T) {
+		// JFK/UMass links to both Savin Hill and North Quincy, and Ashmont to neither of them.
+		network := mock_branching_network()
+		red := network.Routes[0]
+		alewife, jfk, savin, ashmont, quincy, braintree := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3], network.Stops[4], network.Stops[5]
+
+		expected := []GraphEdge{
+			{From: alewife, To: jfk, Route: red},
+			{From: jfk, To: quincy, Route: red},
+			{From: quincy, To: braintree, Route: red},
+			{From: jfk, To: savin, Route: red},
+			{From: savin, To: ashmont, Route: red},
+		}
+
+		edges := network_edges(network)
+		if !reflect.DeepEqual(expected, edges) {
+			t.Errorf("expected %+v to be equal to %+v", expected, edges)
+		}
+	})
+}
+
+func Test_write_graph(t *testing.T) {
+	network := mock_graph_network()
+
+	t.Run("happy path - dot", func(t *testing.T) {
+		expected := `graph mbta {
+  node [shape=circle, style=filled, fillcolor="#FFFFFF", fontsize=10];
+  "place-alfcl" [label="Alewife"];
+  "place-pktrm" [label="Park Street", shape=doublecircle, fillcolor="#FFD200", penwidth=2];
+  "place-kencl" [label="Kenmore \"Square\""];
+  "place-alfcl" -- "place-pktrm" [color="#DA291C", penwidth=3, tooltip="Red Line"];
+  "place-pktrm" -- "place-kencl" [color="#000000", penwidth=3, tooltip="Green Line B"];
+}
+`
+
+		out := &bytes.Buffer{}
+		if err := write_graph(out, network, "dot"); err != nil {
+			t.Error("did not expect an error")
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - graphml", func(t *testing.T) {
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="name" for="node" attr.name="name" attr.type="string"></key>
+  <key id="transfer" for="node" attr.name="transfer" attr.type="boolean"></key>
+  <key id="routes" for="node" attr.name="routes" attr.type="string"></key>
+  <key id="route" for="edge" attr.name="route" attr.type="string"></key>
+  <key id="color" for="edge" attr.name="color" attr.type="string"></key>
+  <graph id="mbta" edgedefault="undirected">
+    <node id="place-alfcl">
+      <data key="name">Alewife</data>
+      <data key="transfer">false</data>
+      <data key="routes">Red Line</data>
+    </node>
+    <node id="place-pktrm">
+      <data key="name">Park Street</data>
+      <data key="transfer">true</data>
+      <data key="routes">Red Line, Green Line B</data>
+    </node>
+    <node id="place-kencl">
+      <data key="name">Kenmore &#34;Square&#34;</data>
+      <data key="transfer">false</data>
+      <data key="routes">Green Line B</data>
+    </node>
+    <edge source="place-alfcl" target="place-pktrm">
+      <data key="route">Red Line</data>
+      <data key="color">#DA291C</data>
+    </edge>
+    <edge source="place-pktrm" target="place-kencl">
+      <data key="route">Green Line B</data>
+      <data key="color">#000000</data>
+    </edge>
+  </graph>
+</graphml>
+`
+
+		out := &bytes.Buffer{}
+		if err := write_graph(out, network, "graphml"); err != nil {
+			t.Error("did not expect an error")
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - unknown format", func(t *testing.T) {
+		err := write_graph(&bytes.Buffer{}, network, "png")
+		if err != ErrUnknownFormat {
+			t.Errorf("expected error %s to be %s", err, ErrUnknownFormat)
+		}
+	})
+}
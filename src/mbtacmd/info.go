@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type RouteDirection struct {
+	ID          int
+	Name        string
+	Destination string
+}
+
+// RouteInfo is everything we know about one route, for "route info".
+type RouteInfo struct {
+	Route      Route
+	Directions []RouteDirection
+	// Branches are the runs of stops the route's trips make, in the direction 0 order, longest first.
+	Branches [][]Stop
+	// Stops are every stop on the route, in the order the API lists them.
+	Stops []Stop
+}
+
+func route_directions(route Route) []RouteDirection {
+	directions := []RouteDirection{}
+	for id := range route.Attribute.DirectionNames {
+		name, destination := route.Attribute.DirectionNames[id], route.Attribute.DirectionDestinations[id]
+		if name != "" || destination != "" {
+			directions = append(directions, RouteDirection{ID: id, Name: name, Destination: destination})
+		}
+	}
+	return directions
+}
+
+// contains_run is whether run is somewhere in stations, in order and without gaps.
+func contains_run(stations []string, run []string) bool {
+	for start := 0; start+len(run) <= len(stations); start++ {
+		matched := true
+		for i, station := range run {
+			if stations[start+i] != station {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// route_branches finds the different runs of stations the scheduled trips in direction 0 make, leaving out
+// the short-turns that only run part of the way along another. The API lists a branching route's stops one
+// branch after the other (see network_edges), so without schedules the best we can do is one branch of
+// every stop.
+func route_branches(network Network, route Route, schedules ScheduleWrapper) [][]Stop {
+	stops := map[string]Stop{}
+	for _, stop := range network.RouteStops[route] {
+		stops[stop.ID] = stop
+	}
+
+	patterns := [][]string{}
+	seen := map[string]bool{}
+	for _, stopTimes := range schedule_trips(schedules) {
+		if len(stopTimes) == 0 || stopTimes[0].direction != 0 {
+			continue
+		}
+		stations := []string{}
+		for _, stopTime := range stopTimes {
+			if _, ok := stops[stopTime.station]; ok {
+				stations = append(stations, stopTime.station)
+			}
+		}
+		key := strings.Join(stations, ",")
+		if len(stations) > 1 && !seen[key] {
+			seen[key] = true
+			patterns = append(patterns, stations)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return strings.Join(patterns[i], ",") < strings.Join(patterns[j], ",")
+	})
+
+	branches := [][]Stop{}
+	kept := [][]string{}
+	for _, pattern := range patterns {
+		shortTurn := false
+		for _, longer := range kept {
+			if contains_run(longer, pattern) {
+				shortTurn = true
+				break
+			}
+		}
+		if shortTurn {
+			continue
+		}
+		kept = append(kept, pattern)
+		branch := []Stop{}
+		for _, station := range pattern {
+			branch = append(branch, stops[station])
+		}
+		branches = append(branches, branch)
+	}
+
+	if len(branches) == 0 && len(network.RouteStops[route]) > 0 {
+		branches = append(branches, network.RouteStops[route])
+	}
+	return branches
+}
+
+func build_route_info(network Network, route Route, schedules ScheduleWrapper) RouteInfo {
+	return RouteInfo{
+		Route:      route,
+		Directions: route_directions(route),
+		Branches:   route_branches(network, route, schedules),
+		Stops:      network.RouteStops[route],
+	}
+}
+
+// fetch_route_info uses the schedules the network was built with, when it has them.
+func fetch_route_info(api MBTAWebServer, network Network, name string) (RouteInfo, error) {
+	route, ok := network.find_route_by_name(name)
+	if !ok {
+		return RouteInfo{}, ErrNoRoute
+	}
+	schedules, err := route_schedules(api, network, route)
+	if err != nil {
+		return RouteInfo{}, err
+	}
+	return build_route_info(network, route, schedules), nil
+}
+
+func print_route_info(out io.Writer, info RouteInfo) {
+	fmt.Fprintf(out, "%s (%s)\n", info.Route.Attribute.LongName, info.Route.ID)
+	fmt.Fprintf(out, "Type: %s\n", mode_description(info.Route.Attribute.Type))
+	if info.Route.Attribute.Description != "" {
+		fmt.Fprintf(out, "Description: %s\n", info.Route.Attribute.Description)
+	}
+	if info.Route.Attribute.TextColor != "" {
+		fmt.Fprintf(out, "Color: %s (text #%s)\n", route_color(info.Route), info.Route.Attribute.TextColor)
+	} else {
+		fmt.Fprintf(out, "Color: %s\n", route_color(info.Route))
+	}
+	for _, direction := range info.Directions {
+		fmt.Fprintf(out, "Direction %d: %s toward %s\n", direction.ID, direction.Name, direction.Destination)
+	}
+	fmt.Fprintf(out, "Stops: %d\n", len(info.Stops))
+	for _, branch := range info.Branches {
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "%s to %s (%d stops):\n", branch[0].Attribute.Name, branch[len(branch)-1].Attribute.Name, len(branch))
+		for _, stop := range branch {
+			fmt.Fprintf(out, "  %s\n", stop.Attribute.Name)
+		}
+	}
+}
+
+// StopPlatform is one of the platforms at a station, with the routes the schedules say stop there.
+type StopPlatform struct {
+	ID     string
+	Name   string
+	Routes []Route
+}
+
+// StopInfo is everything we know about one stop, for "stop info".
+type StopInfo struct {
+	Stop          Stop
+	Routes        []Route
+	Platforms     []StopPlatform
+	Accessibility string
+	Departures    []DepartureGroup
+}
+
+// stop_platforms are the platforms of stop that the schedules of its routes stop at, in the order the
+// routes and their schedules list them.
+func stop_platforms(stop Stop, routeSchedules []ScheduleWrapper, routes []Route) []StopPlatform {
+	platforms := []StopPlatform{}
+	index := map[string]int{}
+	for i, schedules := range routeSchedules {
+		for _, platform := range schedules.Included {
+			if platform.Relationships.ParentStation.Data.ID != stop.ID {
+				continue
+			}
+			at, ok := index[platform.ID]
+			if !ok {
+				at = len(platforms)
+				index[platform.ID] = at
+				platforms = append(platforms, StopPlatform{ID: platform.ID, Name: platform.Attribute.PlatformName, Routes: []Route{}})
+			}
+			serving := platforms[at].Routes
+			if len(serving) == 0 || serving[len(serving)-1] != routes[i] {
+				platforms[at].Routes = append(serving, routes[i])
+			}
+		}
+	}
+	return platforms
+}
+
+// stop_accessibility_description says whether a wheelchair can get through the stop, and how many of its
+// elevators are working.
+func stop_accessibility_description(accessibility Accessibility, stop Stop) string {
+	if problem := accessibility.stop_problem(stop); problem != "" {
+		return problem
+	}
+	elevators, outages := 0, 0
+	for _, facility := range accessibility.Facilities[stop.ID] {
+		if facility.Attribute.Type != "ELEVATOR" {
+			continue
+		}
+		elevators++
+		if _, ok := accessibility.Outages[facility.ID]; ok {
+			outages++
+		}
+	}
+	if elevators == 0 {
+		return "wheelchair accessible"
+	}
+	return fmt.Sprintf("wheelchair accessible, %d of %d elevators working", elevators-outages, elevators)
+}
+
+// fetch_stop_info costs a request for the stop's predictions and two for the elevators and their outages,
+// on top of the schedules of each route serving the stop when the network wasn't built with them.
+func fetch_stop_info(api MBTAWebServer, network Network, name string, now time.Time) (StopInfo, error) {
+	stop, ok := network.find_stop_by_name(name)
+	if !ok {
+		return StopInfo{}, ErrNoStop
+	}
+	routes := network.StopRoutes[stop]
+
+	routeSchedules := []ScheduleWrapper{}
+	for _, route := range routes {
+		schedules, err := route_schedules(api, network, route)
+		if err != nil {
+			return StopInfo{}, err
+		}
+		routeSchedules = append(routeSchedules, schedules)
+	}
+	accessibility, err := fetch_accessibility(api)
+	if err != nil {
+		return StopInfo{}, err
+	}
+	predictions, err := api.GetPredictions(stop)
+	if err != nil {
+		return StopInfo{}, err
+	}
+
+	return StopInfo{
+		Stop:          stop,
+		Routes:        routes,
+		Platforms:     stop_platforms(stop, routeSchedules, routes),
+		Accessibility: stop_accessibility_description(accessibility, stop),
+		Departures:    group_departures(network, predictions.Data, now, 3),
+	}, nil
+}
+
+func print_stop_info(out io.Writer, info StopInfo) {
+	fmt.Fprintf(out, "%s (%s)\n", info.Stop.Attribute.Name, info.Stop.ID)
+	fmt.Fprintf(out, "Routes: %s\n", build_route_list_name(info.Routes))
+	if has_coordinates(info.Stop) {
+		fmt.Fprintf(out, "Coordinates: %.6f, %.6f\n", info.Stop.Attribute.Latitude, info.Stop.Attribute.Longitude)
+	}
+	fmt.Fprintf(out, "Accessibility: %s\n", info.Accessibility)
+
+	if len(info.Platforms) > 0 {
+		fmt.Fprintln(out, "Platforms:")
+		for _, platform := range info.Platforms {
+			if platform.Name == "" {
+				fmt.Fprintf(out, "  %s (%s)\n", platform.ID, build_route_list_name(platform.Routes))
+			} else {
+				fmt.Fprintf(out, "  %s: %s (%s)\n", platform.ID, platform.Name, build_route_list_name(platform.Routes))
+			}
+		}
+	}
+
+	if len(info.Departures) == 0 {
+		fmt.Fprintln(out, "No upcoming departures")
+		return
+	}
+	fmt.Fprintln(out, "Next departures:")
+	for _, group := range info.Departures {
+		fmt.Fprintf(out, "  %s: %s\n", group.Label, strings.Join(group.Times, ", "))
+	}
+}
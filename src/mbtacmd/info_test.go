@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mock_branching_network is the Red Line splitting at JFK/UMass for Ashmont and Braintree, listed one
+// branch after the other as the API does.
+func mock_branching_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{
+		LongName:              "Red Line",
+		Color:                 "DA291C",
+		Type:                  1,
+		DirectionNames:        [2]string{"South", "North"},
+		DirectionDestinations: [2]string{"Ashmont/Braintree", "Alewife"},
+	}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	jfk := Stop{ID: "place-jfk", Attribute: StopAttribute{Name: "JFK/UMass", Latitude: 42.320685, Longitude: -71.052391, WheelchairBoarding: wheelchairAccessible}}
+	savin := Stop{ID: "place-shmnl", Attribute: StopAttribute{Name: "Savin Hill"}}
+	ashmont := Stop{ID: "place-asmnl", Attribute: StopAttribute{Name: "Ashmont"}}
+	quincy := Stop{ID: "place-nqncy", Attribute: StopAttribute{Name: "North Quincy"}}
+	braintree := Stop{ID: "place-brntn", Attribute: StopAttribute{Name: "Braintree"}}
+
+	stops := []Stop{alewife, jfk, savin, ashmont, quincy, braintree}
+	stopRoutes := map[Stop][]Route{}
+	for _, stop := range stops {
+		stopRoutes[stop] = []Route{red}
+	}
+	network := Network{
+		Routes:     []Route{red},
+		Stops:      stops,
+		RouteStops: map[Route][]Stop{red: stops},
+		StopRoutes: stopRoutes,
+		Schedules:  map[Route]ScheduleWrapper{red: mock_branching_schedules()},
+	}
+	// As build_network does: Braintree's branch comes first, then Ashmont's.
+	network.Branches = map[Route][][]Stop{red: route_branches(network, red, network.Schedules[red])}
+	return network
+}
+
+func mock_trip(trip string, direction int, platforms ...string) []Schedule {
+	schedules := []Schedule{}
+	for i, platform := range platforms {
+		schedule := mock_schedule(trip, platform, i+1, "", "2020-01-01T08:00:00-05:00")
+		schedule.Attribute.DirectionID = direction
+		schedules = append(schedules, schedule)
+	}
+	return schedules
+}
+
+// mock_branching_schedules run a trip down each branch, one that turns back at JFK/UMass and one going north.
+func mock_branching_schedules() ScheduleWrapper {
+	schedules := ScheduleWrapper{Data: []Schedule{}}
+	schedules.Data = append(schedules.Data, mock_trip("ashmont", 0, "place-alfcl", "70085", "place-shmnl", "place-asmnl")...)
+	schedules.Data = append(schedules.Data, mock_trip("braintree", 0, "place-alfcl", "70095", "place-nqncy", "place-brntn")...)
+	schedules.Data = append(schedules.Data, mock_trip("short", 0, "place-alfcl", "70085")...)
+	schedules.Data = append(schedules.Data, mock_trip("north", 1, "place-asmnl", "place-shmnl", "70086", "place-alfcl")...)
+	for _, platform := range []ScheduleStop{
+		{ID: "70085", Attribute: ScheduleStopAttribute{PlatformName: "Ashmont"}},
+		{ID: "70095", Attribute: ScheduleStopAttribute{PlatformName: "Braintree"}},
+		{ID: "70086", Attribute: ScheduleStopAttribute{PlatformName: "Alewife"}},
+	} {
+		platform.Relationships.ParentStation.Data.ID = "place-jfk"
+		schedules.Included = append(schedules.Included, platform)
+	}
+	return schedules
+}
+
+func Test_route_info(t *testing.T) {
+	network := mock_branching_network()
+	red := network.Routes[0]
+	stops := network.Stops
+
+	t.Run("happy path - a branch for each pattern", func(t *testing.T) {
+		expected := [][]Stop{
+			{stops[0], stops[1], stops[4], stops[5]},
+			{stops[0], stops[1], stops[2], stops[3]},
+		}
+
+		found := route_branches(network, red, mock_branching_schedules())
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - no schedules", func(t *testing.T) {
+		expected := [][]Stop{stops}
+
+		found := route_branches(network, red, ScheduleWrapper{})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		mockAPI := &MockMBTAWebServer{ReturnScheduleWrapper: map[string]ScheduleWrapper{"Red": mock_branching_schedules()}}
+
+		info, err := fetch_route_info(mockAPI, network, "Red Line")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `Red Line (Red)
+Type: heavy rail
+Color: #DA291C
+Direction 0: South toward Ashmont/Braintree
+Direction 1: North toward Alewife
+Stops: 6
+
+Alewife to Braintree (4 stops):
+  Alewife
+  JFK/UMass
+  North Quincy
+  Braintree
+
+Alewife to Ashmont (4 stops):
+  Alewife
+  JFK/UMass
+  Savin Hill
+  Ashmont
+`
+		out := &bytes.Buffer{}
+		print_route_info(out, info)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - unknown route", func(t *testing.T) {
+		_, err := fetch_route_info(&MockMBTAWebServer{}, network, "Purple Line")
+		if err != ErrNoRoute {
+			t.Errorf("expected error %s to be %s", err, ErrNoRoute)
+		}
+	})
+
+	t.Run("sad path - schedules fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		withoutSchedules := mock_branching_network()
+		withoutSchedules.Schedules = nil
+
+		_, err := fetch_route_info(&MockMBTAWebServer{ReturnScheduleWrapperError: myErr}, withoutSchedules, "Red Line")
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+}
+
+func Test_stop_info(t *testing.T) {
+	network := mock_branching_network()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockAPI := &MockMBTAWebServer{
+		ReturnScheduleWrapper: map[string]ScheduleWrapper{"Red": mock_branching_schedules()},
+		ReturnFacilityWrapper: FacilityWrapper{Data: []Facility{
+			{ID: "901", Attribute: FacilityAttribute{Type: "ELEVATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-jfk"}}}},
+			{ID: "902", Attribute: FacilityAttribute{Type: "ELEVATOR"}, Relationships: FacilityRelationships{Stop: Relationship{Data: RelationshipData{ID: "place-jfk"}}}},
+		}},
+		ReturnAccessibilityAlertWrapper: AlertWrapper{Data: []Alert{
+			{ID: "1", Attribute: AlertAttribute{Effect: "ELEVATOR_CLOSURE", InformedEntity: []AlertEntity{{Stop: "place-jfk", Facility: "901"}}}},
+		}},
+		ReturnPredictionWrapper: map[string]PredictionWrapper{
+			"place-jfk": PredictionWrapper{Data: []Prediction{
+				{
+					Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:04:00Z"},
+					Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+				},
+				{
+					Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:09:00Z"},
+					Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+				},
+			}},
+		},
+	}
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		info, err := fetch_stop_info(mockAPI, network, "JFK/UMass", now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `JFK/UMass (place-jfk)
+Routes: Red Line
+Coordinates: 42.320685, -71.052391
+Accessibility: wheelchair accessible, 1 of 2 elevators working
+Platforms:
+  70085: Ashmont (Red Line)
+  70095: Braintree (Red Line)
+  70086: Alewife (Red Line)
+Next departures:
+  Red Line (direction 0): 4 min, 9 min
+`
+		out := &bytes.Buffer{}
+		print_stop_info(out, info)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - unknown stop", func(t *testing.T) {
+		_, err := fetch_stop_info(mockAPI, network, "Nowhere", now)
+		if err != ErrNoStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoStop)
+		}
+	})
+
+	t.Run("sad path - predictions fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+
+		_, err := fetch_stop_info(&MockMBTAWebServer{ReturnPredictionWrapperError: myErr}, network, "JFK/UMass", now)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+}
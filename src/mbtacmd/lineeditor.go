@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrInterrupted = errors.New("interrupted")
+
+// LineEditor reads lines with emacs-style editing, history and tab completion when attached to a
+// terminal, and falls back to reading plain lines when it is not (e.g. when input is piped in).
+type LineEditor struct {
+	History []string
+	// Complete is given the line up to the cursor, and returns where in that line the word being
+	// completed starts along with every candidate that could replace it.
+	Complete func(line string) (int, []string)
+
+	in       *bufio.Reader
+	out      io.Writer
+	fd       uintptr
+	terminal bool
+}
+
+func new_line_editor(in io.Reader, out io.Writer) *LineEditor {
+	editor := &LineEditor{
+		History: []string{},
+		in:      bufio.NewReader(in),
+		out:     out,
+	}
+	if file, ok := in.(*os.File); ok && is_terminal(file.Fd()) {
+		editor.fd = file.Fd()
+		editor.terminal = true
+	}
+	return editor
+}
+
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if !e.terminal {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		e.add_history(line)
+		return line, nil
+	}
+
+	restore, err := make_raw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	line, err := e.edit(prompt)
+	if err != nil {
+		return "", err
+	}
+	e.add_history(line)
+	return line, nil
+}
+
+func (e *LineEditor) add_history(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.History) > 0 && e.History[len(e.History)-1] == line {
+		return
+	}
+	e.History = append(e.History, line)
+}
+
+func (e *LineEditor) edit(prompt string) (string, error) {
+	buf := []rune{}
+	cursor := 0
+	historyIndex := len(e.History)
+	pending := []rune{}
+
+	e.refresh(prompt, buf, cursor)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(buf) {
+				buf = append(buf[:cursor], buf[cursor+1:]...)
+			}
+		case 127, 8: // Backspace
+			if cursor > 0 {
+				buf = append(buf[:cursor-1], buf[cursor:]...)
+				cursor--
+			}
+		case 1: // Ctrl-A
+			cursor = 0
+		case 5: // Ctrl-E
+			cursor = len(buf)
+		case 11: // Ctrl-K
+			buf = buf[:cursor]
+		case 21: // Ctrl-U
+			buf = append([]rune{}, buf[cursor:]...)
+			cursor = 0
+		case '\t':
+			buf, cursor = e.complete(buf, cursor)
+		case 27: // Escape sequences for the arrow, home, end and delete keys
+			key, err := e.read_escape_sequence()
+			if err != nil {
+				return "", err
+			}
+			switch key {
+			case 'A':
+				if historyIndex > 0 {
+					if historyIndex == len(e.History) {
+						pending = buf
+					}
+					historyIndex--
+					buf = []rune(e.History[historyIndex])
+					cursor = len(buf)
+				}
+			case 'B':
+				if historyIndex < len(e.History) {
+					historyIndex++
+					if historyIndex == len(e.History) {
+						buf = pending
+					} else {
+						buf = []rune(e.History[historyIndex])
+					}
+					cursor = len(buf)
+				}
+			case 'C':
+				if cursor < len(buf) {
+					cursor++
+				}
+			case 'D':
+				if cursor > 0 {
+					cursor--
+				}
+			case 'H':
+				cursor = 0
+			case 'F':
+				cursor = len(buf)
+			case '~':
+				if cursor < len(buf) {
+					buf = append(buf[:cursor], buf[cursor+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:cursor], append([]rune{r}, buf[cursor:]...)...)
+				cursor++
+			}
+		}
+
+		e.refresh(prompt, buf, cursor)
+	}
+}
+
+// read_escape_sequence reads the rest of an "ESC [ X" or "ESC O X" sequence and returns X.
+// The "ESC [ 3 ~" form used by the delete key is reported as '~'; the other numbered keys
+// that share that form are reported the same way and are simply ignored by the caller.
+func (e *LineEditor) read_escape_sequence() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return 0, nil
+	}
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r < '0' || r > '9' {
+			return r, nil
+		}
+	}
+}
+
+func (e *LineEditor) complete(buf []rune, cursor int) ([]rune, int) {
+	if e.Complete == nil {
+		return buf, cursor
+	}
+
+	line := string(buf[:cursor])
+	start, candidates := e.Complete(line)
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return buf, cursor
+	}
+
+	replacement := common_prefix(candidates)
+	word := line[start:]
+	if len(candidates) > 1 && len(replacement) <= len(word) {
+		fmt.Fprint(e.out, "\r\n")
+		for _, candidate := range candidates {
+			fmt.Fprintf(e.out, "%s\r\n", candidate)
+		}
+		return buf, cursor
+	}
+
+	completed := []rune(line[:start] + replacement)
+	return append(completed, buf[cursor:]...), len(completed)
+}
+
+func (e *LineEditor) refresh(prompt string, buf []rune, cursor int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+	if cursor < len(buf) {
+		fmt.Fprintf(e.out, "\x1b[%dD", len(buf)-cursor)
+	}
+}
+
+func common_prefix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return string(prefix)
+}
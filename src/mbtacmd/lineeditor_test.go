@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mock_line_editor(input string) *LineEditor {
+	return &LineEditor{
+		History: []string{},
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     &bytes.Buffer{},
+	}
+}
+
+func Test_LineEditor_edit(t *testing.T) {
+	t.Run("happy path - cursor movement and backspace", func(t *testing.T) {
+		editor := mock_line_editor("helo\x1b[D\x1b[Dl\x1b[Fx\x7f!\r")
+
+		line, err := editor.edit("> ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if line != "hello!" {
+			t.Errorf("expected %q to be equal to %q", line, "hello!")
+		}
+	})
+
+	t.Run("happy path - history", func(t *testing.T) {
+		editor := mock_line_editor("new\x1b[A\x1b[A\x1b[B\r")
+		editor.History = []string{"first", "second"}
+
+		line, err := editor.edit("> ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if line != "second" {
+			t.Errorf("expected %q to be equal to %q", line, "second")
+		}
+	})
+
+	t.Run("happy path - history back to the pending line", func(t *testing.T) {
+		editor := mock_line_editor("new\x1b[A\x1b[B\r")
+		editor.History = []string{"first"}
+
+		line, err := editor.edit("> ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if line != "new" {
+			t.Errorf("expected %q to be equal to %q", line, "new")
+		}
+	})
+
+	t.Run("happy path - tab completion", func(t *testing.T) {
+		editor := mock_line_editor("go pa\t\r")
+		editor.Complete = func(line string) (int, []string) {
+			return 3, []string{`"Park Street" `}
+		}
+
+		line, err := editor.edit("> ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if line != `go "Park Street" ` {
+			t.Errorf("expected %q to be equal to %q", line, `go "Park Street" `)
+		}
+	})
+
+	t.Run("happy path - tab completion to a common prefix", func(t *testing.T) {
+		editor := mock_line_editor("r\t\t\r")
+		editor.Complete = func(line string) (int, []string) {
+			return 0, []string{"route ", "routes "}
+		}
+
+		line, err := editor.edit("> ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if line != "route" {
+			t.Errorf("expected %q to be equal to %q", line, "route")
+		}
+		if !strings.Contains(editor.out.(*bytes.Buffer).String(), "route \r\nroutes \r\n") {
+			t.Error("expected the second tab to list the candidates")
+		}
+	})
+
+	t.Run("sad path - interrupted", func(t *testing.T) {
+		editor := mock_line_editor("abc\x03")
+
+		_, err := editor.edit("> ")
+		if err != ErrInterrupted {
+			t.Errorf("expected error %s to be %s", err, ErrInterrupted)
+		}
+	})
+
+	t.Run("sad path - end of input", func(t *testing.T) {
+		editor := mock_line_editor("\x04")
+
+		_, err := editor.edit("> ")
+		if err != io.EOF {
+			t.Errorf("expected error %s to be %s", err, io.EOF)
+		}
+	})
+}
+
+func Test_LineEditor_ReadLine(t *testing.T) {
+	t.Run("happy path - not a terminal", func(t *testing.T) {
+		editor := new_line_editor(strings.NewReader("first\nfirst\n\nsecond"), &bytes.Buffer{})
+
+		lines := []string{}
+		for {
+			line, err := editor.ReadLine("> ")
+			if err == io.EOF {
+				break
+			}
+			lines = append(lines, line)
+		}
+
+		expectedLines := []string{"first", "first", "", "second"}
+		if !reflect.DeepEqual(expectedLines, lines) {
+			t.Errorf("expected %q to be equal to %q", expectedLines, lines)
+		}
+		expectedHistory := []string{"first", "second"}
+		if !reflect.DeepEqual(expectedHistory, editor.History) {
+			t.Errorf("expected %q to be equal to %q", expectedHistory, editor.History)
+		}
+	})
+}
+
+func Test_common_prefix(t *testing.T) {
+	result := common_prefix([]string{"route ", "routes ", "roué"})
+	if result != "rou" {
+		t.Errorf("expected %q to be equal to %q", result, "rou")
+	}
+}
@@ -4,51 +4,451 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
-	api := ConcreteMBTAWebServer{}
+	snapshotPath := flag.String("snapshot", "", "answer every request from a snapshot file instead of the MBTA API")
+	apiURL := flag.String("api", defaultAPIBaseURL, "the MBTA API to make requests to, e.g. a local fakeapi")
+	recordPath := flag.String("record", "", "save every response from the MBTA API as a fixture file in this directory")
+	maxAccess := flag.Float64("max-access", defaultMaxAccessMeters, "the furthest the planner will walk to the first stop or from the last, in meters")
+	alternatives := flag.Int("alternatives", 1, "how many alternative itineraries to plan, best first")
+	accessible := flag.Bool("accessible", false, "only plan trips through wheelchair accessible stations with working elevators")
+	addressesPath := flag.String("addresses", "", "a CSV file of address,latitude,longitude rows that trips can start or end at")
+	maxWalk := flag.Float64("max-walk", defaultMaxWalkMeters, "the furthest the planner will walk between stops, in meters (0 to never walk)")
+	avoid := flag.String("avoid", "", "a comma separated list of routes the planner should never take")
+	preferHeavyRail := flag.Bool("prefer-heavy-rail", false, "count a ride off the heavy rail as costly as a transfer, and its stops twice")
+	maxTransfers := flag.Int("max-transfers", -1, "the most times the planner may change routes (-1 for any number)")
+	via := flag.String("via", "", "a comma separated list of stops the trip has to pass through, in order")
+	faresPath := flag.String("fares", "", "a directory of GTFS-Fares v2 files to price every trip with")
+	transferPenalty := flag.Float64("transfer-penalty", defaultTransferPenaltyMinutes, "the minutes estimated travel times allow for changing routes, on top of the wait")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	flag.Parse()
 
-	if err := print_light_and_heavy_rail_routes(api); err != nil {
-		panic(err)
+	concrete := ConcreteMBTAWebServer{BaseURL: *apiURL}
+	if *recordPath != "" {
+		concrete.Client = &http.Client{Transport: RecordingTransport{Dir: *recordPath}}
+	}
+	var api MBTAWebServer = concrete
+	if *snapshotPath != "" {
+		snapshot, err := load_snapshot(*snapshotPath)
+		if err != nil {
+			panic(err)
+		}
+		api = SnapshotMBTAWebServer{Snapshot: snapshot}
 	}
 
-	if err := print_stop_data(api); err != nil {
-		panic(err)
+	options := default_plan_options()
+	options.MaxWalkMeters = *maxWalk
+	options.MaxAccessMeters = *maxAccess
+	options.Accessible = *accessible
+	options.Alternatives = *alternatives
+	options.TransferPenaltyMinutes = *transferPenalty
+	options.Preferences = Preferences{AvoidRoutes: split_names(*avoid), PreferHeavyRail: *preferHeavyRail, Via: split_names(*via)}
+	if *maxTransfers >= 0 {
+		options.Preferences.MaxRides = *maxTransfers + 1
+	}
+	if *addressesPath != "" {
+		geocoder, err := load_file_geocoder(*addressesPath)
+		if err != nil {
+			panic(err)
+		}
+		options.Geocoder = geocoder
+	}
+	if *faresPath != "" {
+		fares, err := load_fare_rules(*faresPath)
+		if err != nil {
+			panic(err)
+		}
+		options.Fares = &fares
+	}
+
+	if flag.NArg() > 0 {
+		if err := run_subcommand(api, options, flag.Args()); err != nil {
+			panic(err)
+		}
+		return
 	}
 
-	if err := prompt_for_stops_to_route(api); err != nil {
+	if err := print_reports(api, options, os.Stdin, os.Stdout); err != nil {
 		panic(err)
 	}
 }
 
+// print_reports is what running with no command does: the routes, the stop data and then a trip between
+// the two stops the user types in. The network is built once for both of the last two, and its schedules
+// are only fetched once there is a trip to plan, to stay within the API's anonymous rate limit.
+func print_reports(api MBTAWebServer, options PlanOptions, in io.Reader, out io.Writer) error {
+	if err := print_light_and_heavy_rail_routes(api, out); err != nil {
+		return err
+	}
+
+	network, err := build_route_network(api)
+	if err != nil {
+		return err
+	}
+	if err := print_stop_data(network, out); err != nil {
+		return err
+	}
+
+	return prompt_for_stops_to_route(api, network, options, in, out)
+}
+
+const usage = `Usage:
+  mbtacmd [-snapshot file] [-api url] [-record dir] [-max-walk meters] [-max-access meters]
+          [-addresses file.csv] [-accessible] [-alternatives n] [-avoid routes] [-prefer-heavy-rail]
+          [-max-transfers n] [-via stops] [-transfer-penalty minutes] [-fares dir] [command]
+
+With no command, print the route reports and prompt for two stops to route between.
+
+Commands:
+  repl                                   start an interactive shell over the route network
+  stops near [-n 5] <lat,lon>            list the stops closest to a coordinate
+  stop info <stop>                       show a stop's routes, platforms, accessibility and next departures
+  route info <route>                     show a route's type, color, directions and the stops along each branch
+  reach [-transfers n | -stops n | -minutes n] [-geojson file] <stop>
+                                         list every stop within a budget of a stop, and what it takes to get there
+  board [-refresh 30s] [-once] <stop>    show a live departure board for a stop
+  snapshot save [-live] <file>           save the network (and with -live, departures and alerts) to a file
+  snapshot diff <before> <after>         list the routes, stops and transfer stations that changed between two snapshots
+  serve [-addr :8080] [-cache-ttl 10m]   serve the routes, reports, planner and departures as JSON over HTTP
+  fakeapi [-addr :8081] [-rate-limit 1000] [-fail-every n] [-fail-status 503] <snapshot>
+                                         serve a snapshot as a stand-in for the MBTA API, for use with -api
+  export graph [-format dot|graphml] [-o file]
+                                         write the stop and route network as a graph
+  export geojson [-o file]               write the stops and route shapes as GeoJSON
+  export transfers [-o file]             write the fewest transfers and stops between every pair of stops as CSV
+  render [-layout schematic|geographic] [-routes "Red Line,Blue Line"] <file.svg>
+                                         draw a map of the routes as an SVG image
+  analyze [-modes light,heavy] [-top 10] find the stations and connections that would split the network
+
+The -snapshot option answers every request from a file written by "snapshot save", for working offline.
+The -api option sends every request to another server instead, such as one started with "fakeapi".
+The -record option saves every API response to a fixture file in a directory, for tests to replay.
+The -max-walk option sets how far the planner will suggest walking between nearby stops (default 400).
+Trips can start or end at a stop name, a latitude,longitude pair, or an address listed in the -addresses file,
+walking up to -max-access meters (default 800) to or from the nearest stops.
+The -accessible option only plans trips that a wheelchair can take, and says which stations ruled out quicker ones.
+The -alternatives option plans that many different trips, ranked by transfers, then stops, then estimated time.
+The -avoid option never takes the listed routes (e.g. -avoid "Green Line E"), -prefer-heavy-rail counts a ride
+off the heavy rail as costly as a transfer and its stops twice (so it may change trains to stay on the heavy rail),
+-max-transfers caps the changes between routes, and -via "Kenmore" only plans trips that pass through the listed
+stops in order.
+Planned trips come with travel times estimated from the schedules, allowing -transfer-penalty minutes (default 3)
+to change routes.
+The -fares option prices every trip with the fares in a directory of GTFS-Fares v2 files, e.g. fares/mbta.
+`
+
+func run_subcommand(api MBTAWebServer, options PlanOptions, args []string) error {
+	switch args[0] {
+	case "repl":
+		return run_repl(api, options, os.Stdin, os.Stdout)
+	case "stop", "route":
+		if len(args) != 3 || args[1] != "info" {
+			exit_with_usage()
+		}
+		network, err := build_network(api)
+		if err != nil {
+			return err
+		}
+		if args[0] == "route" {
+			info, err := fetch_route_info(api, network, args[2])
+			if err != nil {
+				return err
+			}
+			print_route_info(os.Stdout, info)
+			return nil
+		}
+		info, err := fetch_stop_info(api, network, args[2], time.Now())
+		if err != nil {
+			return err
+		}
+		print_stop_info(os.Stdout, info)
+	case "stops":
+		if len(args) < 2 || args[1] != "near" {
+			exit_with_usage()
+		}
+		flags := flag.NewFlagSet("stops near", flag.ExitOnError)
+		count := flags.Int("n", 5, "how many stops to list")
+		flags.Parse(args[2:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		point, err := parse_coordinate(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		network, err := build_route_network(api)
+		if err != nil {
+			return err
+		}
+		print_nearby_stops(os.Stdout, network, new_stop_index(network.Stops).Nearest(point, *count))
+	case "reach":
+		flags := flag.NewFlagSet("reach", flag.ExitOnError)
+		values := map[string]*string{}
+		for _, kind := range budgetKinds {
+			values[kind.String()] = flags.String(kind.String(), "", "list the stops within this many "+kind.String())
+		}
+		geojson := flags.String("geojson", "", "also write the reachable stops to this file as GeoJSON")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		limits := map[string]string{}
+		for kind, value := range values {
+			limits[kind] = *value
+		}
+		budget, err := parse_budget(limits)
+		if err != nil {
+			return err
+		}
+		network, err := build_network(api)
+		if err != nil {
+			return err
+		}
+		options, err = with_accessibility(api, options)
+		if err != nil {
+			return err
+		}
+		start, reachable, err := reachable_stops_from_name(network, flags.Arg(0), budget, options)
+		if err != nil {
+			return err
+		}
+		print_reachable_stops(os.Stdout, start, budget, reachable)
+		if *geojson != "" {
+			return write_output(*geojson, func(w io.Writer) error {
+				return write_geojson(w, reachable_geojson(start, reachable))
+			})
+		}
+	case "board":
+		flags := flag.NewFlagSet("board", flag.ExitOnError)
+		refresh := flags.Duration("refresh", 30*time.Second, "how often to fetch new predictions and alerts")
+		once := flags.Bool("once", false, "print the board once instead of running full-screen")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		return run_departure_board(api, flags.Arg(0), *refresh, *once, os.Stdin, os.Stdout)
+	case "snapshot":
+		if len(args) >= 2 && args[1] == "diff" {
+			if len(args) != 4 {
+				exit_with_usage()
+			}
+			return run_snapshot_diff(args[2], args[3])
+		}
+		if len(args) < 2 || args[1] != "save" {
+			exit_with_usage()
+		}
+		flags := flag.NewFlagSet("snapshot save", flag.ExitOnError)
+		live := flags.Bool("live", false, "also record current predictions and alerts (two requests per stop)")
+		flags.Parse(args[2:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		snapshot, err := take_snapshot(api, *live, time.Now())
+		if err != nil {
+			return err
+		}
+		return save_snapshot(flags.Arg(0), snapshot)
+	case "serve":
+		flags := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := flags.String("addr", ":8080", "the address to listen on")
+		cacheTTL := flags.Duration("cache-ttl", 10*time.Minute, "how long to reuse the route network before fetching it again")
+		flags.Parse(args[1:])
+		return run_server(api, *addr, *cacheTTL, options)
+	case "fakeapi":
+		flags := flag.NewFlagSet("fakeapi", flag.ExitOnError)
+		addr := flags.String("addr", ":8081", "the address to listen on")
+		rateLimit := flags.Int("rate-limit", 1000, "how many requests to allow a minute before answering 429 (0 for no limit)")
+		failEvery := flags.Int("fail-every", 0, "fail every nth request (0 to never fail)")
+		failStatus := flags.Int("fail-status", http.StatusServiceUnavailable, "the status code to fail with")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		snapshot, err := load_snapshot(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fake := new_fake_api(snapshot)
+		fake.RateLimit, fake.FailEvery, fake.FailStatus = *rateLimit, *failEvery, *failStatus
+		return run_fake_api(fake, *addr)
+	case "export":
+		if len(args) < 2 {
+			exit_with_usage()
+		}
+		flags := flag.NewFlagSet("export "+args[1], flag.ExitOnError)
+		format := flags.String("format", "dot", "dot or graphml (for export graph)")
+		output := flags.String("o", "-", "the file to write to, or - for standard out")
+		flags.Parse(args[2:])
+		network, err := build_route_network(api)
+		if err != nil {
+			return err
+		}
+		// The stops and shapes are enough for GeoJSON; the graph and the transfers follow the branches.
+		if args[1] != "geojson" {
+			network, err = with_schedules(api, network)
+			if err != nil {
+				return err
+			}
+		}
+		switch args[1] {
+		case "graph":
+			return write_output(*output, func(w io.Writer) error {
+				return write_graph(w, network, *format)
+			})
+		case "geojson":
+			routeShapes, err := fetch_route_shapes(api, network)
+			if err != nil {
+				return err
+			}
+			collection, err := build_geojson(network, routeShapes)
+			if err != nil {
+				return err
+			}
+			return write_output(*output, func(w io.Writer) error {
+				return write_geojson(w, collection)
+			})
+		case "transfers":
+			return write_output(*output, func(w io.Writer) error {
+				return write_transfer_csv(w, network)
+			})
+		default:
+			exit_with_usage()
+		}
+	case "render":
+		flags := flag.NewFlagSet("render", flag.ExitOnError)
+		layout := flags.String("layout", "schematic", "schematic (one straight line per route) or geographic")
+		routes := flags.String("routes", "", "a comma separated list of the routes to draw (default every route)")
+		width := flags.Float64("width", 1200, "the width of the image")
+		height := flags.Float64("height", 800, "the height of the image")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			exit_with_usage()
+		}
+		network, err := build_network(api)
+		if err != nil {
+			return err
+		}
+		routeNames := []string{}
+		if *routes != "" {
+			routeNames = strings.Split(*routes, ",")
+		}
+		network, err = filter_network_routes(network, routeNames)
+		if err != nil {
+			return err
+		}
+		return write_output(flags.Arg(0), func(w io.Writer) error {
+			return render_map_svg(w, network, MapOptions{Layout: *layout, Width: *width, Height: *height})
+		})
+	case "analyze":
+		flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+		modeList := flags.String("modes", "", "a comma separated list of light, heavy, commuter, bus or ferry (default every mode)")
+		top := flags.Int("top", 10, "how many of the most central stations to list")
+		flags.Parse(args[1:])
+		modes, err := parse_modes(*modeList)
+		if err != nil {
+			return err
+		}
+		network, err := build_network(api)
+		if err != nil {
+			return err
+		}
+		analysis, err := analyze_network(network, modes)
+		if err != nil {
+			return err
+		}
+		print_analysis(os.Stdout, analysis, *top)
+	default:
+		exit_with_usage()
+	}
+	return nil
+}
+
+func write_output(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// run_snapshot_diff exits with status 1 when the snapshots differ, as diff does, so that scripts can tell.
+func run_snapshot_diff(beforePath string, afterPath string) error {
+	before, err := load_snapshot(beforePath)
+	if err != nil {
+		return err
+	}
+	after, err := load_snapshot(afterPath)
+	if err != nil {
+		return err
+	}
+	diff, err := diff_snapshots(before, after)
+	if err != nil {
+		return err
+	}
+	print_network_diff(os.Stdout, diff)
+	if !diff.empty() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func exit_with_usage() {
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+}
+
 type MBTAWebServer interface {
 	GetRoutes(RouteRailType, RouteRailType) (RouteWrapper, error)
 	GetStops(Route) (StopWrapper, error)
+	GetPredictions(Stop) (PredictionWrapper, error)
+	GetAlerts(Stop) (AlertWrapper, error)
+	GetShapes(Route) (ShapeWrapper, error)
+	GetFacilities() (FacilityWrapper, error)
+	GetAccessibilityAlerts() (AlertWrapper, error)
+	GetSchedules(Route) (ScheduleWrapper, error)
 }
 
 var ErrWebFailure = errors.New("MBTA API reported a non-OK status code (could be rate-limiting)")
 
-type ConcreteMBTAWebServer struct{}
+const defaultAPIBaseURL = "https://api-v3.mbta.com"
+
+type ConcreteMBTAWebServer struct {
+	// Metrics, when set, records the count, latency and status of every request along with the
+	// rate-limit headroom the API reports back.
+	Metrics *MetricsRegistry
+	// BaseURL is where the API is, the MBTA's own (defaultAPIBaseURL) when empty, e.g. to use a fakeapi.
+	BaseURL string
+	// Client makes the requests, http.DefaultClient when nil. Give it a RecordingTransport to save the
+	// responses as fixtures, or a ReplayTransport to answer from them.
+	Client *http.Client
+}
 
 func (c ConcreteMBTAWebServer) GetRoutes(type1 RouteRailType, type2 RouteRailType) (RouteWrapper, error) {
-	url := fmt.Sprintf("https://api-v3.mbta.com/routes?filter[type]=%d,%d", type1, type2)
-	resp, err := http.Get(url)
-	if err != nil {
-		return RouteWrapper{}, err
-	}
-
-	if resp.StatusCode >= 400 {
-		return RouteWrapper{}, ErrWebFailure
-	}
+	url := c.url(fmt.Sprintf("/routes?filter[type]=%d,%d", type1, type2))
 
 	wrapper := RouteWrapper{}
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&wrapper); err != nil {
+	if err := c.get_json(url, &wrapper); err != nil {
 		return RouteWrapper{}, err
 	}
 
@@ -62,23 +462,140 @@ func (c ConcreteMBTAWebServer) GetStops(route Route) (StopWrapper, error) {
 	// This means that we have to request the stops for each route, but given that there are only
 	// 8 light and heavy routes total, this shouldn't overload their servers or cause a time-out
 	// for this client.
-	url := fmt.Sprintf("https://api-v3.mbta.com/stops?filter[route]=%s", route.ID)
-	resp, err := http.Get(url)
-	if err != nil {
+	url := c.url(fmt.Sprintf("/stops?filter[route]=%s", route.ID))
+
+	wrapper := StopWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
 		return StopWrapper{}, err
 	}
 
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetPredictions(stop Stop) (PredictionWrapper, error) {
+	// The stops we hold are parent stations (e.g. place-pktrm), and the API expands a parent station
+	// filter to all of its platforms for us, so one request covers every route serving the station.
+	url := c.url(fmt.Sprintf("/predictions?filter[stop]=%s&sort=departure_time", stop.ID))
+
+	wrapper := PredictionWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return PredictionWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetAlerts(stop Stop) (AlertWrapper, error) {
+	url := c.url(fmt.Sprintf("/alerts?filter[stop]=%s&filter[datetime]=NOW", stop.ID))
+
+	wrapper := AlertWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return AlertWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetShapes(route Route) (ShapeWrapper, error) {
+	url := c.url(fmt.Sprintf("/shapes?filter[route]=%s", route.ID))
+
+	wrapper := ShapeWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return ShapeWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetFacilities() (FacilityWrapper, error) {
+	// Unlike the other requests this isn't filtered to a stop, since every elevator and escalator on the
+	// system comes back in one response, which is much cheaper than asking about each stop.
+	url := c.url("/facilities?filter[type]=ELEVATOR,ESCALATOR")
+
+	wrapper := FacilityWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return FacilityWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetAccessibilityAlerts() (AlertWrapper, error) {
+	url := c.url("/alerts?filter[effect]=ELEVATOR_CLOSURE,ESCALATOR_CLOSURE,ACCESS_ISSUE&filter[datetime]=NOW")
+
+	wrapper := AlertWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return AlertWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) GetSchedules(route Route) (ScheduleWrapper, error) {
+	// A whole day of a subway line's schedule is tens of thousands of stop times, when a couple of hours
+	// in the morning is plenty to see how long the trains take and how often they come. The schedules
+	// stop at platforms, so we include the platforms to find out which station each belongs to.
+	url := c.url(fmt.Sprintf("/schedules?filter[route]=%s&filter[min_time]=08:00&filter[max_time]=10:00&include=stop", route.ID))
+
+	wrapper := ScheduleWrapper{}
+	if err := c.get_json(url, &wrapper); err != nil {
+		return ScheduleWrapper{}, err
+	}
+
+	return wrapper, nil
+}
+
+func (c ConcreteMBTAWebServer) url(path string) string {
+	if c.BaseURL == "" {
+		return defaultAPIBaseURL + path
+	}
+	return strings.TrimSuffix(c.BaseURL, "/") + path
+}
+
+func (c ConcreteMBTAWebServer) get_json(url string, into interface{}) error {
+	endpoint := api_endpoint_name(url)
+
+	start := time.Now()
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(url)
+	c.Metrics.Observe("mbta_api_request_duration_seconds", time.Since(start).Seconds(), endpoint)
+	if err != nil {
+		c.Metrics.Inc("mbta_api_requests_total", endpoint, "error")
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.Metrics.Inc("mbta_api_requests_total", endpoint, strconv.Itoa(resp.StatusCode))
+	record_rate_limit(c.Metrics, resp.Header)
+
 	if resp.StatusCode >= 400 {
-		return StopWrapper{}, ErrWebFailure
+		return ErrWebFailure
 	}
 
-	wrapper := StopWrapper{}
 	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&wrapper); err != nil {
-		return StopWrapper{}, err
+	return decoder.Decode(into)
+}
+
+// api_endpoint_name turns a request URL into the resource it asks for (routes, stops and so on), which
+// keeps the metric labels to a handful of values rather than one per stop ID.
+func api_endpoint_name(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "unknown"
 	}
+	return strings.SplitN(strings.TrimPrefix(parsed.Path, "/"), "/", 2)[0]
+}
 
-	return wrapper, nil
+func record_rate_limit(metrics *MetricsRegistry, header http.Header) {
+	if limit, err := strconv.ParseFloat(header.Get("x-ratelimit-limit"), 64); err == nil {
+		metrics.Set("mbta_api_ratelimit_limit", limit)
+	}
+	if remaining, err := strconv.ParseFloat(header.Get("x-ratelimit-remaining"), 64); err == nil {
+		metrics.Set("mbta_api_ratelimit_remaining", remaining)
+	}
 }
 
 type RouteWrapper struct {
@@ -92,6 +609,23 @@ type Route struct {
 
 type RouteAttribute struct {
 	LongName string `json:"long_name"`
+	// ShortName is empty for the subway lines, and the branch letter for the Green Line, e.g. "B".
+	ShortName string `json:"short_name"`
+	// Description is the kind of service, e.g. "Rapid Transit".
+	Description string `json:"description"`
+	// Color is a hex color without the leading "#", e.g. "DA291C" for the Red Line.
+	Color string `json:"color"`
+	// TextColor is the hex color for text drawn over Color.
+	TextColor string `json:"text_color"`
+	// SortOrder is the order the MBTA lists its routes in, lowest first.
+	SortOrder int `json:"sort_order"`
+	// Type is the GTFS route type: 0 for light rail, 1 for heavy rail, 2 for commuter rail and 3 for bus.
+	Type int `json:"type"`
+	// DirectionNames and DirectionDestinations are indexed by direction ID, e.g. "South" and
+	// "Ashmont/Braintree" for direction 0 of the Red Line. Every route has two directions, and keeping them
+	// in arrays rather than slices keeps Route comparable, since it is a map key all over.
+	DirectionNames        [2]string `json:"direction_names"`
+	DirectionDestinations [2]string `json:"direction_destinations"`
 }
 
 type StopWrapper struct {
@@ -104,7 +638,142 @@ type Stop struct {
 }
 
 type StopAttribute struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// WheelchairBoarding is 1 for accessible, 2 for not accessible, and 0 when the MBTA doesn't say.
+	WheelchairBoarding int `json:"wheelchair_boarding"`
+}
+
+type PredictionWrapper struct {
+	Data []Prediction `json:"data"`
+}
+
+type Prediction struct {
+	ID            string                  `json:"id"`
+	Attribute     PredictionAttribute     `json:"attributes"`
+	Relationships PredictionRelationships `json:"relationships"`
+}
+
+type PredictionAttribute struct {
+	// The times are RFC 3339 strings, and either one can be null (e.g. no departure at a terminus).
+	ArrivalTime   string `json:"arrival_time"`
+	DepartureTime string `json:"departure_time"`
+	DirectionID   int    `json:"direction_id"`
+	Status        string `json:"status"`
+}
+
+type PredictionRelationships struct {
+	Route Relationship `json:"route"`
+}
+
+type ScheduleWrapper struct {
+	Data     []Schedule     `json:"data"`
+	Included []ScheduleStop `json:"included,omitempty"`
+}
+
+type Schedule struct {
+	ID            string                `json:"id"`
+	Attribute     ScheduleAttribute     `json:"attributes"`
+	Relationships ScheduleRelationships `json:"relationships"`
+}
+
+type ScheduleAttribute struct {
+	// The times are RFC 3339 strings, with no arrival at the first stop of a trip and no departure at the last.
+	ArrivalTime   string `json:"arrival_time"`
+	DepartureTime string `json:"departure_time"`
+	StopSequence  int    `json:"stop_sequence"`
+	DirectionID   int    `json:"direction_id"`
+}
+
+type ScheduleRelationships struct {
+	Stop Relationship `json:"stop"`
+	Trip Relationship `json:"trip"`
+}
+
+// ScheduleStop is a platform a schedule stops at, which belongs to one of the parent stations we hold.
+type ScheduleStop struct {
+	ID            string                    `json:"id"`
+	Attribute     ScheduleStopAttribute     `json:"attributes"`
+	Relationships ScheduleStopRelationships `json:"relationships"`
+}
+
+type ScheduleStopAttribute struct {
 	Name string `json:"name"`
+	// PlatformName is which way the platform goes, e.g. "Alewife" or "Ashmont/Braintree".
+	PlatformName string `json:"platform_name"`
+}
+
+type ScheduleStopRelationships struct {
+	ParentStation Relationship `json:"parent_station"`
+}
+
+type ShapeWrapper struct {
+	Data []Shape `json:"data"`
+}
+
+type Shape struct {
+	ID        string         `json:"id"`
+	Attribute ShapeAttribute `json:"attributes"`
+}
+
+type ShapeAttribute struct {
+	// Polyline is the path of the shape in Google's encoded polyline format, see decode_polyline.
+	Polyline string `json:"polyline"`
+}
+
+type AlertWrapper struct {
+	Data []Alert `json:"data"`
+}
+
+type Alert struct {
+	ID        string         `json:"id"`
+	Attribute AlertAttribute `json:"attributes"`
+}
+
+type AlertAttribute struct {
+	Header   string `json:"header"`
+	Effect   string `json:"effect"`
+	Severity int    `json:"severity"`
+	// InformedEntity is what the alert is about, which for an elevator closure includes the facility.
+	InformedEntity []AlertEntity `json:"informed_entity,omitempty"`
+}
+
+type AlertEntity struct {
+	Stop     string `json:"stop,omitempty"`
+	Route    string `json:"route,omitempty"`
+	Facility string `json:"facility,omitempty"`
+}
+
+type FacilityWrapper struct {
+	Data []Facility `json:"data"`
+}
+
+// Facility is an elevator or escalator, belonging to the parent station it is in.
+type Facility struct {
+	ID            string                `json:"id"`
+	Attribute     FacilityAttribute     `json:"attributes"`
+	Relationships FacilityRelationships `json:"relationships"`
+}
+
+type FacilityAttribute struct {
+	LongName  string `json:"long_name"`
+	ShortName string `json:"short_name"`
+	// Type is ELEVATOR or ESCALATOR (among others we don't ask for).
+	Type string `json:"type"`
+}
+
+type FacilityRelationships struct {
+	Stop Relationship `json:"stop"`
+}
+
+type Relationship struct {
+	Data RelationshipData `json:"data"`
+}
+
+type RelationshipData struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
 }
 
 type RouteRailType int
@@ -117,17 +786,17 @@ const (
 	RouteRailTypeHeavyRail
 )
 
-func print_light_and_heavy_rail_routes(api MBTAWebServer) error {
+func print_light_and_heavy_rail_routes(api MBTAWebServer, out io.Writer) error {
 	names, err := list_light_and_heavy_rail_routes(api)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("The Heavy Rail and Light Rail Routes are:")
+	fmt.Fprintln(out, "The Heavy Rail and Light Rail Routes are:")
 	for _, name := range names {
-		fmt.Println(name)
+		fmt.Fprintln(out, name)
 	}
-	fmt.Println("")
+	fmt.Fprintln(out, "")
 
 	return nil
 }
@@ -152,80 +821,141 @@ func get_heavy_and_light_routes(api MBTAWebServer) (RouteWrapper, error) {
 	// consumed the response. To save on retrieving data that we don't need, we are asking the server to filter
 	// for us. Given how the filter types are documented with their own type, I feel this speaks reasonably well
 	// as to what is happening with the query params going into the request.
-	return api.GetRoutes(RouteRailTypeLightRail, RouteRailTypeHeavyRail)
+	wrapper, err := api.GetRoutes(RouteRailTypeLightRail, RouteRailTypeHeavyRail)
+	if err != nil {
+		return RouteWrapper{}, err
+	}
+	// Everything that lists the routes lists them the way the MBTA does, e.g. the Green Line branches in
+	// letter order, rather than in whatever order the API returned them.
+	sort.SliceStable(wrapper.Data, func(i, j int) bool {
+		return wrapper.Data[i].Attribute.SortOrder < wrapper.Data[j].Attribute.SortOrder
+	})
+	return wrapper, nil
 }
 
 type MinMaxData struct {
-	Min      int
-	MinRoute string
-	Max      int
-	MaxRoute string
+	Min       int      `json:"min"`
+	MinRoutes []string `json:"min_routes"`
+	Max       int      `json:"max"`
+	MaxRoutes []string `json:"max_routes"`
+	Mean      float64  `json:"mean"`
+	Median    float64  `json:"median"`
+	// Histogram maps a number of stops to how many routes have exactly that many stops.
+	Histogram map[int]int `json:"histogram"`
 }
 
+var ErrEmptyNetwork = errors.New("no routes were found to collect stop data for")
+
 func collect_stop_data(api MBTAWebServer) (MinMaxData, map[Stop][]Route, error) {
-	wrapper, err := get_heavy_and_light_routes(api)
+	network, err := build_route_network(api)
 	if err != nil {
 		return MinMaxData{}, nil, err
 	}
 
-	routeStops := map[Route][]Stop{}
+	minMaxData, err := collect_network_stop_data(network)
+	if err != nil {
+		return MinMaxData{}, nil, err
+	}
 
-	stopRoutes := map[Stop][]Route{}
+	return minMaxData, network.StopRoutes, nil
+}
 
-	for _, route := range wrapper.Data {
-		stops, err := api.GetStops(route)
-		if err != nil {
-			return MinMaxData{}, nil, err
-		}
-		routeStops[route] = stops.Data
-		for _, stop := range stops.Data {
-			stopRoutes[stop] = append(stopRoutes[stop], route)
-		}
+func collect_network_stop_data(network Network) (MinMaxData, error) {
+	if len(network.Routes) == 0 {
+		return MinMaxData{}, ErrEmptyNetwork
 	}
 
-	min := 999999
-	minRoute := ""
-	max := 0
-	maxRoute := ""
+	return compute_min_max_data(network.Routes, network.RouteStops), nil
+}
 
-	for route, stops := range routeStops {
-		if len(stops) > max {
-			maxRoute = route.Attribute.LongName
-			max = len(stops)
+func compute_min_max_data(routes []Route, routeStops map[Route][]Stop) MinMaxData {
+	// We walk the routes in the order the API gave them to us rather than ranging over the map,
+	// so that routes which tie for the min or max are always reported in the same order.
+	data := MinMaxData{
+		Min:       len(routeStops[routes[0]]),
+		MinRoutes: []string{},
+		Max:       len(routeStops[routes[0]]),
+		MaxRoutes: []string{},
+		Histogram: map[int]int{},
+	}
+
+	counts := []int{}
+	total := 0
+
+	for _, route := range routes {
+		count := len(routeStops[route])
+		counts = append(counts, count)
+		total += count
+		data.Histogram[count]++
+
+		if count < data.Min {
+			data.Min = count
+			data.MinRoutes = []string{}
+		}
+		if count == data.Min {
+			data.MinRoutes = append(data.MinRoutes, route.Attribute.LongName)
 		}
-		if len(stops) < min {
-			minRoute = route.Attribute.LongName
-			min = len(stops)
+		if count > data.Max {
+			data.Max = count
+			data.MaxRoutes = []string{}
 		}
+		if count == data.Max {
+			data.MaxRoutes = append(data.MaxRoutes, route.Attribute.LongName)
+		}
+	}
+
+	sort.Ints(counts)
+	data.Mean = float64(total) / float64(len(counts))
+	if len(counts)%2 == 1 {
+		data.Median = float64(counts[len(counts)/2])
+	} else {
+		data.Median = float64(counts[len(counts)/2-1]+counts[len(counts)/2]) / 2
 	}
 
-	return MinMaxData{
-		Min:      min,
-		MinRoute: minRoute,
-		Max:      max,
-		MaxRoute: maxRoute,
-	}, stopRoutes, nil
+	return data
 }
 
-func print_stop_data(api MBTAWebServer) error {
-	minMaxData, stopRoutes, err := collect_stop_data(api)
+func print_stop_data(network Network, out io.Writer) error {
+	minMaxData, err := collect_network_stop_data(network)
 	if err != nil {
 		return err
 	}
+	stopRoutes := network.StopRoutes
+
+	fmt.Fprintln(out, "Route with the minimum number of stops:")
+	fmt.Fprintf(out, "%s (with %d stops)\n", strings.Join(minMaxData.MinRoutes, ", "), minMaxData.Min)
+	fmt.Fprintln(out, "Route with the maximum number of stops:")
+	fmt.Fprintf(out, "%s (with %d stops)\n", strings.Join(minMaxData.MaxRoutes, ", "), minMaxData.Max)
+	fmt.Fprintf(out, "Mean stops per route: %.2f\n", minMaxData.Mean)
+	fmt.Fprintf(out, "Median stops per route: %.1f\n", minMaxData.Median)
+	fmt.Fprintln(out, "")
+
+	fmt.Fprintln(out, "Number of routes by stop count:")
+	stopCounts := []int{}
+	for stopCount := range minMaxData.Histogram {
+		stopCounts = append(stopCounts, stopCount)
+	}
+	sort.Ints(stopCounts)
+	for _, stopCount := range stopCounts {
+		fmt.Fprintf(out, "%3d stops: %s\n", stopCount, strings.Repeat("#", minMaxData.Histogram[stopCount]))
+	}
+	fmt.Fprintln(out, "")
 
-	fmt.Println("Route with the minimum number of stops:")
-	fmt.Printf("%s (with %d stops)\n", minMaxData.MinRoute, minMaxData.Min)
-	fmt.Println("Route with the maximum number of stops:")
-	fmt.Printf("%s (with %d stops)\n", minMaxData.MaxRoute, minMaxData.Max)
-	fmt.Println("")
-
-	fmt.Println("The following stops connect multiple routes:")
+	// The stops are in a map, so they are sorted by name to print the same way every time.
+	transferStops := []Stop{}
 	for stop, routes := range stopRoutes {
 		if len(routes) > 1 {
-			fmt.Printf("Stop %s connects routes: %s\n", stop.Attribute.Name, build_route_list_name(routes))
+			transferStops = append(transferStops, stop)
 		}
 	}
-	fmt.Println("")
+	sort.Slice(transferStops, func(i, j int) bool {
+		return transferStops[i].Attribute.Name < transferStops[j].Attribute.Name
+	})
+	fmt.Fprintln(out, "The following stops connect multiple routes:")
+	for _, stop := range transferStops {
+		fmt.Fprintf(out, "Stop %s connects routes: %s\n", stop.Attribute.Name, build_route_list_name(stopRoutes[stop]))
+	}
+	fmt.Fprintln(out, "")
 
 	return nil
 }
@@ -244,16 +974,19 @@ func build_route_list_name(routes []Route) string {
 	return list_name
 }
 
-func prompt_for_stops_to_route(api MBTAWebServer) error {
-	reader := bufio.NewReader(os.Stdin)
+// prompt_for_stops_to_route tells the user when there's no way to plan between the stops they typed in,
+// rather than failing, since that is usually a typo. Only a failure talking to the API is an error. It
+// fetches the schedules the network doesn't have yet, to plan along each branch.
+func prompt_for_stops_to_route(api MBTAWebServer, network Network, options PlanOptions, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
 
-	fmt.Println("Enter Starting Stop")
+	fmt.Fprintln(out, "Enter Starting Stop")
 	startStop, err := reader.ReadString('\n')
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Enter Ending Stop")
+	fmt.Fprintln(out, "Enter Ending Stop")
 	endStop, err := reader.ReadString('\n')
 	if err != nil {
 		return err
@@ -262,99 +995,57 @@ func prompt_for_stops_to_route(api MBTAWebServer) error {
 	startStopName := strings.TrimSpace(startStop)
 	endStopName := strings.TrimSpace(endStop)
 
-	routes, err := routes_for_stop_to_stop(api, startStopName, endStopName)
+	network, err = with_schedules(api, network)
 	if err != nil {
 		return err
 	}
-
-	if len(routes) > 0 {
-		fmt.Printf("Take the following routes to get from %s to %s:\n", startStopName, endStopName)
-		for _, route := range routes {
-			fmt.Println(route.Attribute.LongName)
-		}
-	} else {
-		fmt.Printf("The path from %s to %s is to take no routes, as they are the same path.\n", startStopName, endStopName)
+	options, err = with_accessibility(api, options)
+	if err != nil {
+		return err
 	}
+	itineraries, err := plan_place_names(network, startStopName, endStopName, options)
+	if print_plan_error(out, startStopName, endStopName, err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	estimates := estimate_trips(network, itineraries, options.TransferPenaltyMinutes)
+	print_itineraries(out, startStopName, endStopName, itineraries, estimates)
+	print_trip_estimates(out, estimates)
 
 	return nil
 }
 
+// print_plan_error explains why there is no plan between two places, and says whether err was one it
+// could explain.
+func print_plan_error(out io.Writer, startName string, endName string, err error) bool {
+	switch {
+	case err == ErrNoStartStop:
+		fmt.Fprintf(out, "Could not find a stop, coordinate or address called %q to start from.\n", startName)
+	case err == ErrNoEndStop:
+		fmt.Fprintf(out, "Could not find a stop, coordinate or address called %q to end at.\n", endName)
+	case err == ErrNoPath:
+		fmt.Fprintf(out, "There is no way to get from %s to %s on these routes.\n", startName, endName)
+	case errors.Is(err, ErrNoAccessiblePath):
+		fmt.Fprintf(out, "There is no wheelchair accessible way to get from %s to %s (%s).\n", startName, endName, strings.TrimPrefix(err.Error(), ErrNoAccessiblePath.Error()+": "))
+	default:
+		return false
+	}
+	return true
+}
+
 var (
 	ErrNoStartStop = errors.New("could not find start stop")
 	ErrNoEndStop   = errors.New("could not find end stop")
 )
 
 func routes_for_stop_to_stop(api MBTAWebServer, startStopName string, endStopName string) ([]Route, error) {
-	wrapper, err := get_heavy_and_light_routes(api)
+	network, err := build_network(api)
 	if err != nil {
 		return nil, err
 	}
 
-	routeStops := map[Route][]Stop{}
-	stopRoutes := map[Stop][]Route{}
-
-	startStop := Stop{}
-	endStop := Stop{}
-
-	for _, route := range wrapper.Data {
-		stops, err := api.GetStops(route)
-		if err != nil {
-			return nil, err
-		}
-		routeStops[route] = stops.Data
-		for _, stop := range stops.Data {
-			stopRoutes[stop] = append(stopRoutes[stop], route)
-			if stop.Attribute.Name == startStopName {
-				startStop = stop
-			}
-			if stop.Attribute.Name == endStopName {
-				endStop = stop
-			}
-		}
-	}
-
-	if startStop.ID == "" {
-		return nil, ErrNoStartStop
-	}
-	if endStop.ID == "" {
-		return nil, ErrNoEndStop
-	}
-
-	routes, err := explore_routes_and_stops(routeStops, stopRoutes, startStop, endStop, []Route{}, map[Route]struct{}{})
-	if err != nil {
-		return nil, err
-	}
-
-	return routes, nil
-}
-
-var ErrNoPath = errors.New("no path to end stop from this branch")
-
-func explore_routes_and_stops(routeStops map[Route][]Stop, stopRoutes map[Stop][]Route, currentStop Stop, endStop Stop, currentRoutes []Route, explored map[Route]struct{}) ([]Route, error) {
-	if currentStop == endStop {
-		return currentRoutes, nil
-	}
-
-	for _, route := range stopRoutes[currentStop] {
-		for _, subStop := range routeStops[route] {
-			if subStop == endStop {
-				return append(currentRoutes, route), nil
-			}
-		}
-		for _, subStop := range routeStops[route] {
-			if _, ok := explored[route]; !ok {
-				subExplored := map[Route]struct{}{}
-				for exploredRoute := range explored {
-					subExplored[exploredRoute] = struct{}{}
-				}
-				subExplored[route] = struct{}{}
-				ret, err := explore_routes_and_stops(routeStops, stopRoutes, subStop, endStop, append(currentRoutes, route), subExplored)
-				if err == nil {
-					return ret, nil
-				}
-			}
-		}
-	}
-
-	return []Route{}, ErrNoPath
+	return routes_for_stop_names(network, startStopName, endStopName)
 }
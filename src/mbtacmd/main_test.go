@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -15,6 +21,28 @@ type MockMBTAWebServer struct {
 	RecvRoutes             []Route
 	ReturnStopWrapper      map[string]StopWrapper
 	ReturnStopWrapperError error
+
+	RecvPredictionStops          []Stop
+	ReturnPredictionWrapper      map[string]PredictionWrapper
+	ReturnPredictionWrapperError error
+
+	RecvAlertStops          []Stop
+	ReturnAlertWrapper      map[string]AlertWrapper
+	ReturnAlertWrapperError error
+
+	RecvShapeRoutes         []Route
+	ReturnShapeWrapper      map[string]ShapeWrapper
+	ReturnShapeWrapperError error
+
+	ReturnFacilityWrapper      FacilityWrapper
+	ReturnFacilityWrapperError error
+
+	ReturnAccessibilityAlertWrapper      AlertWrapper
+	ReturnAccessibilityAlertWrapperError error
+
+	RecvScheduleRoutes         []Route
+	ReturnScheduleWrapper      map[string]ScheduleWrapper
+	ReturnScheduleWrapperError error
 }
 
 func (c *MockMBTAWebServer) GetRoutes(type1 RouteRailType, type2 RouteRailType) (RouteWrapper, error) {
@@ -28,6 +56,34 @@ func (c *MockMBTAWebServer) GetStops(route Route) (StopWrapper, error) {
 	return c.ReturnStopWrapper[route.ID], c.ReturnStopWrapperError
 }
 
+func (c *MockMBTAWebServer) GetPredictions(stop Stop) (PredictionWrapper, error) {
+	c.RecvPredictionStops = append(c.RecvPredictionStops, stop)
+	return c.ReturnPredictionWrapper[stop.ID], c.ReturnPredictionWrapperError
+}
+
+func (c *MockMBTAWebServer) GetAlerts(stop Stop) (AlertWrapper, error) {
+	c.RecvAlertStops = append(c.RecvAlertStops, stop)
+	return c.ReturnAlertWrapper[stop.ID], c.ReturnAlertWrapperError
+}
+
+func (c *MockMBTAWebServer) GetShapes(route Route) (ShapeWrapper, error) {
+	c.RecvShapeRoutes = append(c.RecvShapeRoutes, route)
+	return c.ReturnShapeWrapper[route.ID], c.ReturnShapeWrapperError
+}
+
+func (c *MockMBTAWebServer) GetFacilities() (FacilityWrapper, error) {
+	return c.ReturnFacilityWrapper, c.ReturnFacilityWrapperError
+}
+
+func (c *MockMBTAWebServer) GetAccessibilityAlerts() (AlertWrapper, error) {
+	return c.ReturnAccessibilityAlertWrapper, c.ReturnAccessibilityAlertWrapperError
+}
+
+func (c *MockMBTAWebServer) GetSchedules(route Route) (ScheduleWrapper, error) {
+	c.RecvScheduleRoutes = append(c.RecvScheduleRoutes, route)
+	return c.ReturnScheduleWrapper[route.ID], c.ReturnScheduleWrapperError
+}
+
 func Test_list_light_and_heavy_rail_routes(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		mockAPI := &MockMBTAWebServer{
@@ -98,7 +154,7 @@ func Test_get_heavy_and_light_routes(t *testing.T) {
 			t.Error("did not expect an error")
 		}
 		if !reflect.DeepEqual(wrapper, routes) {
-			t.Errorf("expected %s to be equal to %s", wrapper, routes)
+			t.Errorf("expected %+v to be equal to %+v", wrapper, routes)
 		}
 		if *mockAPI.RecvType1 != RouteRailTypeLightRail {
 			t.Errorf("expected received %d to be %d", mockAPI.RecvType1, RouteRailTypeLightRail)
@@ -108,6 +164,25 @@ func Test_get_heavy_and_light_routes(t *testing.T) {
 		}
 	})
 
+	t.Run("happy path - in sort order", func(t *testing.T) {
+		red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line", SortOrder: 10010}}
+		greenC := Route{ID: "Green-C", Attribute: RouteAttribute{LongName: "Green Line C", SortOrder: 10033}}
+		greenB := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B", SortOrder: 10032}}
+		expected := RouteWrapper{Data: []Route{red, greenB, greenC}}
+
+		mockAPI := &MockMBTAWebServer{
+			ReturnRouteWrapper: RouteWrapper{Data: []Route{greenC, red, greenB}},
+		}
+
+		routes, err := get_heavy_and_light_routes(mockAPI)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, routes) {
+			t.Errorf("expected %+v to be equal to %+v", expected, routes)
+		}
+	})
+
 	t.Run("sad path", func(t *testing.T) {
 		myErr := errors.New("custom mock error")
 
@@ -122,6 +197,34 @@ func Test_get_heavy_and_light_routes(t *testing.T) {
 	})
 }
 
+func Test_decode_route(t *testing.T) {
+	t.Run("happy path - every attribute", func(t *testing.T) {
+		body := `{"data": [{"id": "Red", "attributes": {
+			"color": "DA291C", "description": "Rapid Transit",
+			"direction_destinations": ["Ashmont/Braintree", "Alewife"], "direction_names": ["South", "North"],
+			"fare_class": "Rapid Transit", "long_name": "Red Line", "short_name": "", "sort_order": 10010,
+			"text_color": "FFFFFF", "type": 1}}]}`
+		expected := Route{ID: "Red", Attribute: RouteAttribute{
+			LongName:              "Red Line",
+			Description:           "Rapid Transit",
+			Color:                 "DA291C",
+			TextColor:             "FFFFFF",
+			SortOrder:             10010,
+			Type:                  1,
+			DirectionNames:        [2]string{"South", "North"},
+			DirectionDestinations: [2]string{"Ashmont/Braintree", "Alewife"},
+		}}
+
+		wrapper := RouteWrapper{}
+		if err := json.Unmarshal([]byte(body), &wrapper); err != nil {
+			t.Errorf("did not expect an error, got %s", err)
+		}
+		if len(wrapper.Data) != 1 || wrapper.Data[0] != expected {
+			t.Errorf("expected %+v to be equal to %+v", wrapper.Data, expected)
+		}
+	})
+}
+
 func Test_collect_stop_data(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		mockAPI := &MockMBTAWebServer{
@@ -172,10 +275,13 @@ func Test_collect_stop_data(t *testing.T) {
 		}
 
 		expectedMinMaxData := MinMaxData{
-			Min:      1,
-			MinRoute: "mock route name 1",
-			Max:      2,
-			MaxRoute: "mock route name 2",
+			Min:       1,
+			MinRoutes: []string{"mock route name 1"},
+			Max:       2,
+			MaxRoutes: []string{"mock route name 2"},
+			Mean:      1.5,
+			Median:    1.5,
+			Histogram: map[int]int{1: 1, 2: 1},
 		}
 
 		expectedStopRoutes := map[Stop][]Route{
@@ -217,12 +323,16 @@ func Test_collect_stop_data(t *testing.T) {
 		if err != nil {
 			t.Error("did not expect an error")
 		}
-		if expectedMinMaxData != minMaxData {
+		if !reflect.DeepEqual(expectedMinMaxData, minMaxData) {
 			t.Errorf("expected %+v to be equal to %+v", expectedMinMaxData, minMaxData)
 		}
 		if !reflect.DeepEqual(expectedStopRoutes, stopRoutes) {
 			t.Errorf("expected %+v to be equal to %+v", expectedStopRoutes, stopRoutes)
 		}
+		// Counting stops doesn't need the schedules.
+		if len(mockAPI.RecvScheduleRoutes) != 0 {
+			t.Errorf("expected no schedules to be requested, got %+v", mockAPI.RecvScheduleRoutes)
+		}
 	})
 
 	t.Run("sad path - route lookup fails", func(t *testing.T) {
@@ -264,6 +374,75 @@ func Test_collect_stop_data(t *testing.T) {
 			t.Errorf("expected error %s to be %s", myErr, err)
 		}
 	})
+
+	t.Run("sad path - no routes", func(t *testing.T) {
+		mockAPI := &MockMBTAWebServer{}
+
+		_, _, err := collect_stop_data(mockAPI)
+		if err != ErrEmptyNetwork {
+			t.Errorf("expected error %s to be %s", ErrEmptyNetwork, err)
+		}
+	})
+}
+
+func Test_compute_min_max_data(t *testing.T) {
+	t.Run("happy path - ties", func(t *testing.T) {
+		routes := []Route{
+			{ID: "route id 1", Attribute: RouteAttribute{LongName: "route name 1"}},
+			{ID: "route id 2", Attribute: RouteAttribute{LongName: "route name 2"}},
+			{ID: "route id 3", Attribute: RouteAttribute{LongName: "route name 3"}},
+			{ID: "route id 4", Attribute: RouteAttribute{LongName: "route name 4"}},
+		}
+		routeStops := map[Route][]Stop{
+			routes[0]: []Stop{{ID: "stop id 1"}},
+			routes[1]: []Stop{{ID: "stop id 1"}, {ID: "stop id 2"}, {ID: "stop id 3"}},
+			routes[2]: []Stop{{ID: "stop id 2"}},
+			routes[3]: []Stop{{ID: "stop id 1"}, {ID: "stop id 2"}, {ID: "stop id 3"}},
+		}
+
+		expected := MinMaxData{
+			Min:       1,
+			MinRoutes: []string{"route name 1", "route name 3"},
+			Max:       3,
+			MaxRoutes: []string{"route name 2", "route name 4"},
+			Mean:      2,
+			Median:    2,
+			Histogram: map[int]int{1: 2, 3: 2},
+		}
+
+		result := compute_min_max_data(routes, routeStops)
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("expected %+v to be equal to %+v", expected, result)
+		}
+	})
+
+	t.Run("happy path - odd number of routes", func(t *testing.T) {
+		routes := []Route{
+			{ID: "route id 1", Attribute: RouteAttribute{LongName: "route name 1"}},
+			{ID: "route id 2", Attribute: RouteAttribute{LongName: "route name 2"}},
+			{ID: "route id 3", Attribute: RouteAttribute{LongName: "route name 3"}},
+		}
+		routeStops := map[Route][]Stop{
+			routes[0]: []Stop{{ID: "stop id 1"}, {ID: "stop id 2"}, {ID: "stop id 3"}, {ID: "stop id 4"}, {ID: "stop id 5"}},
+			routes[1]: []Stop{},
+			routes[2]: []Stop{{ID: "stop id 1"}},
+		}
+
+		expected := MinMaxData{
+			Min:       0,
+			MinRoutes: []string{"route name 2"},
+			Max:       5,
+			MaxRoutes: []string{"route name 1"},
+			Mean:      2,
+			Median:    1,
+			Histogram: map[int]int{0: 1, 1: 1, 5: 1},
+		}
+
+		result := compute_min_max_data(routes, routeStops)
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("expected %+v to be equal to %+v", expected, result)
+		}
+	})
 }
 
 func Test_build_route_list_name(t *testing.T) {
@@ -301,130 +480,6 @@ func Test_build_route_list_name(t *testing.T) {
 	})
 }
 
-func Test_explore_routes_and_stops(t *testing.T) {
-	t.Run("happy path - same start and end", func(t *testing.T) {
-		routeStops := map[Route][]Stop{}
-		stopRoutes := map[Stop][]Route{}
-		currentStop := Stop{ID: "stop id 1"}
-		endStop := Stop{ID: "stop id 1"}
-		currentRoutes := []Route{}
-		explored := map[Route]struct{}{}
-
-		expected := []Route{}
-
-		found, err := explore_routes_and_stops(routeStops, stopRoutes, currentStop, endStop, currentRoutes, explored)
-		if err != nil {
-			t.Error("did not expect an error")
-		}
-		if !reflect.DeepEqual(expected, found) {
-			t.Errorf("expected %s to be equal to %s", expected, found)
-		}
-	})
-
-	t.Run("happy path - on same route", func(t *testing.T) {
-		routeStops := map[Route][]Stop{
-			Route{ID: "route id 1"}: []Stop{
-				{ID: "stop id 1"},
-				{ID: "stop id 2"},
-			},
-		}
-		stopRoutes := map[Stop][]Route{
-			Stop{ID: "stop id 1"}: []Route{
-				{ID: "route id 1"},
-			},
-			Stop{ID: "stop id 2"}: []Route{
-				{ID: "route id 1"},
-			},
-		}
-		currentStop := Stop{ID: "stop id 1"}
-		endStop := Stop{ID: "stop id 2"}
-		currentRoutes := []Route{}
-		explored := map[Route]struct{}{}
-
-		expected := []Route{{ID: "route id 1"}}
-
-		found, err := explore_routes_and_stops(routeStops, stopRoutes, currentStop, endStop, currentRoutes, explored)
-		if err != nil {
-			t.Error("did not expect an error")
-		}
-		if !reflect.DeepEqual(expected, found) {
-			t.Errorf("expected %s to be equal to %s", expected, found)
-		}
-	})
-
-	t.Run("happy path - one route hop", func(t *testing.T) {
-		routeStops := map[Route][]Stop{
-			Route{ID: "route id 1"}: []Stop{
-				{ID: "stop id 1"},
-				{ID: "stop id 2"},
-			},
-			Route{ID: "route id 2"}: []Stop{
-				{ID: "stop id 2"},
-				{ID: "stop id 3"},
-			},
-		}
-		stopRoutes := map[Stop][]Route{
-			Stop{ID: "stop id 1"}: []Route{
-				{ID: "route id 1"},
-			},
-			Stop{ID: "stop id 2"}: []Route{
-				{ID: "route id 1"},
-				{ID: "route id 2"},
-			},
-			Stop{ID: "stop id 3"}: []Route{
-				{ID: "route id 2"},
-			},
-		}
-		currentStop := Stop{ID: "stop id 1"}
-		endStop := Stop{ID: "stop id 3"}
-		currentRoutes := []Route{}
-		explored := map[Route]struct{}{}
-
-		expected := []Route{{ID: "route id 1"}, {ID: "route id 2"}}
-
-		found, err := explore_routes_and_stops(routeStops, stopRoutes, currentStop, endStop, currentRoutes, explored)
-		if err != nil {
-			t.Error("did not expect an error")
-		}
-		if !reflect.DeepEqual(expected, found) {
-			t.Errorf("expected %s to be equal to %s", expected, found)
-		}
-	})
-
-	t.Run("sad path - one route hop - missing stop 2 route 2 connection", func(t *testing.T) {
-		routeStops := map[Route][]Stop{
-			Route{ID: "route id 1"}: []Stop{
-				{ID: "stop id 1"},
-				{ID: "stop id 2"},
-			},
-			Route{ID: "route id 2"}: []Stop{
-				{ID: "stop id 2"},
-				{ID: "stop id 3"},
-			},
-		}
-		stopRoutes := map[Stop][]Route{
-			Stop{ID: "stop id 1"}: []Route{
-				{ID: "route id 1"},
-			},
-			Stop{ID: "stop id 2"}: []Route{
-				{ID: "route id 1"},
-			},
-			Stop{ID: "stop id 3"}: []Route{
-				{ID: "route id 2"},
-			},
-		}
-		currentStop := Stop{ID: "stop id 1"}
-		endStop := Stop{ID: "stop id 3"}
-		currentRoutes := []Route{}
-		explored := map[Route]struct{}{}
-
-		_, err := explore_routes_and_stops(routeStops, stopRoutes, currentStop, endStop, currentRoutes, explored)
-		if err != ErrNoPath {
-			t.Errorf("expected error %s to be %s", err, ErrNoPath)
-		}
-	})
-}
-
 func Test_routes_for_stop_to_stop(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		mockAPI := &MockMBTAWebServer{
@@ -481,7 +536,7 @@ func Test_routes_for_stop_to_stop(t *testing.T) {
 			t.Error("did not expect an error")
 		}
 		if !reflect.DeepEqual(expected, found) {
-			t.Errorf("expected %s to be equal to %s", expected, found)
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
 		}
 	})
 
@@ -577,3 +632,178 @@ func Test_routes_for_stop_to_stop(t *testing.T) {
 		}
 	})
 }
+
+// mock_report_api is mock_server_api with the Mattapan Trolley added, which doesn't connect to the other
+// routes, so that there are places with no way between them.
+func mock_report_api() *MockMBTAWebServer {
+	api := mock_server_api()
+	api.ReturnRouteWrapper.Data = append(api.ReturnRouteWrapper.Data, Route{ID: "Mattapan", Attribute: RouteAttribute{LongName: "Mattapan Trolley"}})
+	api.ReturnStopWrapper["Mattapan"] = StopWrapper{Data: []Stop{
+		{ID: "place-asmnl", Attribute: StopAttribute{Name: "Ashmont"}},
+		{ID: "place-cedgr", Attribute: StopAttribute{Name: "Cedar Grove"}},
+		{ID: "place-matt", Attribute: StopAttribute{Name: "Mattapan"}},
+	}}
+	return api
+}
+
+func Test_print_light_and_heavy_rail_routes(t *testing.T) {
+	t.Run("happy path - prints every route", func(t *testing.T) {
+		out := bytes.Buffer{}
+		if err := print_light_and_heavy_rail_routes(mock_report_api(), &out); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		check_golden(t, "reports/routes.txt", out.Bytes())
+	})
+
+	t.Run("sad path - prints nothing when the routes can't be fetched", func(t *testing.T) {
+		api := mock_report_api()
+		api.ReturnRouteWrapperError = errors.New("api is down")
+		out := bytes.Buffer{}
+		err := print_light_and_heavy_rail_routes(api, &out)
+
+		if err != api.ReturnRouteWrapperError {
+			t.Errorf("expected error %s to be %s", api.ReturnRouteWrapperError, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("expected no output, got %q", out.String())
+		}
+	})
+}
+
+// mock_report_network is the network of mock_report_api without its schedules, as print_reports builds it.
+func mock_report_network(t *testing.T, api MBTAWebServer) Network {
+	t.Helper()
+	network, err := build_route_network(api)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	return network
+}
+
+func Test_print_stop_data(t *testing.T) {
+	t.Run("happy path - prints the stop counts and transfer stops", func(t *testing.T) {
+		out := bytes.Buffer{}
+		if err := print_stop_data(mock_report_network(t, mock_report_api()), &out); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		check_golden(t, "reports/stop_data.txt", out.Bytes())
+	})
+
+	t.Run("sad path - prints nothing for an empty network", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := print_stop_data(Network{}, &out)
+
+		if err != ErrEmptyNetwork {
+			t.Errorf("expected error %s to be %s", ErrEmptyNetwork, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("expected no output, got %q", out.String())
+		}
+	})
+}
+
+func Test_prompt_for_stops_to_route(t *testing.T) {
+	golden := []struct {
+		name    string
+		input   string
+		options PlanOptions
+		file    string
+	}{
+		{"happy path - plans a trip with a transfer", "Alewife\nKenmore\n", PlanOptions{}, "reports/plan.txt"},
+		{"happy path - plans a trip on one route", "Alewife\nPark Street\n", PlanOptions{}, "reports/plan_one_route.txt"},
+		{"sad path - unknown starting stop", "Nowhere\nKenmore\n", PlanOptions{}, "reports/plan_unknown_start.txt"},
+		{"sad path - unknown ending stop", "Alewife\nNowhere\n", PlanOptions{}, "reports/plan_unknown_end.txt"},
+		{"sad path - no route between the stops", "Alewife\nMattapan\n", PlanOptions{}, "reports/plan_no_route.txt"},
+		{"sad path - no accessible route between the stops", "Alewife\nKenmore\n", PlanOptions{Accessible: true}, "reports/plan_not_accessible.txt"},
+	}
+	for _, test := range golden {
+		t.Run(test.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			api := mock_report_api()
+			if err := prompt_for_stops_to_route(api, mock_report_network(t, api), test.options, strings.NewReader(test.input), &out); err != nil {
+				t.Fatalf("did not expect an error: %s", err)
+			}
+			check_golden(t, test.file, out.Bytes())
+		})
+	}
+
+	t.Run("sad path - input ends before the ending stop", func(t *testing.T) {
+		out := bytes.Buffer{}
+		api := mock_report_api()
+		err := prompt_for_stops_to_route(api, mock_report_network(t, api), PlanOptions{}, strings.NewReader("Alewife\n"), &out)
+
+		if err != io.EOF {
+			t.Errorf("expected error %s to be %s", io.EOF, err)
+		}
+		expected := "Enter Starting Stop\nEnter Ending Stop\n"
+		if out.String() != expected {
+			t.Errorf("expected %+v to be equal to %+v", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - returns the error when the schedules can't be fetched", func(t *testing.T) {
+		api := mock_report_api()
+		network := mock_report_network(t, api)
+		api.ReturnScheduleWrapperError = errors.New("api is down")
+		out := bytes.Buffer{}
+		err := prompt_for_stops_to_route(api, network, PlanOptions{}, strings.NewReader("Alewife\nKenmore\n"), &out)
+
+		if err != api.ReturnScheduleWrapperError {
+			t.Errorf("expected error %s to be %s", api.ReturnScheduleWrapperError, err)
+		}
+		check_golden(t, "reports/plan_schedule_error.txt", out.Bytes())
+	})
+}
+
+func Test_print_reports(t *testing.T) {
+	golden := func(t *testing.T, names ...string) []byte {
+		t.Helper()
+		expected := []byte{}
+		for _, name := range names {
+			contents, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, contents...)
+		}
+		return expected
+	}
+
+	t.Run("happy path - builds the network once for every report", func(t *testing.T) {
+		api := mock_report_api()
+		out := bytes.Buffer{}
+		if err := print_reports(api, PlanOptions{}, strings.NewReader("Alewife\nKenmore\n"), &out); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := golden(t, "reports/routes.txt", "reports/stop_data.txt", "reports/plan.txt")
+		if !bytes.Equal(expected, out.Bytes()) {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+		routes := api.ReturnRouteWrapper.Data
+		if !reflect.DeepEqual(routes, api.RecvRoutes) {
+			t.Errorf("expected %+v to be equal to %+v", routes, api.RecvRoutes)
+		}
+		if !reflect.DeepEqual(routes, api.RecvScheduleRoutes) {
+			t.Errorf("expected %+v to be equal to %+v", routes, api.RecvScheduleRoutes)
+		}
+	})
+
+	t.Run("sad path - stops after the routes when the stops can't be fetched", func(t *testing.T) {
+		api := mock_report_api()
+		api.ReturnStopWrapperError = errors.New("api is down")
+		out := bytes.Buffer{}
+		err := print_reports(api, PlanOptions{}, strings.NewReader("Alewife\nKenmore\n"), &out)
+
+		if err != api.ReturnStopWrapperError {
+			t.Errorf("expected error %s to be %s", api.ReturnStopWrapperError, err)
+		}
+		expected := golden(t, "reports/routes.txt")
+		if !bytes.Equal(expected, out.Bytes()) {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+		if len(api.RecvScheduleRoutes) != 0 {
+			t.Errorf("expected no schedules to be requested, got %+v", api.RecvScheduleRoutes)
+		}
+	})
+}
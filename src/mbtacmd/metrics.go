@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsRegistry is a small stand-in for a Prometheus client: counters, gauges and histograms with
+// labels, written out in the Prometheus text exposition format. Every method is safe to call on a nil
+// registry and does nothing, so code can be instrumented without caring whether anyone is collecting.
+type MetricsRegistry struct {
+	mutex   sync.Mutex
+	metrics []*metric
+	byName  map[string]*metric
+}
+
+type metric struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+	series     map[string]*metric_series
+}
+
+type metric_series struct {
+	labelValues  []string
+	value        float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func new_metrics_registry() *MetricsRegistry {
+	return &MetricsRegistry{
+		metrics: []*metric{},
+		byName:  map[string]*metric{},
+	}
+}
+
+// new_mbta_metrics_registry registers every metric the tool reports.
+func new_mbta_metrics_registry() *MetricsRegistry {
+	r := new_metrics_registry()
+	r.Register(metricCounter, "mbta_api_requests_total", "Requests made to the MBTA API, by endpoint and status code.", nil, "endpoint", "code")
+	r.Register(metricHistogram, "mbta_api_request_duration_seconds", "Latency of requests made to the MBTA API.", defaultLatencyBuckets, "endpoint")
+	r.Register(metricGauge, "mbta_api_ratelimit_limit", "The request limit the MBTA API last reported for this client.", nil)
+	r.Register(metricGauge, "mbta_api_ratelimit_remaining", "The requests the MBTA API last reported as remaining before rate-limiting.", nil)
+	r.Register(metricCounter, "mbtacmd_network_cache_requests_total", "Lookups of the cached route network, by whether they were a hit or a miss.", nil, "result")
+	r.Register(metricHistogram, "mbtacmd_planner_duration_seconds", "Time spent planning a trip.", defaultLatencyBuckets)
+	r.Register(metricCounter, "mbtacmd_http_requests_total", "Requests served, by path and status code.", nil, "path", "code")
+	return r
+}
+
+func (r *MetricsRegistry) Register(kind string, name string, help string, buckets []float64, labelNames ...string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := &metric{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*metric_series{},
+	}
+	r.metrics = append(r.metrics, m)
+	r.byName[name] = m
+}
+
+func (r *MetricsRegistry) Inc(name string, labelValues ...string) {
+	r.Add(name, 1, labelValues...)
+}
+
+func (r *MetricsRegistry) Add(name string, value float64, labelValues ...string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.series_for(name, labelValues).value += value
+}
+
+func (r *MetricsRegistry) Set(name string, value float64, labelValues ...string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.series_for(name, labelValues).value = value
+}
+
+func (r *MetricsRegistry) Observe(name string, value float64, labelValues ...string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.series_for(name, labelValues)
+	for i, bound := range r.byName[name].buckets {
+		if value <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// series_for must be called with the mutex held. Using a metric that was never registered, or with
+// the wrong number of labels, is a programming mistake rather than something to recover from.
+func (r *MetricsRegistry) series_for(name string, labelValues []string) *metric_series {
+	m, ok := r.byName[name]
+	if !ok {
+		panic(fmt.Sprintf("metric %s was not registered", name))
+	}
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s wants %d labels, got %d", name, len(m.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metric_series{
+			labelValues:  labelValues,
+			bucketCounts: make([]uint64, len(m.buckets)),
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (r *MetricsRegistry) write_text(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, m := range r.metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+
+		keys := []string{}
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := m.series[key]
+			labels := format_metric_labels(m.labelNames, s.labelValues)
+			if m.kind != metricHistogram {
+				fmt.Fprintf(w, "%s%s %s\n", m.name, wrap_metric_labels(labels), format_metric_value(s.value))
+				continue
+			}
+			for i, bound := range m.buckets {
+				bucketLabels := append(append([]string{}, labels...), fmt.Sprintf("le=%q", format_metric_value(bound)))
+				fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrap_metric_labels(bucketLabels), s.bucketCounts[i])
+			}
+			infLabels := append(append([]string{}, labels...), `le="+Inf"`)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrap_metric_labels(infLabels), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", m.name, wrap_metric_labels(labels), format_metric_value(s.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", m.name, wrap_metric_labels(labels), s.count)
+		}
+	}
+	return nil
+}
+
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.write_text(w)
+}
+
+func format_metric_labels(names []string, values []string) []string {
+	labels := []string{}
+	for i, name := range names {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, name, escaped))
+	}
+	return labels
+}
+
+func wrap_metric_labels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func format_metric_value(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MetricsRegistry(t *testing.T) {
+	t.Run("happy path - text exposition", func(t *testing.T) {
+		registry := new_metrics_registry()
+		registry.Register(metricCounter, "requests_total", "Requests.", nil, "code")
+		registry.Register(metricGauge, "remaining", "Remaining.", nil)
+		registry.Register(metricHistogram, "latency_seconds", "Latency.", []float64{0.1, 1})
+
+		registry.Inc("requests_total", "200")
+		registry.Add("requests_total", 2, "200")
+		registry.Inc("requests_total", `a "quoted" code`)
+		registry.Set("remaining", 10)
+		registry.Set("remaining", 7)
+		registry.Observe("latency_seconds", 0.05)
+		registry.Observe("latency_seconds", 0.5)
+		registry.Observe("latency_seconds", 3)
+
+		expected := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 3
+requests_total{code="a \"quoted\" code"} 1
+# HELP remaining Remaining.
+# TYPE remaining gauge
+remaining 7
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+`
+
+		out := &bytes.Buffer{}
+		if err := registry.write_text(out); err != nil {
+			t.Error("did not expect an error")
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - nil registry does nothing", func(t *testing.T) {
+		var registry *MetricsRegistry
+		registry.Inc("anything", "at", "all")
+		registry.Observe("anything", 1)
+		if err := registry.write_text(&bytes.Buffer{}); err != nil {
+			t.Error("did not expect an error")
+		}
+	})
+
+	t.Run("sad path - unregistered metric", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		new_metrics_registry().Inc("missing")
+	})
+
+	t.Run("sad path - wrong number of labels", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		registry := new_metrics_registry()
+		registry.Register(metricCounter, "requests_total", "Requests.", nil, "code")
+		registry.Inc("requests_total")
+	})
+}
+
+func Test_ConcreteMBTAWebServer_get_json_metrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-limit", "20")
+		w.Header().Set("x-ratelimit-remaining", "17")
+		if r.URL.Path == "/stops" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"data": [{"id": "Red", "attributes": {"long_name": "Red Line"}}]}`)
+	}))
+	defer upstream.Close()
+
+	metrics := new_mbta_metrics_registry()
+	api := ConcreteMBTAWebServer{Metrics: metrics}
+
+	wrapper := RouteWrapper{}
+	if err := api.get_json(upstream.URL+"/routes?filter[type]=0,1", &wrapper); err != nil {
+		t.Errorf("did not expect an error: %s", err)
+	}
+	if len(wrapper.Data) != 1 || wrapper.Data[0].Attribute.LongName != "Red Line" {
+		t.Errorf("expected the routes to be decoded, got %+v", wrapper)
+	}
+	if err := api.get_json(upstream.URL+"/stops?filter[route]=Red", &StopWrapper{}); err != ErrWebFailure {
+		t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+	}
+	if err := api.get_json("http://127.0.0.1:0/alerts", &AlertWrapper{}); err == nil {
+		t.Error("expected an error for an unreachable server")
+	}
+
+	out := &bytes.Buffer{}
+	metrics.write_text(out)
+	for _, expected := range []string{
+		`mbta_api_requests_total{endpoint="routes",code="200"} 1`,
+		`mbta_api_requests_total{endpoint="stops",code="429"} 1`,
+		`mbta_api_requests_total{endpoint="alerts",code="error"} 1`,
+		`mbta_api_request_duration_seconds_count{endpoint="routes"} 1`,
+		`mbta_api_ratelimit_limit 20`,
+		`mbta_api_ratelimit_remaining 17`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q to contain %q", out.String(), expected)
+		}
+	}
+}
+
+func Test_Server_metrics(t *testing.T) {
+	metrics := new_mbta_metrics_registry()
+	server := httptest.NewServer(new_server(mock_server_api(), time.Hour, metrics).handler())
+	defer server.Close()
+
+	for _, path := range []string{"/routes", "/plan?from=Alewife&to=Kenmore", "/plan?from=Alewife&to=Nowhere", "/not-a-thing"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, expected := range []string{
+		`mbtacmd_network_cache_requests_total{result="miss"} 1`,
+		`mbtacmd_network_cache_requests_total{result="hit"} 2`,
+		`mbtacmd_planner_duration_seconds_count 2`,
+		`mbtacmd_http_requests_total{path="/plan",code="200"} 1`,
+		`mbtacmd_http_requests_total{path="/plan",code="404"} 1`,
+		`mbtacmd_http_requests_total{path="other",code="404"} 1`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %q to contain %q", string(body), expected)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+// Network is everything we know about the heavy and light rail routes and the stops along them.
+// Building it takes one request for the routes and one per route for its stops, and with_schedules takes
+// one more per route, so anything answering more than one question (the REPL, for example) should build it
+// once and hold on to it.
+type Network struct {
+	Routes     []Route
+	Stops      []Stop
+	RouteStops map[Route][]Stop
+	StopRoutes map[Stop][]Route
+	// Schedules are each route's morning schedules, kept so that nothing else needs to ask for them again.
+	Schedules map[Route]ScheduleWrapper
+	// Branches are the runs of stops each route's trains actually make (see route_branches). A route's
+	// RouteStops are listed one branch after the other, so only the branches say which stops are next to
+	// each other.
+	Branches map[Route][][]Stop
+	// Times are worked out from the Schedules, for estimate_trip.
+	Times TravelTimes
+}
+
+// build_network is the routes and their stops, with the schedules, branches and travel times that
+// planning a trip needs.
+func build_network(api MBTAWebServer) (Network, error) {
+	network, err := build_route_network(api)
+	if err != nil {
+		return Network{}, err
+	}
+	return with_schedules(api, network)
+}
+
+// build_route_network is only the routes and their stops, for when counting stops is all that's needed.
+// Without schedules, each route is ridden as one run of its stops (see branches).
+func build_route_network(api MBTAWebServer) (Network, error) {
+	wrapper, err := get_heavy_and_light_routes(api)
+	if err != nil {
+		return Network{}, err
+	}
+
+	network := Network{
+		Routes:     wrapper.Data,
+		Stops:      []Stop{},
+		RouteStops: map[Route][]Stop{},
+		StopRoutes: map[Stop][]Route{},
+		Schedules:  map[Route]ScheduleWrapper{},
+		Branches:   map[Route][][]Stop{},
+	}
+
+	for _, route := range wrapper.Data {
+		stops, err := api.GetStops(route)
+		if err != nil {
+			return Network{}, err
+		}
+		network.RouteStops[route] = stops.Data
+		for _, stop := range stops.Data {
+			if _, ok := network.StopRoutes[stop]; !ok {
+				network.Stops = append(network.Stops, stop)
+			}
+			network.StopRoutes[stop] = append(network.StopRoutes[stop], route)
+		}
+	}
+
+	return network, nil
+}
+
+// with_schedules fetches the schedules of every route the network doesn't have them for yet, and works out
+// the branches and travel times from them. It leaves the network it was given as it was.
+func with_schedules(api MBTAWebServer, network Network) (Network, error) {
+	schedules := map[Route]ScheduleWrapper{}
+	branches := map[Route][][]Stop{}
+	for _, route := range network.Routes {
+		routeSchedules, ok := network.Schedules[route]
+		if !ok {
+			fetched, err := api.GetSchedules(route)
+			if err != nil {
+				return Network{}, err
+			}
+			routeSchedules = fetched
+		}
+		schedules[route] = routeSchedules
+		branches[route] = route_branches(network, route, routeSchedules)
+	}
+	network.Schedules = schedules
+	network.Branches = branches
+	network.Times = build_travel_times(schedules)
+	return network, nil
+}
+
+// branches are the runs of stops route's trains make, or all of its stops as one run for a network
+// built without schedules.
+func (n Network) branches(route Route) [][]Stop {
+	if branches := n.Branches[route]; len(branches) > 0 {
+		return branches
+	}
+	if stops := n.RouteStops[route]; len(stops) > 0 {
+		return [][]Stop{stops}
+	}
+	return [][]Stop{}
+}
+
+// route_schedules are the schedules the network was built with, or when it was built without them
+// (by hand, in the tests) one request for them.
+func route_schedules(api MBTAWebServer, network Network, route Route) (ScheduleWrapper, error) {
+	if schedules, ok := network.Schedules[route]; ok {
+		return schedules, nil
+	}
+	return api.GetSchedules(route)
+}
+
+func (n Network) find_stop_by_name(name string) (Stop, bool) {
+	for _, stop := range n.Stops {
+		if stop.Attribute.Name == name {
+			return stop, true
+		}
+	}
+	return Stop{}, false
+}
+
+func (n Network) find_route_by_name(name string) (Route, bool) {
+	for _, route := range n.Routes {
+		if route.Attribute.LongName == name || route.ID == name {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+func (n Network) find_route_by_id(id string) (Route, bool) {
+	for _, route := range n.Routes {
+		if route.ID == id {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+func (n Network) stop_names() []string {
+	names := []string{}
+	for _, stop := range n.Stops {
+		names = append(names, stop.Attribute.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n Network) route_names() []string {
+	names := []string{}
+	for _, route := range n.Routes {
+		names = append(names, route.Attribute.LongName)
+	}
+	return names
+}
+
+var (
+	ErrNoStop  = errors.New("could not find stop")
+	ErrNoRoute = errors.New("could not find route")
+)
+
+func routes_for_stop_names(network Network, startStopName string, endStopName string) ([]Route, error) {
+	itineraries, err := plan_place_names(network, startStopName, endStopName, default_plan_options())
+	if err != nil {
+		return nil, err
+	}
+	return itineraries[0].Routes(), nil
+}
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNoPath        = errors.New("no path between those stops")
+	ErrNoNearbyStops = errors.New("no stops within walking distance")
+)
+
+const (
+	// defaultMaxWalkMeters is far enough to walk between stations that share a concourse (Park Street and
+	// Downtown Crossing are about 250 meters apart) without suggesting a hike across town.
+	defaultMaxWalkMeters = 400.0
+	// defaultMaxAccessMeters is how far we'll walk to the first stop or from the last, which people put up
+	// with more readily than a walk in the middle of a trip.
+	defaultMaxAccessMeters = 800.0
+)
+
+type PlanOptions struct {
+	// MaxWalkMeters is the furthest we'll suggest walking between two stops, in a straight line.
+	// Zero turns walking off, leaving only transfers within a station.
+	MaxWalkMeters float64
+	// MaxAccessMeters is the furthest we'll walk from a starting coordinate or to an ending one.
+	MaxAccessMeters float64
+	// Geocoder turns addresses into coordinates. Without one, only stop names and coordinates work.
+	Geocoder Geocoder
+	// Accessible only gets on and off at stations a wheelchair can get through, going by Accessibility
+	// (see with_accessibility).
+	Accessible    bool
+	Accessibility Accessibility
+	// Alternatives is how many itineraries to plan, best first. Zero is the same as one.
+	Alternatives int
+	Preferences  Preferences
+	// TransferPenaltyMinutes is added to the estimated travel time for every change of route, on top of
+	// the wait for the next train (see estimate_trip).
+	TransferPenaltyMinutes float64
+	// Fares, when set, prices every itinerary (see load_fare_rules).
+	Fares *FareRules
+}
+
+func default_plan_options() PlanOptions {
+	return PlanOptions{
+		MaxWalkMeters:          defaultMaxWalkMeters,
+		MaxAccessMeters:        defaultMaxAccessMeters,
+		TransferPenaltyMinutes: defaultTransferPenaltyMinutes,
+	}
+}
+
+// Place is where a trip starts or ends: a stop, or a coordinate (perhaps geocoded from an address)
+// that we walk to or from the stops nearby.
+type Place struct {
+	Name       string
+	Stop       Stop
+	Coordinate Coordinate
+	IsStop     bool
+}
+
+// as_stop gives a coordinate Place a stand-in Stop, with no ID, so the planner can treat it like any
+// other stop that is only reachable on foot.
+func (p Place) as_stop() Stop {
+	if p.IsStop {
+		return p.Stop
+	}
+	return Stop{Attribute: StopAttribute{Name: p.Name, Latitude: p.Coordinate.Latitude, Longitude: p.Coordinate.Longitude}}
+}
+
+// resolve_place reads text as a stop name, then as a latitude,longitude pair, then as an address.
+func resolve_place(network Network, text string, geocoder Geocoder) (Place, error) {
+	if stop, ok := network.find_stop_by_name(text); ok {
+		return Place{Name: text, Stop: stop, IsStop: true}, nil
+	}
+	if coordinate, err := parse_coordinate(text); err == nil {
+		return Place{Name: text, Coordinate: coordinate}, nil
+	}
+	if geocoder == nil {
+		return Place{}, ErrNoAddress
+	}
+	coordinate, err := geocoder.Geocode(text)
+	if err != nil {
+		return Place{}, err
+	}
+	return Place{Name: text, Coordinate: coordinate}, nil
+}
+
+// Leg is one part of an Itinerary, either riding Route from one stop to another (Stops is how many
+// stops along), or walking between two nearby stops (Meters is how far, as the crow flies).
+type Leg struct {
+	Route Route
+	// Branch is which of the route's branches (see Network.branches) a ride is along, and Direction is the
+	// route's direction ID for it: 0 in the order the branch lists its stops, and 1 back the other way.
+	Branch    int
+	Direction int
+	Walk      bool
+	From      Stop
+	To        Stop
+	Stops     int
+	Meters    float64
+}
+
+type Itinerary struct {
+	Legs []Leg
+	// Rejected explains why we didn't take a quicker itinerary, when accessibility ruled it out.
+	Rejected []string
+	// Fares are what the itinerary costs every way it can be paid for, when we have fare data.
+	Fares []Fare
+}
+
+func (i Itinerary) Routes() []Route {
+	routes := []Route{}
+	for _, leg := range i.Legs {
+		if !leg.Walk {
+			routes = append(routes, leg.Route)
+		}
+	}
+	return routes
+}
+
+const (
+	// What estimate_trip guesses where there are no schedules to go on: a train every few minutes, a
+	// couple of minutes between stops, and walking at a bit under 5 km/h.
+	waitMinutesPerRide  = 5.0
+	rideMinutesPerStop  = 2.0
+	walkMetersPerMinute = 80.0
+)
+
+// Transfers is how many times we change from one route to another, which is one less than the rides.
+func (i Itinerary) Transfers() int {
+	return max(len(i.Routes())-1, 0)
+}
+
+func (i Itinerary) Stops() int {
+	stops := 0
+	for _, leg := range i.Legs {
+		stops += leg.Stops
+	}
+	return stops
+}
+
+// plan_cost orders itineraries by the fewest routes ridden, then the fewest stops along them, then the
+// estimated time (see estimate_trip). Walking never counts as a ride, so a short walk beats a transfer to
+// a second route. ExtraRides are what the preferences charge on top of the rides (see leg_penalty), and
+// rank along with them.
+type plan_cost struct {
+	Rides      int
+	ExtraRides int
+	Stops      int
+	Minutes    float64
+}
+
+func (c plan_cost) less(other plan_cost) bool {
+	if c.Rides+c.ExtraRides != other.Rides+other.ExtraRides {
+		return c.Rides+c.ExtraRides < other.Rides+other.ExtraRides
+	}
+	if c.Stops != other.Stops {
+		return c.Stops < other.Stops
+	}
+	return c.Minutes < other.Minutes
+}
+
+func (c plan_cost) add(leg Leg, estimate LegEstimate) plan_cost {
+	c.Minutes += estimate.TotalMinutes()
+	if !leg.Walk {
+		c.Rides++
+		c.Stops += leg.Stops
+	}
+	return c
+}
+
+// plan_state is a stop, and how we got there: on foot between stops, or on which route and branch. We
+// never walk between stops twice in a row, since a chain of short walks can add up to a long one, and never
+// get back on the same branch of the route we just got off, though changing branches (from an Ashmont
+// train to a Braintree one at JFK/UMass) is a transfer like any other. Via is how many of the stops the
+// preferences ask us to go via are behind us.
+type plan_state struct {
+	Stop   Stop
+	Walked bool
+	Route  Route
+	Branch int
+	Via    int
+}
+
+type plan_item struct {
+	State plan_state
+	Cost  plan_cost
+	// Order breaks ties between equal costs by which was found first, so the same network always
+	// gives the same itinerary.
+	Order int
+}
+
+// plan_queue orders items by less, which is plan_cost.less except when searching within a budget of
+// stops or minutes (see reachable_stops).
+type plan_queue struct {
+	items []plan_item
+	less  func(plan_cost, plan_cost) bool
+}
+
+func (q plan_queue) Len() int { return len(q.items) }
+func (q plan_queue) Less(i, j int) bool {
+	if q.items[i].Cost != q.items[j].Cost {
+		return q.less(q.items[i].Cost, q.items[j].Cost)
+	}
+	return q.items[i].Order < q.items[j].Order
+}
+func (q plan_queue) Swap(i, j int)       { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *plan_queue) Push(x interface{}) { q.items = append(q.items, x.(plan_item)) }
+func (q *plan_queue) Pop() interface{} {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
+
+// walking_transfers lists, for every stop with coordinates, the other stops within walking distance.
+func walking_transfers(network Network, maxMeters float64) map[Stop][]NearbyStop {
+	walks := map[Stop][]NearbyStop{}
+	if maxMeters <= 0 {
+		return walks
+	}
+
+	index := new_stop_index(network.Stops)
+	for _, stop := range network.Stops {
+		if !has_coordinates(stop) {
+			continue
+		}
+		for _, nearby := range index.Within(stop_coordinate(stop), maxMeters) {
+			if nearby.Stop != stop {
+				walks[stop] = append(walks[stop], nearby)
+			}
+		}
+	}
+	return walks
+}
+
+// ride_legs is every stop we can get to from stop by boarding one of the routes serving it, along each of
+// the route's branches the stop is on. Two stops on more than one branch (JFK/UMass and every stop north
+// of it, on the Red Line) are ridden between along the first branch that has them both.
+func ride_legs(network Network, stop Stop) []Leg {
+	legs := []Leg{}
+	for _, route := range network.StopRoutes[stop] {
+		reached := map[Stop]bool{stop: true}
+		for b, branch := range network.branches(route) {
+			boardAt := stop_position(branch, stop)
+			if boardAt < 0 {
+				continue
+			}
+			for i, branchStop := range branch {
+				if reached[branchStop] {
+					continue
+				}
+				reached[branchStop] = true
+				leg := Leg{Route: route, Branch: b, From: stop, To: branchStop, Stops: int(math.Abs(float64(i - boardAt)))}
+				if i < boardAt {
+					leg.Direction = 1
+				}
+				legs = append(legs, leg)
+			}
+		}
+	}
+	return legs
+}
+
+func stop_position(stops []Stop, stop Stop) int {
+	for i, other := range stops {
+		if other == stop {
+			return i
+		}
+	}
+	return -1
+}
+
+// leg_stops is every stop a leg visits, in the order it visits them, including the stops a ride only
+// passes through along the branch ride_legs found it on.
+func leg_stops(network Network, leg Leg) []Stop {
+	branches := network.branches(leg.Route)
+	if leg.Walk || leg.Branch >= len(branches) {
+		return []Stop{leg.From, leg.To}
+	}
+	branch := branches[leg.Branch]
+	boardAt, alightAt := stop_position(branch, leg.From), stop_position(branch, leg.To)
+	if boardAt < 0 || alightAt < 0 {
+		return []Stop{leg.From, leg.To}
+	}
+
+	stops := []Stop{}
+	step := 1
+	if alightAt < boardAt {
+		step = -1
+	}
+	for i := boardAt; i != alightAt+step; i += step {
+		stops = append(stops, branch[i])
+	}
+	return stops
+}
+
+// plan_itinerary finds the itinerary from start to end with the fewest routes, using Dijkstra's algorithm
+// over the stops, where each edge is either a ride along a route or a short walk to a nearby stop.
+func plan_itinerary(network Network, start Stop, end Stop, options PlanOptions) (Itinerary, error) {
+	return plan_places(network, Place{Stop: start, IsStop: true}, Place{Stop: end, IsStop: true}, options)
+}
+
+func plan_places(network Network, origin Place, destination Place, options PlanOptions) (Itinerary, error) {
+	options.Alternatives = 1
+	itineraries, err := plan_place_alternatives(network, origin, destination, options)
+	if err != nil {
+		return Itinerary{}, err
+	}
+	return itineraries[0], nil
+}
+
+// plan_place_alternatives plans up to options.Alternatives itineraries between two places, best first.
+// A coordinate place is joined to the network by walks to (or from) every stop within MaxAccessMeters,
+// and directly to the other place if that is close enough.
+func plan_place_alternatives(network Network, origin Place, destination Place, options PlanOptions) ([]Itinerary, error) {
+	graph, err := new_plan_graph(network, options)
+	if err != nil {
+		return nil, err
+	}
+	start, end := origin.as_stop(), destination.as_stop()
+
+	index := new_stop_index(network.Stops)
+	if !origin.IsStop {
+		access := index.Within(origin.Coordinate, options.MaxAccessMeters)
+		if len(access) == 0 {
+			return nil, ErrNoNearbyStops
+		}
+		graph.placeWalks[start] = access
+		graph.places[start] = true
+	}
+	if !destination.IsStop {
+		egress := index.Within(destination.Coordinate, options.MaxAccessMeters)
+		if len(egress) == 0 {
+			return nil, ErrNoNearbyStops
+		}
+		for _, nearby := range egress {
+			graph.placeWalks[nearby.Stop] = append(graph.placeWalks[nearby.Stop], NearbyStop{Stop: end, Meters: nearby.Meters})
+		}
+		graph.places[end] = true
+	}
+	// When only one end is a coordinate, walking straight there is already one of the walks above.
+	if !origin.IsStop && !destination.IsStop {
+		if meters := haversine_meters(origin.Coordinate, destination.Coordinate); meters <= options.MaxAccessMeters {
+			graph.placeWalks[start] = append(graph.placeWalks[start], NearbyStop{Stop: end, Meters: meters})
+		}
+	}
+
+	var itineraries []Itinerary
+	if options.Accessible {
+		itineraries, err = accessible_alternatives(graph, start, end, options)
+	} else {
+		itineraries, err = graph.alternatives(start, end, max(options.Alternatives, 1))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.Fares != nil {
+		for i := range itineraries {
+			estimate := estimate_trip(network, itineraries[i], options.TransferPenaltyMinutes)
+			itineraries[i].Fares = options.Fares.itinerary_fares(itineraries[i], estimate)
+		}
+	}
+	return itineraries, nil
+}
+
+// accessible_alternatives plans around the stations a wheelchair can't use, and then plans again without
+// that restriction, so it can say which stations ruled out a better itinerary (or any itinerary at all).
+func accessible_alternatives(graph plan_graph, start Stop, end Stop, options PlanOptions) ([]Itinerary, error) {
+	restricted := graph
+	restricted.blocked = options.Accessibility.blocked_stops(graph.network)
+	itineraries, err := restricted.alternatives(start, end, max(options.Alternatives, 1))
+	if err != nil && err != ErrNoPath {
+		return nil, err
+	}
+
+	unrestricted, unrestrictedErr := graph.shortest(plan_item{State: plan_state{Stop: start}}, end, nil, nil)
+	if unrestrictedErr != nil {
+		return nil, unrestrictedErr
+	}
+	reasons := rejection_reasons(unrestricted, restricted.blocked)
+	if err == ErrNoPath {
+		return nil, fmt.Errorf("%w: %s", ErrNoAccessiblePath, strings.Join(reasons, "; "))
+	}
+	if len(reasons) > 0 {
+		for i := range itineraries {
+			itineraries[i].Rejected = reasons
+		}
+	}
+	return itineraries, nil
+}
+
+// plan_graph is the network as the planner sees it: rides along routes, walks between nearby stops,
+// the stops we can't get on or off at (though we can ride through them), and the preferences that
+// rule out or penalize some of those. Walks from a starting coordinate and to an ending one are kept
+// apart from the walks between stops, as placeWalks, since walking to the first stop or from the last
+// isn't a transfer, and either kind of walk can follow the other.
+type plan_graph struct {
+	network     Network
+	walks       map[Stop][]NearbyStop
+	placeWalks  map[Stop][]NearbyStop
+	places      map[Stop]bool
+	blocked     map[Stop]string
+	preferences plan_preferences
+	// transferPenalty is PlanOptions.TransferPenaltyMinutes, for estimating the time of every leg.
+	transferPenalty float64
+}
+
+func new_plan_graph(network Network, options PlanOptions) (plan_graph, error) {
+	preferences, err := resolve_preferences(network, options.Preferences)
+	if err != nil {
+		return plan_graph{}, err
+	}
+	return plan_graph{
+		network:         network,
+		walks:           walking_transfers(network, options.MaxWalkMeters),
+		placeWalks:      map[Stop][]NearbyStop{},
+		places:          map[Stop]bool{},
+		preferences:     preferences,
+		transferPenalty: options.TransferPenaltyMinutes,
+	}, nil
+}
+
+// step takes a leg from where we are, to where the leg goes and what it cost to get there.
+func (g plan_graph) step(from plan_item, leg Leg) plan_item {
+	cost := from.Cost.add(leg, estimate_leg(g.network, leg, !leg.Walk && from.Cost.Rides > 0, g.transferPenalty))
+	rides, stops := g.preferences.leg_penalty(leg)
+	cost.ExtraRides += rides
+	cost.Stops += stops
+	return plan_item{
+		State: plan_state{Stop: leg.To, Walked: g.transfer_walk(leg), Route: leg.Route, Branch: leg.Branch, Via: g.preferences.passed_via(g.network, from.State.Via, leg)},
+		Cost:  cost,
+	}
+}
+
+func (g plan_graph) itinerary_cost(start Stop, itinerary Itinerary) plan_cost {
+	item := plan_item{State: plan_state{Stop: start}}
+	for _, leg := range itinerary.Legs {
+		item = g.step(item, leg)
+	}
+	return item.Cost
+}
+
+// alternatives finds up to count itineraries from start to end, best first, with Yen's algorithm: each
+// next best itinerary branches off one we already have at one of its stops, so for every stop along the
+// last one found we look for the best way on from there that doesn't repeat a branch already taken.
+func (g plan_graph) alternatives(start Stop, end Stop, count int) ([]Itinerary, error) {
+	first, err := g.shortest(plan_item{State: plan_state{Stop: start}}, end, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []Itinerary{first}
+	candidates := []Itinerary{}
+	for len(found) < count {
+		last := found[len(found)-1]
+		for i := range last.Legs {
+			root := last.Legs[:i]
+			spur := plan_item{State: plan_state{Stop: start}}
+			for _, leg := range root {
+				spur = g.step(spur, leg)
+			}
+
+			removedLegs := map[Leg]bool{}
+			for _, itinerary := range found {
+				if len(itinerary.Legs) > i && legs_equal(itinerary.Legs[:i], root) {
+					removedLegs[itinerary.Legs[i]] = true
+				}
+			}
+			// The root's stops are behind us, so going back through them would be a loop.
+			removedStops := map[Stop]bool{}
+			for _, leg := range root {
+				removedStops[leg.From] = true
+			}
+
+			rest, err := g.shortest(spur, end, removedStops, removedLegs)
+			if err != nil {
+				continue
+			}
+			candidate := Itinerary{Legs: append(append([]Leg{}, root...), rest.Legs...)}
+			if !contains_itinerary(found, candidate) && !contains_itinerary(candidates, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return g.itinerary_cost(start, candidates[i]).less(g.itinerary_cost(start, candidates[j]))
+		})
+		found = append(found, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	return found, nil
+}
+
+func legs_equal(a []Leg, b []Leg) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func contains_itinerary(itineraries []Itinerary, itinerary Itinerary) bool {
+	for _, other := range itineraries {
+		if legs_equal(other.Legs, itinerary.Legs) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortest is Dijkstra's algorithm from the given state and the cost of getting there, never getting on
+// or off at a blocked stop, and leaving out the removed stops and legs (which only the search for
+// alternatives removes). It only arrives at end once every via stop is behind it.
+func (g plan_graph) shortest(from plan_item, end Stop, removedStops map[Stop]bool, removedLegs map[Leg]bool) (Itinerary, error) {
+	if _, ok := g.blocked[from.State.Stop]; ok {
+		return Itinerary{}, ErrNoPath
+	}
+
+	best := map[plan_state]plan_cost{from.State: from.Cost}
+	previous := map[plan_state]plan_state{}
+	previousLeg := map[plan_state]Leg{}
+	done := map[plan_state]bool{}
+
+	queue := &plan_queue{items: []plan_item{from}, less: plan_cost.less}
+	order := 1
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(plan_item)
+		if done[item.State] {
+			continue
+		}
+		done[item.State] = true
+
+		if item.State.Stop == end && item.State.Via == len(g.preferences.via) {
+			return trace_itinerary(from.State, item.State, previous, previousLeg), nil
+		}
+
+		for _, leg := range g.next_legs(item.State) {
+			if removedStops[leg.To] || removedLegs[leg] {
+				continue
+			}
+			next := g.step(item, leg)
+			if !g.preferences.allows_rides(next.Cost.Rides) {
+				continue
+			}
+			if cost, ok := best[next.State]; ok && !next.Cost.less(cost) {
+				continue
+			}
+			best[next.State] = next.Cost
+			previous[next.State] = item.State
+			previousLeg[next.State] = leg
+			next.Order = order
+			heap.Push(queue, next)
+			order++
+		}
+	}
+
+	return Itinerary{}, ErrNoPath
+}
+
+// transfer_walk is whether a leg is a walk between two stops, rather than from or to a coordinate place.
+func (g plan_graph) transfer_walk(leg Leg) bool {
+	return leg.Walk && !g.places[leg.From] && !g.places[leg.To]
+}
+
+// next_legs are the rides and walks on from a state, leaving out the avoided routes and the blocked stops.
+func (g plan_graph) next_legs(state plan_state) []Leg {
+	legs := []Leg{}
+	for _, leg := range ride_legs(g.network, state.Stop) {
+		sameBranch := leg.Route == state.Route && leg.Branch == state.Branch
+		if _, ok := g.blocked[leg.To]; !ok && !sameBranch && !g.preferences.avoid[leg.Route] {
+			legs = append(legs, leg)
+		}
+	}
+	if !state.Walked {
+		for _, nearby := range g.walks[state.Stop] {
+			if _, ok := g.blocked[nearby.Stop]; !ok {
+				legs = append(legs, Leg{Walk: true, From: state.Stop, To: nearby.Stop, Meters: nearby.Meters})
+			}
+		}
+	}
+	for _, nearby := range g.placeWalks[state.Stop] {
+		if _, ok := g.blocked[nearby.Stop]; !ok {
+			legs = append(legs, Leg{Walk: true, From: state.Stop, To: nearby.Stop, Meters: nearby.Meters})
+		}
+	}
+	return legs
+}
+
+func trace_itinerary(start plan_state, end plan_state, previous map[plan_state]plan_state, previousLeg map[plan_state]Leg) Itinerary {
+	legs := []Leg{}
+	for state := end; state != start; state = previous[state] {
+		legs = append([]Leg{previousLeg[state]}, legs...)
+	}
+	return Itinerary{Legs: legs}
+}
+
+// plan_place_names plans between two stop names, coordinates or addresses, returning as many
+// alternative itineraries as options asks for (and at least one), best first.
+func plan_place_names(network Network, startName string, endName string, options PlanOptions) ([]Itinerary, error) {
+	origin, err := resolve_place(network, startName, options.Geocoder)
+	if err == ErrNoAddress {
+		return nil, ErrNoStartStop
+	}
+	if err != nil {
+		return nil, err
+	}
+	destination, err := resolve_place(network, endName, options.Geocoder)
+	if err == ErrNoAddress {
+		return nil, ErrNoEndStop
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return plan_place_alternatives(network, origin, destination, options)
+}
+
+func print_itinerary(out io.Writer, startStopName string, endStopName string, itinerary Itinerary) {
+	if len(itinerary.Legs) == 0 {
+		fmt.Fprintf(out, "The path from %s to %s is to take no routes, as they are the same path.\n", startStopName, endStopName)
+		return
+	}
+
+	fmt.Fprintf(out, "Take the following routes to get from %s to %s:\n", startStopName, endStopName)
+	print_legs(out, "", itinerary.Legs)
+	print_fares(out, "", itinerary.Fares)
+	print_rejected(out, itinerary.Rejected)
+}
+
+// print_itineraries prints a lone itinerary the way print_itinerary always has, and otherwise numbers
+// them with a summary of each, taking the time from its estimate.
+func print_itineraries(out io.Writer, startStopName string, endStopName string, itineraries []Itinerary, estimates []TripEstimate) {
+	if len(itineraries) == 1 {
+		print_itinerary(out, startStopName, endStopName, itineraries[0])
+		return
+	}
+
+	fmt.Fprintf(out, "%d ways to get from %s to %s:\n", len(itineraries), startStopName, endStopName)
+	for i, itinerary := range itineraries {
+		fmt.Fprintf(out, "%d. %s\n", i+1, itinerary_summary(itinerary, estimates[i]))
+		print_legs(out, "   ", itinerary.Legs)
+		print_fares(out, "   ", itinerary.Fares)
+	}
+	print_rejected(out, itineraries[0].Rejected)
+}
+
+func itinerary_summary(itinerary Itinerary, estimate TripEstimate) string {
+	transfers := "no transfers"
+	if count := itinerary.Transfers(); count == 1 {
+		transfers = "1 transfer"
+	} else if count > 1 {
+		transfers = fmt.Sprintf("%d transfers", count)
+	}
+	return fmt.Sprintf("%s, %d stops, about %.0f min", transfers, itinerary.Stops(), estimate.TotalMinutes())
+}
+
+func print_legs(out io.Writer, indent string, legs []Leg) {
+	for _, leg := range legs {
+		if leg.Walk {
+			fmt.Fprintf(out, "%sWalk from %s to %s (%.0f m)\n", indent, leg.From.Attribute.Name, leg.To.Attribute.Name, leg.Meters)
+		} else {
+			fmt.Fprintf(out, "%s%s\n", indent, ride_description(leg))
+		}
+	}
+}
+
+// leg_destination is where the route is headed in the direction of the leg, e.g. "Alewife" for the Red
+// Line northbound, or empty when the route didn't come with its destinations.
+func leg_destination(leg Leg) string {
+	if leg.Walk || leg.Direction < 0 || leg.Direction >= len(leg.Route.Attribute.DirectionDestinations) {
+		return ""
+	}
+	return leg.Route.Attribute.DirectionDestinations[leg.Direction]
+}
+
+// ride_description is "Take the Red Line toward Alewife", or just the route's name when we don't know
+// where it is headed.
+func ride_description(leg Leg) string {
+	if destination := leg_destination(leg); destination != "" {
+		return fmt.Sprintf("Take the %s toward %s", leg.Route.Attribute.LongName, destination)
+	}
+	return leg.Route.Attribute.LongName
+}
+
+func print_rejected(out io.Writer, rejected []string) {
+	if len(rejected) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "This avoids a quicker trip through stations that are not accessible:")
+	for _, reason := range rejected {
+		fmt.Fprintf(out, "  %s\n", reason)
+	}
+}
+
+func print_nearby_stops(out io.Writer, network Network, nearby []NearbyStop) {
+	for _, stop := range nearby {
+		fmt.Fprintf(out, "%s (%.0f m): %s\n", stop.Stop.Attribute.Name, stop.Meters, build_route_list_name(network.StopRoutes[stop.Stop]))
+	}
+}
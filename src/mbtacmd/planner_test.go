@@ -0,0 +1,933 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mock_walking_network has no route through from Kenmore to State, but Park Street and Downtown Crossing
+// are a short walk apart, as they are in real life.
+func mock_walking_network() Network {
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	orange := Route{ID: "Orange", Attribute: RouteAttribute{LongName: "Orange Line"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore", Latitude: 42.348949, Longitude: -71.095169}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street", Latitude: 42.356395, Longitude: -71.062424}}
+	downtown := Stop{ID: "place-dwnxg", Attribute: StopAttribute{Name: "Downtown Crossing", Latitude: 42.355518, Longitude: -71.060225}}
+	state := Stop{ID: "place-state", Attribute: StopAttribute{Name: "State", Latitude: 42.358978, Longitude: -71.057598}}
+
+	return Network{
+		Routes: []Route{green, orange},
+		Stops:  []Stop{kenmore, park, downtown, state},
+		RouteStops: map[Route][]Stop{
+			green:  []Stop{kenmore, park},
+			orange: []Stop{downtown, state},
+		},
+		StopRoutes: map[Stop][]Route{
+			kenmore:  []Route{green},
+			park:     []Route{green},
+			downtown: []Route{orange},
+			state:    []Route{orange},
+		},
+	}
+}
+
+func Test_plan_itinerary(t *testing.T) {
+	t.Run("happy path - same start and end", func(t *testing.T) {
+		stop := Stop{ID: "stop id 1"}
+		network := Network{
+			Stops:      []Stop{stop},
+			RouteStops: map[Route][]Stop{},
+			StopRoutes: map[Stop][]Route{},
+		}
+
+		expected := Itinerary{Legs: []Leg{}}
+
+		found, err := plan_itinerary(network, stop, stop, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+		if !reflect.DeepEqual([]Route{}, found.Routes()) {
+			t.Errorf("expected %+v to be empty", found.Routes())
+		}
+	})
+
+	t.Run("happy path - on same route", func(t *testing.T) {
+		route := Route{ID: "route id 1"}
+		stop1 := Stop{ID: "stop id 1"}
+		stop2 := Stop{ID: "stop id 2"}
+		network := Network{
+			Routes:     []Route{route},
+			Stops:      []Stop{stop1, stop2},
+			RouteStops: map[Route][]Stop{route: []Stop{stop1, stop2}},
+			StopRoutes: map[Stop][]Route{stop1: []Route{route}, stop2: []Route{route}},
+		}
+
+		expected := Itinerary{Legs: []Leg{{Route: route, From: stop1, To: stop2, Stops: 1}}}
+
+		found, err := plan_itinerary(network, stop1, stop2, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - one route hop", func(t *testing.T) {
+		route1 := Route{ID: "route id 1"}
+		route2 := Route{ID: "route id 2"}
+		stop1 := Stop{ID: "stop id 1"}
+		stop2 := Stop{ID: "stop id 2"}
+		stop3 := Stop{ID: "stop id 3"}
+		network := Network{
+			Routes: []Route{route1, route2},
+			Stops:  []Stop{stop1, stop2, stop3},
+			RouteStops: map[Route][]Stop{
+				route1: []Stop{stop1, stop2},
+				route2: []Stop{stop2, stop3},
+			},
+			StopRoutes: map[Stop][]Route{
+				stop1: []Route{route1},
+				stop2: []Route{route1, route2},
+				stop3: []Route{route2},
+			},
+		}
+
+		expected := []Route{route1, route2}
+
+		found, err := plan_itinerary(network, stop1, stop3, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("happy path - fewest routes rather than first found", func(t *testing.T) {
+		route1 := Route{ID: "route id 1"}
+		route2 := Route{ID: "route id 2"}
+		route3 := Route{ID: "route id 3"}
+		stop1 := Stop{ID: "stop id 1"}
+		stop2 := Stop{ID: "stop id 2"}
+		stop3 := Stop{ID: "stop id 3"}
+		network := Network{
+			Routes: []Route{route1, route2, route3},
+			Stops:  []Stop{stop1, stop2, stop3},
+			RouteStops: map[Route][]Stop{
+				route1: []Stop{stop1, stop2},
+				route2: []Stop{stop2, stop3},
+				route3: []Stop{stop1, stop2, stop3},
+			},
+			StopRoutes: map[Stop][]Route{
+				stop1: []Route{route1, route3},
+				stop2: []Route{route1, route2, route3},
+				stop3: []Route{route2, route3},
+			},
+		}
+
+		expected := Itinerary{Legs: []Leg{{Route: route3, From: stop1, To: stop3, Stops: 2}}}
+
+		found, err := plan_itinerary(network, stop1, stop3, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - walking transfer", func(t *testing.T) {
+		network := mock_walking_network()
+		kenmore, park, downtown, state := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3]
+
+		expected := Itinerary{Legs: []Leg{
+			{Route: network.Routes[0], From: kenmore, To: park, Stops: 1},
+			{Walk: true, From: park, To: downtown, Meters: haversine_meters(stop_coordinate(park), stop_coordinate(downtown))},
+			{Route: network.Routes[1], From: downtown, To: state, Stops: 1},
+		}}
+
+		found, err := plan_itinerary(network, kenmore, state, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("sad path - walking turned off", func(t *testing.T) {
+		network := mock_walking_network()
+
+		_, err := plan_itinerary(network, network.Stops[0], network.Stops[3], PlanOptions{})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("sad path - walk too far", func(t *testing.T) {
+		network := mock_walking_network()
+
+		_, err := plan_itinerary(network, network.Stops[0], network.Stops[3], PlanOptions{MaxWalkMeters: 100})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("sad path - one route hop - missing stop 2 route 2 connection", func(t *testing.T) {
+		route1 := Route{ID: "route id 1"}
+		route2 := Route{ID: "route id 2"}
+		stop1 := Stop{ID: "stop id 1"}
+		stop2 := Stop{ID: "stop id 2"}
+		stop3 := Stop{ID: "stop id 3"}
+		network := Network{
+			Routes: []Route{route1, route2},
+			Stops:  []Stop{stop1, stop2, stop3},
+			RouteStops: map[Route][]Stop{
+				route1: []Stop{stop1, stop2},
+				route2: []Stop{stop2, stop3},
+			},
+			StopRoutes: map[Stop][]Route{
+				stop1: []Route{route1},
+				stop2: []Route{route1},
+				stop3: []Route{route2},
+			},
+		}
+
+		_, err := plan_itinerary(network, stop1, stop3, default_plan_options())
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("happy path - along one branch", func(t *testing.T) {
+		network := mock_branching_network()
+		red := network.Routes[0]
+		alewife, ashmont := network.Stops[0], network.Stops[3]
+
+		expected := Itinerary{Legs: []Leg{{Route: red, Branch: 1, From: alewife, To: ashmont, Stops: 3}}}
+
+		found, err := plan_itinerary(network, alewife, ashmont, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - changing branches where they split", func(t *testing.T) {
+		// The API lists Ashmont right before North Quincy, but no train runs between them.
+		network := mock_branching_network()
+		red := network.Routes[0]
+		jfk, ashmont, quincy := network.Stops[1], network.Stops[3], network.Stops[4]
+
+		expected := Itinerary{Legs: []Leg{
+			{Route: red, Branch: 1, Direction: 1, From: ashmont, To: jfk, Stops: 2},
+			{Route: red, Branch: 0, From: jfk, To: quincy, Stops: 1},
+		}}
+
+		found, err := plan_itinerary(network, ashmont, quincy, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func Test_leg_stops(t *testing.T) {
+	network := mock_rail_network()
+	heavy := network.Routes[1]
+	start, end, first, second := network.Stops[0], network.Stops[1], network.Stops[3], network.Stops[4]
+
+	t.Run("happy path - against the route's direction", func(t *testing.T) {
+		expected := []Stop{end, second, first}
+
+		found := leg_stops(network, Leg{Route: heavy, From: end, To: first, Stops: 2})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - along a branch", func(t *testing.T) {
+		network := mock_branching_network()
+		red := network.Routes[0]
+		alewife, jfk, savin, ashmont, quincy, braintree := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3], network.Stops[4], network.Stops[5]
+
+		expected := []Stop{alewife, jfk, quincy, braintree}
+		found := leg_stops(network, Leg{Route: red, From: alewife, To: braintree, Stops: 3})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+
+		expected = []Stop{ashmont, savin, jfk}
+		found = leg_stops(network, Leg{Route: red, Branch: 1, Direction: 1, From: ashmont, To: jfk, Stops: 2})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - a walk", func(t *testing.T) {
+		expected := []Stop{start, end}
+
+		found := leg_stops(network, Leg{Walk: true, From: start, To: end, Meters: 100})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func Test_print_itinerary(t *testing.T) {
+	t.Run("happy path - rides and a walk", func(t *testing.T) {
+		network := mock_walking_network()
+		itinerary, err := plan_itinerary(network, network.Stops[0], network.Stops[3], default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `Take the following routes to get from Kenmore to State:
+Green Line B
+Walk from Park Street to Downtown Crossing (205 m)
+Orange Line
+`
+
+		out := &bytes.Buffer{}
+		print_itinerary(out, "Kenmore", "State", itinerary)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - toward the route's destination", func(t *testing.T) {
+		network := mock_branching_network()
+		alewife, jfk, braintree := network.Stops[0], network.Stops[1], network.Stops[5]
+
+		expected := "Take the following routes to get from JFK/UMass to Alewife:\nTake the Red Line toward Alewife\n"
+		itinerary, err := plan_itinerary(network, jfk, alewife, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		out := &bytes.Buffer{}
+		print_itinerary(out, "JFK/UMass", "Alewife", itinerary)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+
+		expected = "Take the following routes to get from JFK/UMass to Braintree:\nTake the Red Line toward Ashmont/Braintree\n"
+		itinerary, err = plan_itinerary(network, jfk, braintree, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		out = &bytes.Buffer{}
+		print_itinerary(out, "JFK/UMass", "Braintree", itinerary)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - same stop", func(t *testing.T) {
+		expected := "The path from Kenmore to Kenmore is to take no routes, as they are the same path.\n"
+
+		out := &bytes.Buffer{}
+		print_itinerary(out, "Kenmore", "Kenmore", Itinerary{Legs: []Leg{}})
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+}
+
+func Test_plan_places(t *testing.T) {
+	network := mock_walking_network()
+	kenmore, park, downtown, state := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3]
+
+	t.Run("happy path - coordinate to coordinate", func(t *testing.T) {
+		// The corner of Boston Common, a short walk from Downtown Crossing, to Faneuil Hall, a short walk
+		// from State. Park Street is close too, but walking on from there to Downtown Crossing is further
+		// than walking straight there.
+		origin := Place{Name: "42.3547,-71.0615", Coordinate: Coordinate{Latitude: 42.3547, Longitude: -71.0615}}
+		destination := Place{Name: "42.3600,-71.0560", Coordinate: Coordinate{Latitude: 42.3600, Longitude: -71.0560}}
+		options := PlanOptions{MaxWalkMeters: 400, MaxAccessMeters: 300}
+
+		found, err := plan_places(network, origin, destination, options)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := Itinerary{Legs: []Leg{
+			{Walk: true, From: origin.as_stop(), To: downtown, Meters: haversine_meters(origin.Coordinate, stop_coordinate(downtown))},
+			{Route: network.Routes[1], From: downtown, To: state, Stops: 1},
+			{Walk: true, From: state, To: destination.as_stop(), Meters: haversine_meters(stop_coordinate(state), destination.Coordinate)},
+		}}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - a transfer walk after walking to the first stop", func(t *testing.T) {
+		// Only Park Street is close enough to walk to, and its Green Line doesn't go to State.
+		origin := Place{Name: "42.3566,-71.0626", Coordinate: Coordinate{Latitude: 42.3566, Longitude: -71.0626}}
+		destination := Place{Name: "State", Stop: state, IsStop: true}
+		options := PlanOptions{MaxWalkMeters: 400, MaxAccessMeters: 100}
+
+		found, err := plan_places(network, origin, destination, options)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := Itinerary{Legs: []Leg{
+			{Walk: true, From: origin.as_stop(), To: park, Meters: haversine_meters(origin.Coordinate, stop_coordinate(park))},
+			{Walk: true, From: park, To: downtown, Meters: haversine_meters(stop_coordinate(park), stop_coordinate(downtown))},
+			{Route: network.Routes[1], From: downtown, To: state, Stops: 1},
+		}}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - walking to the destination after a transfer walk", func(t *testing.T) {
+		// Only Downtown Crossing is close enough to walk from, and the Orange Line doesn't go to Kenmore.
+		origin := Place{Name: "Kenmore", Stop: kenmore, IsStop: true}
+		destination := Place{Name: "42.3553,-71.0601", Coordinate: Coordinate{Latitude: 42.3553, Longitude: -71.0601}}
+		options := PlanOptions{MaxWalkMeters: 400, MaxAccessMeters: 100}
+
+		found, err := plan_places(network, origin, destination, options)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := Itinerary{Legs: []Leg{
+			{Route: network.Routes[0], From: kenmore, To: park, Stops: 1},
+			{Walk: true, From: park, To: downtown, Meters: haversine_meters(stop_coordinate(park), stop_coordinate(downtown))},
+			{Walk: true, From: downtown, To: destination.as_stop(), Meters: haversine_meters(stop_coordinate(downtown), destination.Coordinate)},
+		}}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - close enough to just walk", func(t *testing.T) {
+		origin := Place{Name: "here", Coordinate: stop_coordinate(park)}
+		destination := Place{Name: "there", Coordinate: stop_coordinate(downtown)}
+
+		found, err := plan_places(network, origin, destination, default_plan_options())
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		expected := Itinerary{Legs: []Leg{{Walk: true, From: origin.as_stop(), To: destination.as_stop(), Meters: haversine_meters(origin.Coordinate, destination.Coordinate)}}}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - stop to coordinate", func(t *testing.T) {
+		origin := Place{Name: "Kenmore", Stop: kenmore, IsStop: true}
+		destination := Place{Name: "State Street", Coordinate: Coordinate{Latitude: 42.3592, Longitude: -71.0570}}
+		options := PlanOptions{MaxWalkMeters: 400, MaxAccessMeters: 300}
+
+		found, err := plan_places(network, origin, destination, options)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		last := found.Legs[len(found.Legs)-1]
+		expectedLast := Leg{Walk: true, From: state, To: destination.as_stop(), Meters: haversine_meters(stop_coordinate(state), destination.Coordinate)}
+		if !reflect.DeepEqual(expectedLast, last) {
+			t.Errorf("expected %+v to be equal to %+v", expectedLast, last)
+		}
+		if !reflect.DeepEqual([]Route{network.Routes[0], network.Routes[1]}, found.Routes()) {
+			t.Errorf("expected to ride Green Line B and Orange Line, got %+v", found.Routes())
+		}
+	})
+
+	t.Run("sad path - nowhere near a stop", func(t *testing.T) {
+		origin := Place{Name: "Provincetown", Coordinate: Coordinate{Latitude: 42.0584, Longitude: -70.1787}}
+		destination := Place{Name: "State", Stop: state, IsStop: true}
+
+		_, err := plan_places(network, origin, destination, default_plan_options())
+		if err != ErrNoNearbyStops {
+			t.Errorf("expected error %s to be %s", err, ErrNoNearbyStops)
+		}
+	})
+}
+
+func Test_plan_place_names(t *testing.T) {
+	network := mock_walking_network()
+	options := PlanOptions{MaxWalkMeters: 400, MaxAccessMeters: 300}
+	options.Geocoder = FileGeocoder{Addresses: map[string]Coordinate{"1 city hall square": {Latitude: 42.3603, Longitude: -71.0580}}}
+
+	t.Run("happy path - address", func(t *testing.T) {
+		found, err := plan_place_names(network, "Kenmore", "1 City Hall  Square", options)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		last := found[0].Legs[len(found[0].Legs)-1]
+		if !last.Walk || last.From.Attribute.Name != "State" || last.To.Attribute.Name != "1 City Hall  Square" {
+			t.Errorf("expected to walk from State to the address, got %+v", last)
+		}
+	})
+
+	t.Run("sad path - unknown start", func(t *testing.T) {
+		_, err := plan_place_names(network, "Nowhere", "Kenmore", options)
+		if err != ErrNoStartStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoStartStop)
+		}
+	})
+
+	t.Run("sad path - unknown end without a geocoder", func(t *testing.T) {
+		_, err := plan_place_names(network, "Kenmore", "1 City Hall Square", default_plan_options())
+		if err != ErrNoEndStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoEndStop)
+		}
+	})
+}
+
+func Test_plan_alternatives(t *testing.T) {
+	network := mock_accessibility_network()
+	red, green, orange, greenE := network.Routes[0], network.Routes[1], network.Routes[2], network.Routes[3]
+	alewife, park, kenmore, haymarket := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3]
+
+	t.Run("happy path - every way there", func(t *testing.T) {
+		expected := []Itinerary{
+			{Legs: []Leg{{Route: red, From: alewife, To: park, Stops: 1}, {Route: green, From: park, To: kenmore, Stops: 1}}},
+			{Legs: []Leg{{Route: orange, From: alewife, To: haymarket, Stops: 1}, {Route: greenE, From: haymarket, To: kenmore, Stops: 1}}},
+		}
+
+		found, err := plan_place_alternatives(network, Place{Stop: alewife, IsStop: true}, Place{Stop: kenmore, IsStop: true}, PlanOptions{Alternatives: 5})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - ranked by transfers first", func(t *testing.T) {
+		// A direct route that stops everywhere still beats two quick ones.
+		slow := Route{ID: "slow", Attribute: RouteAttribute{LongName: "Slow Line"}}
+		stops := []Stop{alewife}
+		for i := 0; i < 10; i++ {
+			stops = append(stops, Stop{ID: fmt.Sprintf("local %d", i)})
+		}
+		stops = append(stops, kenmore)
+		network := mock_accessibility_network()
+		network.Routes = append(network.Routes, slow)
+		network.RouteStops[slow] = stops
+		network.StopRoutes[alewife] = append(network.StopRoutes[alewife], slow)
+		network.StopRoutes[kenmore] = append(network.StopRoutes[kenmore], slow)
+
+		found, err := plan_place_alternatives(network, Place{Stop: alewife, IsStop: true}, Place{Stop: kenmore, IsStop: true}, PlanOptions{Alternatives: 3})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		summaries := []string{}
+		for _, itinerary := range found {
+			summaries = append(summaries, itinerary_summary(itinerary, estimate_trip(network, itinerary, 0)))
+		}
+		expected := []string{"no transfers, 11 stops, about 27 min", "1 transfer, 2 stops, about 14 min", "1 transfer, 2 stops, about 14 min"}
+		if !reflect.DeepEqual(expected, summaries) {
+			t.Errorf("expected %s to be equal to %s", expected, summaries)
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		found, err := plan_place_alternatives(network, Place{Stop: alewife, IsStop: true}, Place{Stop: kenmore, IsStop: true}, PlanOptions{Alternatives: 2})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `2 ways to get from Alewife to Kenmore:
+1. 1 transfer, 2 stops, about 14 min
+   Red Line
+   Green Line B
+2. 1 transfer, 2 stops, about 14 min
+   Orange Line
+   Green Line E
+`
+		out := &bytes.Buffer{}
+		print_itineraries(out, "Alewife", "Kenmore", found, estimate_trips(network, found, 0))
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - no path at all", func(t *testing.T) {
+		_, err := plan_place_alternatives(network, Place{Stop: alewife, IsStop: true}, Place{Stop: Stop{ID: "elsewhere"}, IsStop: true}, PlanOptions{Alternatives: 3})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+}
+
+// random_network is a network of up to stopCount stops and routeCount routes, each route running through
+// a few distinct stops picked at random, so that routes cross each other and often make loops. Some routes
+// split into a second branch partway along, as the Red Line does at JFK/UMass, some run around in a circle
+// back to where they started, and some list the same pattern again the other way round. With walking, the
+// stops are laid out on a grid about 330 meters apart, close enough to walk to the stops next to them but
+// not the ones diagonally across (about 470 meters) or further.
+func random_network(r *rand.Rand, stopCount int, routeCount int, walking bool) Network {
+	cells := r.Perm(stopCount)
+	stops := []Stop{}
+	for i := 0; i < stopCount; i++ {
+		stop := Stop{ID: fmt.Sprintf("stop-%d", i), Attribute: StopAttribute{Name: fmt.Sprintf("Stop %d", i)}}
+		if walking {
+			stop.Attribute.Latitude = 42.35 + 0.003*float64(cells[i]/4)
+			stop.Attribute.Longitude = -71.06 + 0.004*float64(cells[i]%4)
+		}
+		stops = append(stops, stop)
+	}
+
+	network := Network{
+		Routes:     []Route{},
+		Stops:      []Stop{},
+		RouteStops: map[Route][]Stop{},
+		StopRoutes: map[Stop][]Route{},
+		Branches:   map[Route][][]Stop{},
+	}
+	for i := 0; i < routeCount; i++ {
+		route := Route{ID: fmt.Sprintf("route-%d", i), Attribute: RouteAttribute{LongName: fmt.Sprintf("Route %d", i)}}
+		order := r.Perm(stopCount)
+		length := 2 + r.Intn(min(stopCount, 6)-1)
+		trunk := []Stop{}
+		for _, at := range order[:length] {
+			trunk = append(trunk, stops[at])
+		}
+		branches := [][]Stop{trunk}
+		switch r.Intn(4) {
+		case 0:
+			if spare := order[length:]; len(spare) > 0 {
+				branch := append([]Stop{}, trunk[:1+r.Intn(length-1)]...)
+				for _, at := range spare[:1+r.Intn(min(len(spare), 3))] {
+					branch = append(branch, stops[at])
+				}
+				branches = append(branches, branch)
+			}
+		case 1:
+			if length > 2 {
+				branches[0] = append(trunk, trunk[0])
+			}
+		case 2:
+			reversed := []Stop{}
+			for j := len(trunk) - 1; j >= 0; j-- {
+				reversed = append(reversed, trunk[j])
+			}
+			branches = append(branches, reversed)
+		}
+
+		// The same as build_network, which lists each stop once, one branch after the other, and only knows
+		// about the stops some route serves.
+		routeStops := []Stop{}
+		for _, branch := range branches {
+			for _, stop := range branch {
+				if stop_position(routeStops, stop) < 0 {
+					routeStops = append(routeStops, stop)
+				}
+			}
+		}
+		network.Routes = append(network.Routes, route)
+		network.RouteStops[route] = routeStops
+		network.Branches[route] = branches
+		for _, stop := range routeStops {
+			if _, ok := network.StopRoutes[stop]; !ok {
+				network.Stops = append(network.Stops, stop)
+			}
+			network.StopRoutes[stop] = append(network.StopRoutes[stop], route)
+		}
+	}
+	return network
+}
+
+// random_place is a stop of the network, or half the time a coordinate somewhere around it, which may
+// be too far from every stop to walk to.
+func random_place(r *rand.Rand, network Network, name string) Place {
+	if r.Intn(2) == 0 {
+		return Place{Stop: network.Stops[r.Intn(len(network.Stops))], IsStop: true}
+	}
+	coordinate := Coordinate{Latitude: 42.344 + 0.021*r.Float64(), Longitude: -71.068 + 0.028*r.Float64()}
+	return Place{Name: name, Coordinate: coordinate}
+}
+
+// fewest_rides is a brute-force breadth-first search for the fewest rides from origin to destination, or
+// false when there is no way there. A ride goes from a stop to any other stop along a branch of a route
+// that has them both, so changing branches of the same route is another ride. Between rides we can walk
+// as far as maxWalkMeters to another stop, but never twice in a row. Walks from a coordinate origin and to
+// a coordinate destination go as far as maxAccessMeters and don't count as walking between rides, so
+// either can follow or be followed by one. It knows nothing about the planner, to check the planner
+// against.
+func fewest_rides(network Network, origin Place, destination Place, maxWalkMeters float64, maxAccessMeters float64) (int, bool) {
+	type reached struct {
+		stop   Stop
+		walked bool
+	}
+	start, end := origin.as_stop(), destination.as_stop()
+	walk := func(from reached) []reached {
+		next := []reached{}
+		if from.stop == start && !origin.IsStop {
+			for _, stop := range network.Stops {
+				if haversine_meters(origin.Coordinate, stop_coordinate(stop)) <= maxAccessMeters {
+					next = append(next, reached{stop: stop})
+				}
+			}
+		}
+		if !destination.IsStop && from.stop != end && has_coordinates(from.stop) {
+			if haversine_meters(stop_coordinate(from.stop), destination.Coordinate) <= maxAccessMeters {
+				next = append(next, reached{stop: end})
+			}
+		}
+		if from.walked || maxWalkMeters <= 0 || len(network.StopRoutes[from.stop]) == 0 || !has_coordinates(from.stop) {
+			return next
+		}
+		for _, stop := range network.Stops {
+			if stop != from.stop && has_coordinates(stop) && haversine_meters(stop_coordinate(from.stop), stop_coordinate(stop)) <= maxWalkMeters {
+				next = append(next, reached{stop: stop, walked: true})
+			}
+		}
+		return next
+	}
+
+	seen := map[reached]bool{}
+	frontier := []reached{{stop: start}}
+	for rides := 0; len(frontier) > 0; rides++ {
+		// Walks are free, so everything a walk away is reached with the same number of rides.
+		for i := 0; i < len(frontier); i++ {
+			frontier = append(frontier, walk(frontier[i])...)
+		}
+		next := []reached{}
+		for _, at := range frontier {
+			if seen[at] {
+				continue
+			}
+			seen[at] = true
+			if at.stop == end {
+				return rides, true
+			}
+			for _, route := range network.StopRoutes[at.stop] {
+				for _, branch := range network.branches(route) {
+					on := false
+					for _, stop := range branch {
+						on = on || stop == at.stop
+					}
+					for _, stop := range branch {
+						if on && stop != at.stop {
+							next = append(next, reached{stop: stop})
+						}
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return 0, false
+}
+
+// itinerary_problem says what is wrong with an itinerary from origin to destination, or "" when it is a
+// connected path the network can actually take: every ride along a branch of a route between two stops on
+// that branch, every walk short enough, and no walking between stops twice in a row or getting back on the
+// branch we just got off.
+func itinerary_problem(network Network, origin Place, destination Place, options PlanOptions, itinerary Itinerary) string {
+	start, end := origin.as_stop(), destination.as_stop()
+	at := start
+	for i, leg := range itinerary.Legs {
+		if leg.From != at {
+			return fmt.Sprintf("leg %d starts at %s, but we are at %s", i, leg.From.ID, at.ID)
+		}
+		if leg.From == leg.To {
+			return fmt.Sprintf("leg %d goes nowhere", i)
+		}
+		if leg.Walk {
+			// Only walks between two stops count, not the ones from or to a coordinate.
+			place := (!origin.IsStop && leg.From == start) || (!destination.IsStop && leg.To == end)
+			walkedBefore := i > 0 && itinerary.Legs[i-1].Walk && (origin.IsStop || itinerary.Legs[i-1].From != start)
+			limit := options.MaxWalkMeters
+			if place {
+				limit = options.MaxAccessMeters
+			} else if walkedBefore {
+				return fmt.Sprintf("leg %d walks again", i)
+			}
+			meters := haversine_meters(stop_coordinate(leg.From), stop_coordinate(leg.To))
+			if !has_coordinates(leg.From) || !has_coordinates(leg.To) || meters > limit {
+				return fmt.Sprintf("leg %d walks %.0f meters", i, meters)
+			}
+		} else {
+			if i > 0 && itinerary.Legs[i-1].Route == leg.Route && itinerary.Legs[i-1].Branch == leg.Branch {
+				return fmt.Sprintf("leg %d gets back on %s branch %d", i, leg.Route.ID, leg.Branch)
+			}
+			branches := network.branches(leg.Route)
+			if leg.Branch < 0 || leg.Branch >= len(branches) {
+				return fmt.Sprintf("leg %d rides %s branch %d, which it doesn't have", i, leg.Route.ID, leg.Branch)
+			}
+			fits := false
+			for from, fromStop := range branches[leg.Branch] {
+				for to, toStop := range branches[leg.Branch] {
+					if fromStop == leg.From && toStop == leg.To && leg.Stops == max(to-from, from-to) && (leg.Direction == 1) == (to < from) {
+						fits = true
+					}
+				}
+			}
+			if !fits {
+				return fmt.Sprintf("leg %d rides %s branch %d %d stops in direction %d from %s to %s", i, leg.Route.ID, leg.Branch, leg.Stops, leg.Direction, leg.From.ID, leg.To.ID)
+			}
+		}
+		at = leg.To
+	}
+	if at != end {
+		return fmt.Sprintf("ends at %s instead of %s", at.ID, end.ID)
+	}
+	return ""
+}
+
+// plan_within plans, failing the test if the planner hasn't finished after a few seconds, so a search that
+// goes round a loop forever shows up as a failure rather than a hang.
+func plan_within(t *testing.T, network Network, origin Place, destination Place, options PlanOptions) ([]Itinerary, error) {
+	t.Helper()
+	type result struct {
+		itineraries []Itinerary
+		err         error
+	}
+	done := make(chan result, 1)
+	go func() {
+		itineraries, err := plan_place_alternatives(network, origin, destination, options)
+		done <- result{itineraries, err}
+	}()
+	select {
+	case found := <-done:
+		return found.itineraries, found.err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("planning from %s to %s did not finish", place_label(origin), place_label(destination))
+		return nil, nil
+	}
+}
+
+// place_label names a place in a failure message.
+func place_label(place Place) string {
+	if place.IsStop {
+		return place.Stop.ID
+	}
+	return fmt.Sprintf("%s (%f,%f)", place.Name, place.Coordinate.Latitude, place.Coordinate.Longitude)
+}
+
+// check_planner_properties plans from origin to destination and checks the planner against fewest_rides,
+// and every itinerary it returns with itinerary_problem.
+func check_planner_properties(t *testing.T, network Network, origin Place, destination Place, options PlanOptions) {
+	t.Helper()
+	from, to := place_label(origin), place_label(destination)
+	found, err := plan_within(t, network, origin, destination, options)
+	for _, place := range []Place{origin, destination} {
+		if !place.IsStop && len(new_stop_index(network.Stops).Within(place.Coordinate, options.MaxAccessMeters)) == 0 {
+			if err != ErrNoNearbyStops {
+				t.Errorf("expected error %s to be %s from %s to %s", ErrNoNearbyStops, err, from, to)
+			}
+			return
+		}
+	}
+	rides, reachable := fewest_rides(network, origin, destination, options.MaxWalkMeters, options.MaxAccessMeters)
+
+	if !reachable {
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s from %s to %s", ErrNoPath, err, from, to)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("did not expect an error from %s to %s: %s", from, to, err)
+	}
+	if len(found) == 0 || len(found) > max(options.Alternatives, 1) {
+		t.Fatalf("expected between 1 and %d itineraries, got %d", max(options.Alternatives, 1), len(found))
+	}
+	if len(found[0].Routes()) != rides {
+		t.Errorf("expected %+v to be equal to %+v rides from %s to %s: %+v", rides, len(found[0].Routes()), from, to, found[0])
+	}
+	if found[0].Transfers() != max(rides-1, 0) {
+		t.Errorf("expected %+v to be equal to %+v transfers from %s to %s", max(rides-1, 0), found[0].Transfers(), from, to)
+	}
+	for i, itinerary := range found {
+		if problem := itinerary_problem(network, origin, destination, options, itinerary); problem != "" {
+			t.Errorf("itinerary %d from %s to %s: %s: %+v", i, from, to, problem, itinerary)
+		}
+		for _, other := range found[:i] {
+			if legs_equal(other.Legs, itinerary.Legs) {
+				t.Errorf("itinerary %d from %s to %s is a repeat: %+v", i, from, to, itinerary)
+			}
+		}
+	}
+}
+
+func Test_plan_itinerary_properties(t *testing.T) {
+	t.Run("happy path - random networks without walking", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			network := random_network(r, 2+r.Intn(12), 1+r.Intn(6), false)
+			start, end := network.Stops[r.Intn(len(network.Stops))], network.Stops[r.Intn(len(network.Stops))]
+			check_planner_properties(t, network, Place{Stop: start, IsStop: true}, Place{Stop: end, IsStop: true}, PlanOptions{})
+		}
+	})
+
+	t.Run("happy path - random networks with walking and alternatives", func(t *testing.T) {
+		r := rand.New(rand.NewSource(2))
+		for i := 0; i < 100; i++ {
+			network := random_network(r, 2+r.Intn(12), 1+r.Intn(6), true)
+			start, end := network.Stops[r.Intn(len(network.Stops))], network.Stops[r.Intn(len(network.Stops))]
+			check_planner_properties(t, network, Place{Stop: start, IsStop: true}, Place{Stop: end, IsStop: true}, PlanOptions{MaxWalkMeters: defaultMaxWalkMeters, Alternatives: 3})
+		}
+	})
+
+	t.Run("happy path - random networks between coordinates", func(t *testing.T) {
+		r := rand.New(rand.NewSource(3))
+		for i := 0; i < 100; i++ {
+			network := random_network(r, 2+r.Intn(12), 1+r.Intn(6), true)
+			origin, destination := random_place(r, network, "Origin"), random_place(r, network, "Destination")
+			options := PlanOptions{MaxWalkMeters: defaultMaxWalkMeters, MaxAccessMeters: 400, Alternatives: 1 + r.Intn(3)}
+			check_planner_properties(t, network, origin, destination, options)
+		}
+	})
+
+	t.Run("sad path - terminates on a loop with no way out", func(t *testing.T) {
+		// Three routes around a triangle, and a fourth off on its own, which the search can't reach no
+		// matter how many times it goes around.
+		a, b, c := Stop{ID: "a"}, Stop{ID: "b"}, Stop{ID: "c"}
+		d, e := Stop{ID: "d"}, Stop{ID: "e"}
+		ab, bc, ca, de := Route{ID: "ab"}, Route{ID: "bc"}, Route{ID: "ca"}, Route{ID: "de"}
+		network := Network{
+			Routes:     []Route{ab, bc, ca, de},
+			Stops:      []Stop{a, b, c, d, e},
+			RouteStops: map[Route][]Stop{ab: {a, b}, bc: {b, c}, ca: {c, a}, de: {d, e}},
+			StopRoutes: map[Stop][]Route{a: {ab, ca}, b: {ab, bc}, c: {bc, ca}, d: {de}, e: {de}},
+		}
+
+		_, err := plan_within(t, network, Place{Stop: a, IsStop: true}, Place{Stop: e, IsStop: true}, PlanOptions{Alternatives: 5})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", ErrNoPath, err)
+		}
+	})
+}
+
+func Fuzz_plan_itinerary(f *testing.F) {
+	f.Add(int64(1), uint8(5), uint8(2), false, uint8(0), uint8(4), uint8(1))
+	f.Add(int64(2), uint8(12), uint8(6), true, uint8(3), uint8(9), uint8(3))
+	f.Add(int64(3), uint8(3), uint8(1), true, uint8(1), uint8(1), uint8(1))
+	f.Fuzz(func(t *testing.T, seed int64, stopCount uint8, routeCount uint8, walking bool, from uint8, to uint8, alternatives uint8) {
+		r := rand.New(rand.NewSource(seed))
+		network := random_network(r, 2+int(stopCount%15), 1+int(routeCount%8), walking)
+		origin := Place{Stop: network.Stops[int(from)%len(network.Stops)], IsStop: true}
+		destination := Place{Stop: network.Stops[int(to)%len(network.Stops)], IsStop: true}
+
+		options := PlanOptions{Alternatives: 1 + int(alternatives%4)}
+		if walking {
+			// With walking, either end can also be a coordinate near the network.
+			options.MaxWalkMeters, options.MaxAccessMeters = defaultMaxWalkMeters, 400
+			origin, destination = random_place(r, network, "Origin"), random_place(r, network, "Destination")
+		}
+		check_planner_properties(t, network, origin, destination, options)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+)
+
+// Preferences are what someone asks of a trip beyond getting there: "avoid Green Line E", "prefer heavy
+// rail", "no more than one transfer" or "via Kenmore". Avoiding a route, capping the transfers and going
+// via a stop are constraints the planner won't break; preferring heavy rail only changes what counts as
+// the better itinerary.
+type Preferences struct {
+	// AvoidRoutes are never ridden, by long name or ID.
+	AvoidRoutes []string
+	// PreferHeavyRail counts a ride on any other kind of route as two, as costly as a transfer, and its
+	// stops twice. So a trip with one transfer to stay on the heavy rail ties with a ride off it, and
+	// wins unless that ride has fewer than half as many stops.
+	PreferHeavyRail bool
+	// MaxRides is the most routes we'll ride, which is one more than the transfers allowed ("no more
+	// than one transfer" is two rides). Zero means any number.
+	MaxRides int
+	// Via are stops the itinerary has to pass through, in order. Riding through a stop counts.
+	Via []string
+}
+
+// plan_preferences are Preferences with the names looked up in the network.
+type plan_preferences struct {
+	avoid           map[Route]bool
+	preferHeavyRail bool
+	maxRides        int
+	via             []Stop
+}
+
+func resolve_preferences(network Network, preferences Preferences) (plan_preferences, error) {
+	resolved := plan_preferences{avoid: map[Route]bool{}, preferHeavyRail: preferences.PreferHeavyRail, maxRides: preferences.MaxRides}
+	for _, name := range preferences.AvoidRoutes {
+		route, ok := network.find_route_by_name(strings.TrimSpace(name))
+		if !ok {
+			return plan_preferences{}, ErrNoRoute
+		}
+		resolved.avoid[route] = true
+	}
+	for _, name := range preferences.Via {
+		stop, ok := network.find_stop_by_name(strings.TrimSpace(name))
+		if !ok {
+			return plan_preferences{}, ErrNoStop
+		}
+		resolved.via = append(resolved.via, stop)
+	}
+	return resolved, nil
+}
+
+// split_names reads a comma separated list of route or stop names, as the flags and query parameters
+// take them. An empty list is no names at all.
+func split_names(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func (p plan_preferences) allows_rides(rides int) bool {
+	return p.maxRides == 0 || rides <= p.maxRides
+}
+
+// leg_penalty is the extra rides and stops a leg costs for not being on the heavy rail, when that is
+// preferred. The extra ride ranks with the itinerary's rides (see plan_cost), so it weighs as much as a
+// transfer.
+func (p plan_preferences) leg_penalty(leg Leg) (int, int) {
+	if !p.preferHeavyRail || leg.Walk || leg.Route.Attribute.Type == int(RouteRailTypeHeavyRail) {
+		return 0, 0
+	}
+	return 1, leg.Stops
+}
+
+// passed_via counts how many of the via stops we have passed in order, given that reached of them were
+// already behind us before this leg.
+func (p plan_preferences) passed_via(network Network, reached int, leg Leg) int {
+	if reached == len(p.via) {
+		return reached
+	}
+	for _, stop := range leg_stops(network, leg) {
+		if reached < len(p.via) && stop == p.via[reached] {
+			reached++
+		}
+	}
+	return reached
+}
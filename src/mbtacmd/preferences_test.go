@@ -0,0 +1,216 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mock_rail_network has a short light rail route and a longer heavy rail route between the same two stops.
+func mock_rail_network() Network {
+	light := Route{ID: "Green-X", Attribute: RouteAttribute{LongName: "Green Line X", Type: int(RouteRailTypeLightRail)}}
+	heavy := Route{ID: "Orange", Attribute: RouteAttribute{LongName: "Orange Line", Type: int(RouteRailTypeHeavyRail)}}
+	start := Stop{ID: "start", Attribute: StopAttribute{Name: "Start"}}
+	end := Stop{ID: "end", Attribute: StopAttribute{Name: "End"}}
+	trolley := Stop{ID: "trolley", Attribute: StopAttribute{Name: "Trolley Stop"}}
+	first := Stop{ID: "first", Attribute: StopAttribute{Name: "First Station"}}
+	second := Stop{ID: "second", Attribute: StopAttribute{Name: "Second Station"}}
+
+	return Network{
+		Routes: []Route{light, heavy},
+		Stops:  []Stop{start, end, trolley, first, second},
+		RouteStops: map[Route][]Stop{
+			light: []Stop{start, trolley, end},
+			heavy: []Stop{start, first, second, end},
+		},
+		StopRoutes: map[Stop][]Route{
+			start:   []Route{light, heavy},
+			end:     []Route{light, heavy},
+			trolley: []Route{light},
+			first:   []Route{heavy},
+			second:  []Route{heavy},
+		},
+	}
+}
+
+func Test_plan_preferences(t *testing.T) {
+	network := mock_accessibility_network()
+	red, green, orange, greenE := network.Routes[0], network.Routes[1], network.Routes[2], network.Routes[3]
+	alewife, kenmore, sciencePark := network.Stops[0], network.Stops[2], network.Stops[4]
+	plan := func(start Stop, end Stop, preferences Preferences) (Itinerary, error) {
+		return plan_itinerary(network, start, end, PlanOptions{Preferences: preferences})
+	}
+
+	t.Run("happy path - avoid a route", func(t *testing.T) {
+		expected := []Route{orange, greenE}
+
+		found, err := plan(alewife, kenmore, Preferences{AvoidRoutes: []string{"Green Line B"}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("happy path - via a stop", func(t *testing.T) {
+		expected := []Route{orange, greenE}
+
+		found, err := plan(alewife, kenmore, Preferences{Via: []string{"Haymarket"}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("happy path - riding through a via stop counts", func(t *testing.T) {
+		expected := []Leg{{Route: greenE, From: kenmore, To: sciencePark, Stops: 2, Direction: 1}}
+
+		found, err := plan(kenmore, sciencePark, Preferences{Via: []string{"Haymarket"}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Legs) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Legs)
+		}
+	})
+
+	t.Run("happy path - within the transfers allowed", func(t *testing.T) {
+		expected := []Route{red, green}
+
+		found, err := plan(alewife, kenmore, Preferences{MaxRides: 2})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("sad path - too many transfers", func(t *testing.T) {
+		_, err := plan(alewife, kenmore, Preferences{MaxRides: 1})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("sad path - avoiding every way there", func(t *testing.T) {
+		_, err := plan(alewife, kenmore, Preferences{AvoidRoutes: []string{"Green Line B", "Green-E"}})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("sad path - unknown route to avoid", func(t *testing.T) {
+		_, err := plan(alewife, kenmore, Preferences{AvoidRoutes: []string{"Purple Line"}})
+		if err != ErrNoRoute {
+			t.Errorf("expected error %s to be %s", err, ErrNoRoute)
+		}
+	})
+
+	t.Run("sad path - via a stop on another branch", func(t *testing.T) {
+		// Savin Hill comes between Alewife and Braintree in the order the API lists them, but no Braintree
+		// train goes there.
+		network := mock_branching_network()
+		alewife, braintree := network.Stops[0], network.Stops[5]
+
+		_, err := plan_itinerary(network, alewife, braintree, PlanOptions{Preferences: Preferences{Via: []string{"Savin Hill"}}})
+		if err != ErrNoPath {
+			t.Errorf("expected error %s to be %s", err, ErrNoPath)
+		}
+	})
+
+	t.Run("sad path - unknown via stop", func(t *testing.T) {
+		_, err := plan(alewife, kenmore, Preferences{Via: []string{"Nowhere"}})
+		if err != ErrNoStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoStop)
+		}
+	})
+}
+
+func Test_plan_prefer_heavy_rail(t *testing.T) {
+	network := mock_rail_network()
+	light, heavy := network.Routes[0], network.Routes[1]
+	start, end := network.Stops[0], network.Stops[1]
+
+	t.Run("happy path - fewest stops without a preference", func(t *testing.T) {
+		expected := []Route{light}
+
+		found, err := plan_itinerary(network, start, end, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("happy path - heavy rail when preferred", func(t *testing.T) {
+		expected := []Route{heavy}
+
+		found, err := plan_itinerary(network, start, end, PlanOptions{Preferences: Preferences{PreferHeavyRail: true}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	// split takes away the direct heavy rail ride, so getting there on it means changing at Second Station
+	// for an express that makes more stops after it.
+	split := func(more ...Stop) Network {
+		express := Route{ID: "Express", Attribute: RouteAttribute{LongName: "Express", Type: int(RouteRailTypeHeavyRail)}}
+		first, second := network.Stops[3], network.Stops[4]
+		split := mock_rail_network()
+		split.Routes = append(split.Routes, express)
+		split.Stops = append(split.Stops, more...)
+		split.RouteStops[heavy] = []Stop{start, first, second}
+		split.RouteStops[express] = append(append([]Stop{second}, more...), end)
+		split.StopRoutes[second] = append(split.StopRoutes[second], express)
+		split.StopRoutes[end] = []Route{light, express}
+		for _, stop := range more {
+			split.StopRoutes[stop] = []Route{express}
+		}
+		return split
+	}
+
+	t.Run("happy path - a transfer to stay on the heavy rail", func(t *testing.T) {
+		network := split()
+		express := network.Routes[2]
+
+		found, err := plan_itinerary(network, start, end, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual([]Route{light}, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", []Route{light}, found.Routes())
+		}
+
+		expected := []Route{heavy, express}
+
+		found, err = plan_itinerary(network, start, end, PlanOptions{Preferences: Preferences{PreferHeavyRail: true}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+
+	t.Run("happy path - a much shorter light rail ride beats a transfer", func(t *testing.T) {
+		// Five stops with a transfer against the light rail's two, which count as four.
+		network := split(Stop{ID: "third", Attribute: StopAttribute{Name: "Third Station"}}, Stop{ID: "fourth", Attribute: StopAttribute{Name: "Fourth Station"}})
+
+		expected := []Route{light}
+
+		found, err := plan_itinerary(network, start, end, PlanOptions{Preferences: Preferences{PreferHeavyRail: true}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found.Routes()) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Routes())
+		}
+	})
+}
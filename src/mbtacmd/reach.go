@@ -0,0 +1,224 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+var ErrBadBudget = errors.New("expected exactly one budget of transfers, stops or minutes, as a number zero or more")
+
+// BudgetKind is what a Budget limits.
+type BudgetKind int
+
+const (
+	BudgetKindTransfers BudgetKind = iota
+	BudgetKindStops
+	// BudgetKindMinutes limits the estimated minutes, the same estimate the itineraries print (see
+	// estimate_trip).
+	BudgetKindMinutes
+)
+
+// budgetKinds are what a Budget can limit, in the order the flags and query parameters list them.
+var budgetKinds = []BudgetKind{BudgetKindTransfers, BudgetKindStops, BudgetKindMinutes}
+
+// String is the name of the flag and query parameter for the kind.
+func (k BudgetKind) String() string {
+	switch k {
+	case BudgetKindStops:
+		return "stops"
+	case BudgetKindMinutes:
+		return "minutes"
+	}
+	return "transfers"
+}
+
+// Budget is how far a reachability search goes: up to Limit transfers, stops or estimated minutes.
+type Budget struct {
+	Kind  BudgetKind
+	Limit float64
+}
+
+// parse_budget reads a budget from the values given for each kind by name, exactly one of which should be
+// set.
+func parse_budget(values map[string]string) (Budget, error) {
+	budget := Budget{}
+	found := false
+	for _, kind := range budgetKinds {
+		value := values[kind.String()]
+		if value == "" {
+			continue
+		}
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil || limit < 0 || found {
+			return Budget{}, ErrBadBudget
+		}
+		budget = Budget{Kind: kind, Limit: limit}
+		found = true
+	}
+	if !found {
+		return Budget{}, ErrBadBudget
+	}
+	return budget, nil
+}
+
+func (b Budget) String() string {
+	kind := b.Kind.String()
+	if b.Limit == 1 {
+		kind = kind[:len(kind)-1]
+	}
+	return fmt.Sprintf("%g %s", b.Limit, kind)
+}
+
+// less orders the search by what the budget limits first, so that everything within the budget comes out
+// of the queue before anything beyond it. The rest breaks ties as plan_cost.less does.
+func (b Budget) less(c plan_cost, other plan_cost) bool {
+	switch b.Kind {
+	case BudgetKindStops:
+		if c.Stops != other.Stops {
+			return c.Stops < other.Stops
+		}
+	case BudgetKindMinutes:
+		if c.Minutes != other.Minutes {
+			return c.Minutes < other.Minutes
+		}
+	}
+	return c.less(other)
+}
+
+func (b Budget) within(cost plan_cost) bool {
+	switch b.Kind {
+	case BudgetKindStops:
+		return float64(cost.Stops) <= b.Limit
+	case BudgetKindMinutes:
+		return cost.Minutes <= b.Limit
+	}
+	return float64(max(cost.Rides-1, 0)) <= b.Limit
+}
+
+// ReachableStop is a stop within a budget, with the itinerary that gets there for the least of it and how
+// long that takes.
+type ReachableStop struct {
+	Stop      Stop
+	Itinerary Itinerary
+	Estimate  TripEstimate
+}
+
+// reachable_stops is the planner's search from one stop to every other, in order of the least of the
+// budget it takes to get to each, stopping once the budget runs out. The minutes are the same estimate each
+// stop's itinerary prints (see estimate_trip). Going via stops and preferring heavy rail only make sense
+// for a trip to one place, so they are left out.
+func reachable_stops(network Network, start Stop, budget Budget, options PlanOptions) ([]ReachableStop, error) {
+	options.Preferences.Via = nil
+	options.Preferences.PreferHeavyRail = false
+	graph, err := new_plan_graph(network, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Accessible {
+		graph.blocked = options.Accessibility.blocked_stops(network)
+		if problem, ok := graph.blocked[start]; ok {
+			return nil, fmt.Errorf("%w: %s: %s", ErrNoAccessiblePath, start.Attribute.Name, problem)
+		}
+	}
+
+	from := plan_state{Stop: start}
+	best := map[plan_state]plan_cost{from: {}}
+	previous := map[plan_state]plan_state{}
+	previousLeg := map[plan_state]Leg{}
+	done := map[plan_state]bool{}
+	reached := map[Stop]bool{start: true}
+	reachable := []ReachableStop{}
+
+	queue := &plan_queue{items: []plan_item{{State: from}}, less: budget.less}
+	order := 1
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(plan_item)
+		if done[item.State] {
+			continue
+		}
+		if !budget.within(item.Cost) {
+			break
+		}
+		done[item.State] = true
+
+		if !reached[item.State.Stop] {
+			reached[item.State.Stop] = true
+			itinerary := trace_itinerary(from, item.State, previous, previousLeg)
+			reachable = append(reachable, ReachableStop{
+				Stop:      item.State.Stop,
+				Itinerary: itinerary,
+				Estimate:  estimate_trip(network, itinerary, options.TransferPenaltyMinutes),
+			})
+		}
+
+		for _, leg := range graph.next_legs(item.State) {
+			next := graph.step(item, leg)
+			if !graph.preferences.allows_rides(next.Cost.Rides) {
+				continue
+			}
+			if cost, ok := best[next.State]; ok && !budget.less(next.Cost, cost) {
+				continue
+			}
+			best[next.State] = next.Cost
+			previous[next.State] = item.State
+			previousLeg[next.State] = leg
+			next.Order = order
+			heap.Push(queue, next)
+			order++
+		}
+	}
+
+	return reachable, nil
+}
+
+func reachable_stops_from_name(network Network, name string, budget Budget, options PlanOptions) (Stop, []ReachableStop, error) {
+	start, ok := network.find_stop_by_name(name)
+	if !ok {
+		return Stop{}, nil, ErrNoStop
+	}
+	reachable, err := reachable_stops(network, start, budget, options)
+	if err != nil {
+		return Stop{}, nil, err
+	}
+	return start, reachable, nil
+}
+
+func print_reachable_stops(out io.Writer, start Stop, budget Budget, reachable []ReachableStop) {
+	if len(reachable) == 0 {
+		fmt.Fprintf(out, "No other stops are within %s of %s.\n", budget, start.Attribute.Name)
+		return
+	}
+	fmt.Fprintf(out, "%d stops are within %s of %s:\n", len(reachable), budget, start.Attribute.Name)
+	for _, stop := range reachable {
+		fmt.Fprintf(out, "  %s: %s\n", stop.Stop.Attribute.Name, itinerary_summary(stop.Itinerary, stop.Estimate))
+	}
+}
+
+// reachable_geojson is a Point for the start and every reachable stop that has coordinates, with what it
+// takes to get there, ready to color by any of them in a mapping tool.
+func reachable_geojson(start Stop, reachable []ReachableStop) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	stops := append([]ReachableStop{{Stop: start}}, reachable...)
+	for _, stop := range stops {
+		if !has_coordinates(stop.Stop) {
+			continue
+		}
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: GeoJSONGeometry{Type: "Point", Coordinates: geojson_position(stop_coordinate(stop.Stop))},
+			Properties: map[string]interface{}{
+				"id":        stop.Stop.ID,
+				"name":      stop.Stop.Attribute.Name,
+				"start":     stop.Stop == start,
+				"transfers": stop.Itinerary.Transfers(),
+				"stops":     stop.Itinerary.Stops(),
+				"minutes":   math.Round(stop.Estimate.TotalMinutes()),
+			},
+		})
+	}
+	return collection
+}
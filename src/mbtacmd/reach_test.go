@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func reachable_names(reachable []ReachableStop) []string {
+	names := []string{}
+	for _, stop := range reachable {
+		names = append(names, stop.Stop.Attribute.Name)
+	}
+	return names
+}
+
+func Test_reachable_stops(t *testing.T) {
+	network := mock_accessibility_network()
+	alewife := network.Stops[0]
+
+	t.Run("happy path - within transfers", func(t *testing.T) {
+		expected := []string{"Park Street", "Haymarket", "Kenmore", "Science Park"}
+
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindTransfers, Limit: 1}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, reachable_names(found)) {
+			t.Errorf("expected %+v to be equal to %+v", expected, reachable_names(found))
+		}
+	})
+
+	t.Run("happy path - within stops", func(t *testing.T) {
+		expected := []string{"Park Street", "Haymarket"}
+
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindStops, Limit: 1}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, reachable_names(found)) {
+			t.Errorf("expected %+v to be equal to %+v", expected, reachable_names(found))
+		}
+	})
+
+	t.Run("happy path - within minutes", func(t *testing.T) {
+		// One stop is a five minute wait and two minutes riding.
+		expected := []string{"Park Street", "Haymarket"}
+
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindMinutes, Limit: 10}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, reachable_names(found)) {
+			t.Errorf("expected %+v to be equal to %+v", expected, reachable_names(found))
+		}
+	})
+
+	t.Run("happy path - within scheduled minutes", func(t *testing.T) {
+		// The schedules say Alewife to Park Street takes 20 minutes, so only Haymarket is still within 10,
+		// in the same 7 minutes its itinerary is estimated at.
+		scheduled := mock_accessibility_network()
+		scheduled.Times = TravelTimes{Segments: map[[2]string]float64{{"place-alfcl", "place-pktrm"}: 20}, Headways: map[[2]string]float64{}}
+		expected := []string{"Haymarket"}
+
+		found, err := reachable_stops(scheduled, alewife, Budget{Kind: BudgetKindMinutes, Limit: 10}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, reachable_names(found)) {
+			t.Errorf("expected %+v to be equal to %+v", expected, reachable_names(found))
+		}
+		if minutes := estimate_trip(scheduled, found[0].Itinerary, 0).TotalMinutes(); found[0].Estimate.TotalMinutes() != minutes || minutes != 7 {
+			t.Errorf("expected %v minutes to be %v and 7", found[0].Estimate.TotalMinutes(), minutes)
+		}
+	})
+
+	t.Run("happy path - avoiding a route", func(t *testing.T) {
+		expected := []string{"Park Street", "Kenmore"}
+
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindTransfers, Limit: 1}, PlanOptions{Preferences: Preferences{AvoidRoutes: []string{"Orange"}}})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, reachable_names(found)) {
+			t.Errorf("expected %+v to be equal to %+v", expected, reachable_names(found))
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindTransfers, Limit: 0}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := `2 stops are within 0 transfers of Alewife:
+  Park Street: no transfers, 1 stops, about 7 min
+  Haymarket: no transfers, 1 stops, about 7 min
+`
+		out := &bytes.Buffer{}
+		print_reachable_stops(out, alewife, Budget{Kind: BudgetKindTransfers, Limit: 0}, found)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - nothing within budget", func(t *testing.T) {
+		found, err := reachable_stops(network, alewife, Budget{Kind: BudgetKindMinutes, Limit: 6}, PlanOptions{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "No other stops are within 6 minutes of Alewife.\n"
+		out := &bytes.Buffer{}
+		print_reachable_stops(out, alewife, Budget{Kind: BudgetKindMinutes, Limit: 6}, found)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("sad path - unknown stop", func(t *testing.T) {
+		_, _, err := reachable_stops_from_name(network, "Nowhere", Budget{Kind: BudgetKindStops, Limit: 1}, PlanOptions{})
+		if err != ErrNoStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoStop)
+		}
+	})
+}
+
+func Test_reachable_geojson(t *testing.T) {
+	network := mock_walking_network()
+	kenmore := network.Stops[0]
+
+	t.Run("happy path - including a walk", func(t *testing.T) {
+		reachable, err := reachable_stops(network, kenmore, Budget{Kind: BudgetKindTransfers, Limit: 0}, default_plan_options())
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		collection := reachable_geojson(kenmore, reachable)
+		names := []interface{}{}
+		for _, feature := range collection.Features {
+			names = append(names, feature.Properties["name"])
+		}
+		expected := []interface{}{"Kenmore", "Park Street", "Downtown Crossing"}
+		if !reflect.DeepEqual(expected, names) {
+			t.Errorf("expected %+v to be equal to %+v", expected, names)
+		}
+		if collection.Features[0].Properties["start"] != true || collection.Features[2].Properties["transfers"] != 0 {
+			t.Errorf("expected the start first and no transfers to walk, got %+v", collection.Features)
+		}
+	})
+}
+
+func Test_parse_budget(t *testing.T) {
+	t.Run("happy path - minutes", func(t *testing.T) {
+		expected := Budget{Kind: BudgetKindMinutes, Limit: 20}
+
+		found, err := parse_budget(map[string]string{"minutes": "20", "stops": ""})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if found != expected {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - zero transfers", func(t *testing.T) {
+		expected := Budget{Kind: BudgetKindTransfers, Limit: 0}
+
+		found, err := parse_budget(map[string]string{"transfers": "0"})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if found != expected || found.String() != "0 transfers" {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	for name, values := range map[string]map[string]string{
+		"none":         {},
+		"two kinds":    {"transfers": "0", "minutes": "20"},
+		"two":          {"stops": "3", "minutes": "20"},
+		"negative":     {"transfers": "-1"},
+		"not a number": {"stops": "many"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			_, err := parse_budget(values)
+			if err != ErrBadBudget {
+				t.Errorf("expected error %s to be %s", err, ErrBadBudget)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+var ErrUnknownLayout = errors.New("unknown layout (expected geographic or schematic)")
+
+type MapOptions struct {
+	Layout string
+	Width  float64
+	Height float64
+}
+
+type svg_point struct {
+	X float64
+	Y float64
+}
+
+const (
+	svgMargin      = 60.0
+	svgStopRadius  = 4.0
+	svgTransferRad = 7.0
+)
+
+// filter_network_routes keeps only the named routes (by long name or ID), along with the stops they serve.
+func filter_network_routes(network Network, names []string) (Network, error) {
+	if len(names) == 0 {
+		return network, nil
+	}
+
+	routes := []Route{}
+	for _, name := range names {
+		route, ok := network.find_route_by_name(strings.TrimSpace(name))
+		if !ok {
+			return Network{}, ErrNoRoute
+		}
+		routes = append(routes, route)
+	}
+
+	filtered := Network{
+		Routes:     routes,
+		Stops:      []Stop{},
+		RouteStops: map[Route][]Stop{},
+		StopRoutes: map[Stop][]Route{},
+		Schedules:  map[Route]ScheduleWrapper{},
+		Branches:   map[Route][][]Stop{},
+		Times:      network.Times,
+	}
+	for _, route := range routes {
+		filtered.RouteStops[route] = network.RouteStops[route]
+		if schedules, ok := network.Schedules[route]; ok {
+			filtered.Schedules[route] = schedules
+		}
+		if branches, ok := network.Branches[route]; ok {
+			filtered.Branches[route] = branches
+		}
+		for _, stop := range network.RouteStops[route] {
+			if _, ok := filtered.StopRoutes[stop]; !ok {
+				filtered.Stops = append(filtered.Stops, stop)
+			}
+			filtered.StopRoutes[stop] = append(filtered.StopRoutes[stop], route)
+		}
+	}
+	return filtered, nil
+}
+
+func render_map_svg(w io.Writer, network Network, options MapOptions) error {
+	switch options.Layout {
+	case "geographic":
+		return render_geographic_svg(w, network, options)
+	case "schematic":
+		return render_schematic_svg(w, network, options)
+	default:
+		return ErrUnknownLayout
+	}
+}
+
+// geographic_positions projects every stop onto the canvas. Over an area the size of Boston an
+// equirectangular projection, with longitude scaled down by the cosine of the middle latitude, is
+// indistinguishable from anything fancier.
+func geographic_positions(network Network, options MapOptions) map[string]svg_point {
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	for _, stop := range network.Stops {
+		minLat = math.Min(minLat, stop.Attribute.Latitude)
+		maxLat = math.Max(maxLat, stop.Attribute.Latitude)
+		minLon = math.Min(minLon, stop.Attribute.Longitude)
+		maxLon = math.Max(maxLon, stop.Attribute.Longitude)
+	}
+
+	lonScale := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	spanX := (maxLon - minLon) * lonScale
+	spanY := maxLat - minLat
+
+	drawWidth := options.Width - 2*svgMargin
+	drawHeight := options.Height - 2*svgMargin
+	scale := 0.0
+	if spanX > 0 || spanY > 0 {
+		scale = math.Min(drawWidth/math.Max(spanX, 1e-9), drawHeight/math.Max(spanY, 1e-9))
+	}
+	// Center whatever we drew, since the network is rarely the same shape as the canvas.
+	offsetX := svgMargin + (drawWidth-spanX*scale)/2
+	offsetY := svgMargin + (drawHeight-spanY*scale)/2
+
+	positions := map[string]svg_point{}
+	for _, stop := range network.Stops {
+		positions[stop.ID] = svg_point{
+			X: offsetX + (stop.Attribute.Longitude-minLon)*lonScale*scale,
+			Y: offsetY + (maxLat-stop.Attribute.Latitude)*scale,
+		}
+	}
+	return positions
+}
+
+func render_geographic_svg(w io.Writer, network Network, options MapOptions) error {
+	positions := geographic_positions(network, options)
+
+	body := []string{}
+	for _, edge := range network_edges(network) {
+		from, to := positions[edge.From.ID], positions[edge.To.ID]
+		body = append(body, fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="5" stroke-linecap="round"/>`,
+			from.X, from.Y, to.X, to.Y, route_color(edge.Route)))
+	}
+	for _, stop := range network.Stops {
+		body = append(body, svg_stop(network, stop, positions[stop.ID])...)
+	}
+
+	return write_svg(w, options, "Geographic map of "+build_route_list_name(network.Routes), body)
+}
+
+// schematic_strip is one straight line of the schematic: a route's first branch, or a later branch from
+// where it leaves the stops already drawn for the route to where it rejoins them. Shared marks those
+// stops at either end (or in between), which the strip joins up with rather than drawing again.
+type schematic_strip struct {
+	Route  Route
+	Stops  []Stop
+	Shared []bool
+}
+
+func schematic_strips(network Network) []schematic_strip {
+	strips := []schematic_strip{}
+	for _, route := range network.Routes {
+		drawn := map[string]bool{}
+		for _, branch := range network.branches(route) {
+			first, last := -1, -1
+			for i, stop := range branch {
+				if !drawn[stop.ID] {
+					if first < 0 {
+						first = i
+					}
+					last = i
+				}
+			}
+			if first < 0 {
+				continue
+			}
+			first, last = max(first-1, 0), min(last+1, len(branch)-1)
+
+			strip := schematic_strip{Route: route, Stops: []Stop{}, Shared: []bool{}}
+			for _, stop := range branch[first : last+1] {
+				strip.Stops = append(strip.Stops, stop)
+				strip.Shared = append(strip.Shared, drawn[stop.ID])
+			}
+			for _, stop := range branch {
+				drawn[stop.ID] = true
+			}
+			strips = append(strips, strip)
+		}
+	}
+	return strips
+}
+
+// schematic_columns puts each strip's stops in consecutive columns, and then pushes stops along so that a
+// transfer station sits in the same column on every route it appears on, and a branch starts in the column
+// it leaves its trunk from. Routes that visit two transfer stations in opposite orders can't both be lined
+// up, so we give up after a bounded number of passes.
+func schematic_columns(strips []schematic_strip) ([][]int, int) {
+	columns := [][]int{}
+	appearances := map[string][][2]int{}
+	stops := []string{}
+	total := 0
+	for row, strip := range strips {
+		stripColumns := []int{}
+		for i, stop := range strip.Stops {
+			stripColumns = append(stripColumns, i)
+			if len(appearances[stop.ID]) == 0 {
+				stops = append(stops, stop.ID)
+			}
+			appearances[stop.ID] = append(appearances[stop.ID], [2]int{row, i})
+			total++
+		}
+		columns = append(columns, stripColumns)
+	}
+
+	for pass := 0; pass < total; pass++ {
+		changed := false
+		for _, stop := range stops {
+			target := 0
+			for _, at := range appearances[stop] {
+				if columns[at[0]][at[1]] > target {
+					target = columns[at[0]][at[1]]
+				}
+			}
+			for _, at := range appearances[stop] {
+				shift := target - columns[at[0]][at[1]]
+				if shift == 0 {
+					continue
+				}
+				for i := at[1]; i < len(columns[at[0]]); i++ {
+					columns[at[0]][i] += shift
+				}
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	maxColumn := 0
+	for _, stripColumns := range columns {
+		for _, column := range stripColumns {
+			if column > maxColumn {
+				maxColumn = column
+			}
+		}
+	}
+	return columns, maxColumn
+}
+
+// render_schematic_svg straightens every route out into its own horizontal line, the way a strip map
+// above a train door does, with each later branch on a line below that leaves and rejoins the route where
+// its trains do. A transfer station shows up once on each of its routes, lined up in the same column
+// where possible, and those appearances are joined by a thin connector.
+func render_schematic_svg(w io.Writer, network Network, options MapOptions) error {
+	strips := schematic_strips(network)
+	rowGap := 0.0
+	if len(strips) > 1 {
+		rowGap = (options.Height - 2*svgMargin) / float64(len(strips)-1)
+	}
+	columns, maxColumn := schematic_columns(strips)
+	stepX := 0.0
+	if maxColumn > 0 {
+		stepX = (options.Width - 2*svgMargin) / float64(maxColumn)
+	}
+
+	appearances := map[string][]svg_point{}
+	routePoints := map[[2]string]svg_point{}
+	lines := []string{}
+	stops := []string{}
+
+	for row, strip := range strips {
+		y := svgMargin + float64(row)*rowGap
+		points := []string{}
+		branch := false
+		for i, stop := range strip.Stops {
+			point := svg_point{X: svgMargin + stepX*float64(columns[row][i]), Y: y}
+			if strip.Shared[i] {
+				point = routePoints[[2]string{strip.Route.ID, stop.ID}]
+				branch = true
+			} else {
+				routePoints[[2]string{strip.Route.ID, stop.ID}] = point
+				appearances[stop.ID] = append(appearances[stop.ID], point)
+				stops = append(stops, svg_stop(network, stop, point)...)
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", point.X, point.Y))
+		}
+
+		if branch {
+			lines = append(lines, fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="6" stroke-linecap="round" stroke-linejoin="round"/>`,
+				strings.Join(points, " "), route_color(strip.Route)))
+			continue
+		}
+		firstX := svgMargin + stepX*float64(columns[row][0])
+		lastX := svgMargin + stepX*float64(columns[row][len(strip.Stops)-1])
+		lines = append(lines, fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="6" stroke-linecap="round"/>`,
+			firstX, y, lastX, y, route_color(strip.Route)))
+		lines = append(lines, fmt.Sprintf(`<text x="%.1f" y="%.1f" font-size="12" font-weight="bold" text-anchor="end">%s</text>`,
+			firstX-10, y+4, svg_escape(strip.Route.Attribute.LongName)))
+	}
+
+	connectors := []string{}
+	for _, stop := range network.Stops {
+		points := appearances[stop.ID]
+		for i := 1; i < len(points); i++ {
+			connectors = append(connectors, fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#888888" stroke-width="1" stroke-dasharray="4 3"/>`,
+				points[i-1].X, points[i-1].Y, points[i].X, points[i].Y))
+		}
+	}
+
+	body := append(append(connectors, lines...), stops...)
+	return write_svg(w, options, "Schematic map of "+build_route_list_name(network.Routes), body)
+}
+
+func svg_stop(network Network, stop Stop, point svg_point) []string {
+	circle := fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="%.1f" fill="#FFFFFF" stroke="#000000" stroke-width="1"/>`, point.X, point.Y, svgStopRadius)
+	if is_transfer_stop(network, stop) {
+		circle = fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="%.1f" fill="#FFFFFF" stroke="#000000" stroke-width="3"/>`, point.X, point.Y, svgTransferRad)
+	}
+	label := fmt.Sprintf(`<text x="%.1f" y="%.1f" font-size="9" transform="rotate(-45 %.1f %.1f)">%s</text>`,
+		point.X+8, point.Y-8, point.X+8, point.Y-8, svg_escape(stop.Attribute.Name))
+	return []string{circle, label}
+}
+
+func write_svg(w io.Writer, options MapOptions, title string, body []string) error {
+	lines := []string{
+		fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Helvetica, Arial, sans-serif">`,
+			options.Width, options.Height, options.Width, options.Height),
+		fmt.Sprintf(`<title>%s</title>`, svg_escape(title)),
+		fmt.Sprintf(`<rect width="%.0f" height="%.0f" fill="#FFFFFF"/>`, options.Width, options.Height),
+	}
+	for _, line := range body {
+		lines = append(lines, "  "+line)
+	}
+	lines = append(lines, "</svg>")
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+func svg_escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(text)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+// check_golden compares output against testdata/<name>, or rewrites that file when run with -update.
+func check_golden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read the golden file (run with -update to create it): %s", err)
+	}
+	if !bytes.Equal(expected, output) {
+		t.Errorf("output does not match %s (run with -update if the change is intended):\n%s", path, output)
+	}
+}
+
+func mock_render_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line", Color: "DA291C"}}
+	orange := Route{ID: "Orange", Attribute: RouteAttribute{LongName: "Orange Line", Color: "ED8B00"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife", Latitude: 42.3954, Longitude: -71.1425}}
+	harvard := Stop{ID: "place-harsq", Attribute: StopAttribute{Name: "Harvard", Latitude: 42.3734, Longitude: -71.1189}}
+	downtown := Stop{ID: "place-dwnxg", Attribute: StopAttribute{Name: "Downtown Crossing", Latitude: 42.3555, Longitude: -71.0602}}
+	oak := Stop{ID: "place-ogmnl", Attribute: StopAttribute{Name: "Oak Grove", Latitude: 42.4367, Longitude: -71.0711}}
+	forest := Stop{ID: "place-forhl", Attribute: StopAttribute{Name: "Forest Hills & <Arborway>", Latitude: 42.3005, Longitude: -71.1137}}
+
+	return Network{
+		Routes: []Route{red, orange},
+		Stops:  []Stop{alewife, harvard, downtown, oak, forest},
+		RouteStops: map[Route][]Stop{
+			red:    []Stop{alewife, harvard, downtown},
+			orange: []Stop{oak, downtown, forest},
+		},
+		StopRoutes: map[Stop][]Route{
+			alewife:  []Route{red},
+			harvard:  []Route{red},
+			downtown: []Route{red, orange},
+			oak:      []Route{orange},
+			forest:   []Route{orange},
+		},
+	}
+}
+
+func Test_render_map_svg(t *testing.T) {
+	network := mock_render_network()
+
+	t.Run("happy path - geographic", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := render_map_svg(out, network, MapOptions{Layout: "geographic", Width: 600, Height: 400}); err != nil {
+			t.Error("did not expect an error")
+		}
+		check_golden(t, "render_geographic.svg", out.Bytes())
+	})
+
+	t.Run("happy path - schematic", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := render_map_svg(out, network, MapOptions{Layout: "schematic", Width: 600, Height: 400}); err != nil {
+			t.Error("did not expect an error")
+		}
+		check_golden(t, "render_schematic.svg", out.Bytes())
+	})
+
+	t.Run("happy path - schematic of one route", func(t *testing.T) {
+		red, err := filter_network_routes(network, []string{"Red Line"})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		out := &bytes.Buffer{}
+		if err := render_map_svg(out, red, MapOptions{Layout: "schematic", Width: 600, Height: 400}); err != nil {
+			t.Error("did not expect an error")
+		}
+		check_golden(t, "render_schematic_red.svg", out.Bytes())
+	})
+
+	t.Run("happy path - schematic of a branching route", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := render_map_svg(out, mock_branching_network(), MapOptions{Layout: "schematic", Width: 600, Height: 400}); err != nil {
+			t.Error("did not expect an error")
+		}
+		check_golden(t, "render_schematic_branches.svg", out.Bytes())
+	})
+
+	t.Run("sad path - unknown layout", func(t *testing.T) {
+		err := render_map_svg(&bytes.Buffer{}, network, MapOptions{Layout: "isometric", Width: 600, Height: 400})
+		if err != ErrUnknownLayout {
+			t.Errorf("expected error %s to be %s", err, ErrUnknownLayout)
+		}
+	})
+}
+
+func Test_filter_network_routes(t *testing.T) {
+	network := mock_render_network()
+
+	t.Run("happy path - no filter", func(t *testing.T) {
+		filtered, err := filter_network_routes(network, []string{})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(filtered.Routes) != 2 || len(filtered.Stops) != 5 {
+			t.Errorf("expected the whole network, got %+v", filtered)
+		}
+	})
+
+	t.Run("happy path - one route", func(t *testing.T) {
+		filtered, err := filter_network_routes(network, []string{" Orange "})
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(filtered.Routes) != 1 || len(filtered.Stops) != 3 {
+			t.Errorf("expected just the Orange Line, got %+v", filtered)
+		}
+		if is_transfer_stop(filtered, network.Stops[2]) {
+			t.Error("did not expect Downtown Crossing to be a transfer with only one route")
+		}
+	})
+
+	t.Run("sad path - unknown route", func(t *testing.T) {
+		_, err := filter_network_routes(network, []string{"Silver Line"})
+		if err != ErrNoRoute {
+			t.Errorf("expected error %s to be %s", err, ErrNoRoute)
+		}
+	})
+}
+
+func Test_schematic_strips(t *testing.T) {
+	t.Run("happy path - a later branch joins the trunk", func(t *testing.T) {
+		network := mock_branching_network()
+		red := network.Routes[0]
+		alewife, jfk, savin, ashmont, quincy, braintree := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3], network.Stops[4], network.Stops[5]
+
+		expected := []schematic_strip{
+			{Route: red, Stops: []Stop{alewife, jfk, quincy, braintree}, Shared: []bool{false, false, false, false}},
+			{Route: red, Stops: []Stop{jfk, savin, ashmont}, Shared: []bool{true, false, false}},
+		}
+		strips := schematic_strips(network)
+		if !reflect.DeepEqual(expected, strips) {
+			t.Errorf("expected %+v to be equal to %+v", expected, strips)
+		}
+	})
+
+	t.Run("happy path - one strip per route without branches", func(t *testing.T) {
+		strips := schematic_strips(mock_render_network())
+		if len(strips) != 2 {
+			t.Errorf("expected 2 strips, got %d", len(strips))
+		}
+	})
+}
+
+func Test_schematic_columns(t *testing.T) {
+	t.Run("happy path - transfers line up", func(t *testing.T) {
+		columns, maxColumn := schematic_columns(schematic_strips(mock_render_network()))
+
+		expected := [][]int{{0, 1, 2}, {0, 2, 3}}
+		if !reflect.DeepEqual(expected, columns) || maxColumn != 3 {
+			t.Errorf("expected %v (max 3) to be equal to %v (max %d)", expected, columns, maxColumn)
+		}
+	})
+
+	t.Run("happy path - a branch starts below its trunk", func(t *testing.T) {
+		columns, maxColumn := schematic_columns(schematic_strips(mock_branching_network()))
+
+		expected := [][]int{{0, 1, 2, 3}, {1, 2, 3}}
+		if !reflect.DeepEqual(expected, columns) || maxColumn != 3 {
+			t.Errorf("expected %v (max 3) to be equal to %v (max %d)", expected, columns, maxColumn)
+		}
+	})
+
+	t.Run("happy path - crossing transfers terminate", func(t *testing.T) {
+		a := Stop{ID: "a"}
+		b := Stop{ID: "b"}
+		one := Route{ID: "one"}
+		two := Route{ID: "two"}
+		network := Network{
+			Routes:     []Route{one, two},
+			Stops:      []Stop{a, b},
+			RouteStops: map[Route][]Stop{one: []Stop{a, b}, two: []Stop{b, a}},
+			StopRoutes: map[Stop][]Route{a: []Route{one, two}, b: []Route{one, two}},
+		}
+
+		columns, _ := schematic_columns(schematic_strips(network))
+		if len(columns) != 2 || len(columns[0]) != 2 || len(columns[1]) != 2 {
+			t.Errorf("expected a column for every stop, got %v", columns)
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	ErrUnknownCommand    = errors.New("unknown command (try \"help\")")
+	ErrWrongArguments    = errors.New("wrong number of arguments (try \"help\")")
+)
+
+const replHelp = `Commands:
+  plan <from stop> <to stop>   list the routes to take (and any walks) between two stops
+  departures <stop>            show the next departures from a stop
+  stop info <stop>             show a stop's routes, platforms, accessibility and next departures
+  route info <route>           show a route's directions and the stops along each branch
+  routes                       list every route
+  stops                        list every stop
+  stops near <lat,lon>         list the stops closest to a coordinate, e.g. stops near 42.35,-71.06
+  help                         show this message
+  quit                         leave
+Names with spaces need quotes, e.g. plan "Park Street" Kenmore. Tab completes stop and route names.
+Plans can also start or end at a coordinate, e.g. plan 42.35,-71.06 Kenmore, or at a known address.
+`
+
+var replCommands = []string{"departures", "help", "plan", "quit", "route", "routes", "stop", "stops"}
+
+func run_repl(api MBTAWebServer, options PlanOptions, in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "Loading the route network...")
+	network, err := build_network(api)
+	if err != nil {
+		return err
+	}
+	// The elevator outages are only fetched once here, which is fine for the length of a session.
+	options, err = with_accessibility(api, options)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Loaded %d routes and %d stops. Type \"help\" for a list of commands.\n", len(network.Routes), len(network.Stops))
+
+	editor := new_line_editor(in, out)
+	editor.Complete = func(line string) (int, []string) {
+		return complete_repl_line(network, line)
+	}
+
+	for {
+		line, err := editor.ReadLine("mbta> ")
+		if err == ErrInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := parse_repl_line(line)
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			return nil
+		}
+
+		if err := run_repl_command(api, network, options, args, out, time.Now()); err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+		}
+	}
+}
+
+func run_repl_command(api MBTAWebServer, network Network, options PlanOptions, args []string, out io.Writer, now time.Time) error {
+	switch {
+	case args[0] == "help":
+		fmt.Fprint(out, replHelp)
+	case args[0] == "routes":
+		for _, name := range network.route_names() {
+			fmt.Fprintln(out, name)
+		}
+	case args[0] == "stops" && len(args) > 1 && args[1] == "near":
+		if len(args) != 3 {
+			return ErrWrongArguments
+		}
+		point, err := parse_coordinate(args[2])
+		if err != nil {
+			return err
+		}
+		print_nearby_stops(out, network, new_stop_index(network.Stops).Nearest(point, 5))
+	case args[0] == "stops":
+		for _, name := range network.stop_names() {
+			fmt.Fprintln(out, name)
+		}
+	case args[0] == "plan":
+		if len(args) != 3 {
+			return ErrWrongArguments
+		}
+		itineraries, err := plan_place_names(network, args[1], args[2], options)
+		if err != nil {
+			return err
+		}
+		print_itineraries(out, args[1], args[2], itineraries, estimate_trips(network, itineraries, options.TransferPenaltyMinutes))
+	case args[0] == "departures":
+		if len(args) != 2 {
+			return ErrWrongArguments
+		}
+		stop, ok := network.find_stop_by_name(args[1])
+		if !ok {
+			return ErrNoStop
+		}
+		predictions, err := api.GetPredictions(stop)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Departures from %s:\n", stop.Attribute.Name)
+		lines := format_departures(network, predictions.Data, now)
+		if len(lines) == 0 {
+			fmt.Fprintln(out, "No upcoming departures")
+		}
+		for _, line := range lines {
+			fmt.Fprintln(out, line)
+		}
+	case args[0] == "stop" && len(args) > 1 && args[1] == "info":
+		if len(args) != 3 {
+			return ErrWrongArguments
+		}
+		info, err := fetch_stop_info(api, network, args[2], now)
+		if err != nil {
+			return err
+		}
+		print_stop_info(out, info)
+	case args[0] == "route" && len(args) > 1 && args[1] == "info":
+		if len(args) != 3 {
+			return ErrWrongArguments
+		}
+		info, err := fetch_route_info(api, network, args[2])
+		if err != nil {
+			return err
+		}
+		print_route_info(out, info)
+	default:
+		return ErrUnknownCommand
+	}
+	return nil
+}
+
+type DepartureGroup struct {
+	Label string   `json:"label"`
+	Times []string `json:"times"`
+}
+
+// group_departures groups the predictions by route and direction, keeping the order the API sorted
+// them in, and shows how many minutes away the next few departures are for each group.
+func group_departures(network Network, predictions []Prediction, now time.Time, perGroup int) []DepartureGroup {
+	groups := []DepartureGroup{}
+	groupIndex := map[string]int{}
+
+	for _, prediction := range predictions {
+		departure := prediction.Attribute.DepartureTime
+		if departure == "" {
+			departure = prediction.Attribute.ArrivalTime
+		}
+		at, err := time.Parse(time.RFC3339, departure)
+		if err != nil {
+			continue
+		}
+
+		routeName := prediction.Relationships.Route.Data.ID
+		if route, ok := network.find_route_by_id(routeName); ok {
+			routeName = route.Attribute.LongName
+		}
+		label := fmt.Sprintf("%s (direction %d)", routeName, prediction.Attribute.DirectionID)
+
+		index, ok := groupIndex[label]
+		if !ok {
+			index = len(groups)
+			groupIndex[label] = index
+			groups = append(groups, DepartureGroup{Label: label, Times: []string{}})
+		}
+		if len(groups[index].Times) < perGroup {
+			groups[index].Times = append(groups[index].Times, format_minutes_away(at, now))
+		}
+	}
+
+	return groups
+}
+
+func format_departures(network Network, predictions []Prediction, now time.Time) []string {
+	lines := []string{}
+	for _, group := range group_departures(network, predictions, now, 3) {
+		lines = append(lines, fmt.Sprintf("%s: %s", group.Label, strings.Join(group.Times, ", ")))
+	}
+	return lines
+}
+
+func format_minutes_away(at time.Time, now time.Time) string {
+	minutes := int(at.Sub(now).Minutes())
+	if minutes <= 0 {
+		return "now"
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+type repl_tokens struct {
+	Complete []string
+	// Partial is the word the line ends in, which has not been followed by any whitespace yet.
+	Partial       string
+	PartialStart  int
+	PartialQuoted bool
+	InQuote       bool
+}
+
+func tokenize_repl_line(line string) repl_tokens {
+	tokens := repl_tokens{Complete: []string{}}
+	current := []rune{}
+	inWord := false
+
+	for i, r := range line {
+		switch {
+		case r == '"':
+			if !inWord {
+				inWord = true
+				tokens.PartialStart = i
+				tokens.PartialQuoted = true
+			}
+			tokens.InQuote = !tokens.InQuote
+		case r == ' ' && !tokens.InQuote:
+			if inWord {
+				tokens.Complete = append(tokens.Complete, string(current))
+				current = []rune{}
+				inWord = false
+				tokens.PartialQuoted = false
+			}
+		default:
+			if !inWord {
+				inWord = true
+				tokens.PartialStart = i
+			}
+			current = append(current, r)
+		}
+	}
+
+	if !inWord {
+		tokens.PartialStart = len(line)
+	}
+	tokens.Partial = string(current)
+	return tokens
+}
+
+func parse_repl_line(line string) ([]string, error) {
+	tokens := tokenize_repl_line(strings.TrimSpace(line))
+	if tokens.InQuote {
+		return nil, ErrUnterminatedQuote
+	}
+	args := tokens.Complete
+	if tokens.Partial != "" || tokens.PartialQuoted {
+		args = append(args, tokens.Partial)
+	}
+	return args, nil
+}
+
+func complete_repl_line(network Network, line string) (int, []string) {
+	tokens := tokenize_repl_line(line)
+
+	options := []string{}
+	switch args := tokens.Complete; {
+	case len(args) == 0:
+		options = replCommands
+	case len(args) == 1 && (args[0] == "stop" || args[0] == "route"):
+		options = []string{"info"}
+	case len(args) == 1 && args[0] == "stops":
+		options = []string{"near"}
+	case args[0] == "plan" && len(args) <= 2:
+		options = network.stop_names()
+	case args[0] == "departures" && len(args) == 1:
+		options = network.stop_names()
+	case args[0] == "stop" && args[1] == "info" && len(args) == 2:
+		options = network.stop_names()
+	case args[0] == "route" && args[1] == "info" && len(args) == 2:
+		options = network.route_names()
+		sort.Strings(options)
+	}
+
+	candidates := []string{}
+	for _, option := range options {
+		if strings.HasPrefix(strings.ToLower(option), strings.ToLower(tokens.Partial)) {
+			candidates = append(candidates, quote_repl_arg(option)+" ")
+		}
+	}
+	return tokens.PartialStart, candidates
+}
+
+func quote_repl_arg(arg string) string {
+	if strings.Contains(arg, " ") {
+		return `"` + arg + `"`
+	}
+	return arg
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mock_repl_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore"}}
+
+	return Network{
+		Routes: []Route{red, green},
+		Stops:  []Stop{alewife, park, kenmore},
+		RouteStops: map[Route][]Stop{
+			red:   []Stop{alewife, park},
+			green: []Stop{park, kenmore},
+		},
+		StopRoutes: map[Stop][]Route{
+			alewife: []Route{red},
+			park:    []Route{red, green},
+			kenmore: []Route{green},
+		},
+	}
+}
+
+func Test_parse_repl_line(t *testing.T) {
+	t.Run("happy path - plain words", func(t *testing.T) {
+		expected := []string{"plan", "Alewife", "Kenmore"}
+
+		args, err := parse_repl_line("  plan Alewife   Kenmore ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, args) {
+			t.Errorf("expected %s to be equal to %s", expected, args)
+		}
+	})
+
+	t.Run("happy path - quoted words", func(t *testing.T) {
+		expected := []string{"plan", "Park Street", "Kenmore"}
+
+		args, err := parse_repl_line(`plan "Park Street" Kenmore`)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, args) {
+			t.Errorf("expected %s to be equal to %s", expected, args)
+		}
+	})
+
+	t.Run("happy path - empty line", func(t *testing.T) {
+		args, err := parse_repl_line("   ")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(args) != 0 {
+			t.Errorf("expected %s to be empty", args)
+		}
+	})
+
+	t.Run("sad path - unterminated quote", func(t *testing.T) {
+		_, err := parse_repl_line(`plan "Park Street`)
+		if err != ErrUnterminatedQuote {
+			t.Errorf("expected error %s to be %s", err, ErrUnterminatedQuote)
+		}
+	})
+}
+
+func Test_complete_repl_line(t *testing.T) {
+	network := mock_repl_network()
+
+	t.Run("happy path - command names", func(t *testing.T) {
+		start, candidates := complete_repl_line(network, "ro")
+
+		expected := []string{"route ", "routes "}
+		if start != 0 {
+			t.Errorf("expected start %d to be 0", start)
+		}
+		if !reflect.DeepEqual(expected, candidates) {
+			t.Errorf("expected %s to be equal to %s", expected, candidates)
+		}
+	})
+
+	t.Run("happy path - stop names are quoted", func(t *testing.T) {
+		start, candidates := complete_repl_line(network, "plan Alewife pa")
+
+		expected := []string{`"Park Street" `}
+		if start != 13 {
+			t.Errorf("expected start %d to be 13", start)
+		}
+		if !reflect.DeepEqual(expected, candidates) {
+			t.Errorf("expected %s to be equal to %s", expected, candidates)
+		}
+	})
+
+	t.Run("happy path - inside an open quote", func(t *testing.T) {
+		start, candidates := complete_repl_line(network, `departures "Park S`)
+
+		expected := []string{`"Park Street" `}
+		if start != 11 {
+			t.Errorf("expected start %d to be 11", start)
+		}
+		if !reflect.DeepEqual(expected, candidates) {
+			t.Errorf("expected %s to be equal to %s", expected, candidates)
+		}
+	})
+
+	t.Run("happy path - route names", func(t *testing.T) {
+		_, candidates := complete_repl_line(network, "route info ")
+
+		expected := []string{`"Green Line B" `, `"Red Line" `}
+		if !reflect.DeepEqual(expected, candidates) {
+			t.Errorf("expected %s to be equal to %s", expected, candidates)
+		}
+	})
+
+	t.Run("sad path - too many arguments", func(t *testing.T) {
+		_, candidates := complete_repl_line(network, "departures Alewife K")
+		if len(candidates) != 0 {
+			t.Errorf("expected %s to be empty", candidates)
+		}
+	})
+}
+
+func Test_format_departures(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	predictions := []Prediction{
+		{
+			Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:00:30Z", DirectionID: 0},
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+		},
+		{
+			Attribute:     PredictionAttribute{ArrivalTime: "2020-01-01T12:04:00Z", DirectionID: 1},
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+		},
+		{
+			Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:07:10Z", DirectionID: 0},
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+		},
+		{
+			Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:09:00Z", DirectionID: 0},
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Unknown"}}},
+		},
+		{
+			Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+		},
+	}
+
+	expected := []string{
+		"Red Line (direction 0): now, 7 min",
+		"Red Line (direction 1): 4 min",
+		"Unknown (direction 0): 9 min",
+	}
+
+	lines := format_departures(mock_repl_network(), predictions, now)
+	if !reflect.DeepEqual(expected, lines) {
+		t.Errorf("expected %s to be equal to %s", expected, lines)
+	}
+}
+
+func Test_run_repl_command(t *testing.T) {
+	network := mock_repl_network()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("happy path - plan", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"plan", "Alewife", "Kenmore"}, out, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "Take the following routes to get from Alewife to Kenmore:\nRed Line\nGreen Line B\n"
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+	})
+
+	t.Run("happy path - stops near", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := run_repl_command(&MockMBTAWebServer{}, mock_walking_network(), PlanOptions{}, []string{"stops", "near", "42.3555,-71.0602"}, out, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "Downtown Crossing (3 m): Orange Line\nPark Street (208 m): Green Line B\nState (442 m): Orange Line\nKenmore (2964 m): Green Line B\n"
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+	})
+
+	t.Run("happy path - departures", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		mockAPI := &MockMBTAWebServer{
+			ReturnPredictionWrapper: map[string]PredictionWrapper{
+				"place-pktrm": PredictionWrapper{
+					Data: []Prediction{
+						{
+							Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:03:00Z"},
+							Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+						},
+					},
+				},
+			},
+		}
+
+		err := run_repl_command(mockAPI, network, PlanOptions{}, []string{"departures", "Park Street"}, out, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "Departures from Park Street:\nRed Line (direction 0): 3 min\n"
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+	})
+
+	t.Run("happy path - stop info", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"stop", "info", "Park Street"}, out, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "Park Street (place-pktrm)\nRoutes: Red Line, Green Line B\nAccessibility: no wheelchair accessibility information\nNo upcoming departures\n"
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+	})
+
+	t.Run("happy path - route info", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"route", "info", "Red Line"}, out, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+
+		expected := "Red Line (Red)\nType: light rail\nColor: #000000\nStops: 2\n\nAlewife to Park Street (2 stops):\n  Alewife\n  Park Street\n"
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", expected, out.String())
+		}
+	})
+
+	t.Run("sad path - departures lookup fails", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := &MockMBTAWebServer{ReturnPredictionWrapperError: myErr}
+
+		err := run_repl_command(mockAPI, network, PlanOptions{}, []string{"departures", "Park Street"}, &bytes.Buffer{}, now)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+
+	t.Run("sad path - unknown stop", func(t *testing.T) {
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"stop", "info", "Nowhere"}, &bytes.Buffer{}, now)
+		if err != ErrNoStop {
+			t.Errorf("expected error %s to be %s", err, ErrNoStop)
+		}
+	})
+
+	t.Run("sad path - stops near a bad coordinate", func(t *testing.T) {
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"stops", "near", "Boston"}, &bytes.Buffer{}, now)
+		if err != ErrBadCoordinate {
+			t.Errorf("expected error %s to be %s", err, ErrBadCoordinate)
+		}
+	})
+
+	t.Run("sad path - unknown command", func(t *testing.T) {
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"teleport"}, &bytes.Buffer{}, now)
+		if err != ErrUnknownCommand {
+			t.Errorf("expected error %s to be %s", err, ErrUnknownCommand)
+		}
+	})
+
+	t.Run("sad path - wrong arguments", func(t *testing.T) {
+		err := run_repl_command(&MockMBTAWebServer{}, network, PlanOptions{}, []string{"plan", "Alewife"}, &bytes.Buffer{}, now)
+		if err != ErrWrongArguments {
+			t.Errorf("expected error %s to be %s", err, ErrWrongArguments)
+		}
+	})
+}
+
+func Test_run_repl(t *testing.T) {
+	t.Run("happy path - piped input", func(t *testing.T) {
+		mockAPI := &MockMBTAWebServer{
+			ReturnRouteWrapper: RouteWrapper{Data: []Route{{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}}},
+			ReturnStopWrapper: map[string]StopWrapper{
+				"Red": StopWrapper{Data: []Stop{
+					{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}},
+					{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}},
+				}},
+			},
+		}
+		in := strings.NewReader("plan Alewife \"Park Street\"\nbogus\nroutes\n")
+		out := &bytes.Buffer{}
+
+		if err := run_repl(mockAPI, PlanOptions{}, in, out); err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(mockAPI.RecvRoutes) != 1 {
+			t.Errorf("expected the network to be fetched once, got %d stop requests", len(mockAPI.RecvRoutes))
+		}
+		for _, expected := range []string{"Take the following routes to get from Alewife to Park Street:\nRed Line\n", "error: " + ErrUnknownCommand.Error(), "mbta> Red Line\n"} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q to contain %q", out.String(), expected)
+			}
+		}
+	})
+}
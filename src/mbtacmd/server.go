@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NetworkCache holds on to the last Network it built for ttl, so that every request to the server
+// doesn't cost us a request per route to the MBTA API. The network changes rarely enough
+// (service changes, not trains moving) that a few minutes of staleness is fine.
+type NetworkCache struct {
+	api     MBTAWebServer
+	ttl     time.Duration
+	now     func() time.Time
+	metrics *MetricsRegistry
+
+	mutex     sync.Mutex
+	network   Network
+	fetchedAt time.Time
+	fetched   bool
+}
+
+func new_network_cache(api MBTAWebServer, ttl time.Duration, metrics *MetricsRegistry) *NetworkCache {
+	return &NetworkCache{
+		api:     api,
+		ttl:     ttl,
+		now:     time.Now,
+		metrics: metrics,
+	}
+}
+
+func (c *NetworkCache) Get() (Network, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.fetched && c.now().Sub(c.fetchedAt) < c.ttl {
+		c.metrics.Inc("mbtacmd_network_cache_requests_total", "hit")
+		return c.network, nil
+	}
+	c.metrics.Inc("mbtacmd_network_cache_requests_total", "miss")
+
+	network, err := build_network(c.api)
+	if err != nil {
+		return Network{}, err
+	}
+
+	c.network = network
+	c.fetchedAt = c.now()
+	c.fetched = true
+	return network, nil
+}
+
+type Server struct {
+	api     MBTAWebServer
+	cache   *NetworkCache
+	metrics *MetricsRegistry
+	now     func() time.Time
+	// planOptions are the planner defaults, which a request can override with query parameters.
+	planOptions PlanOptions
+}
+
+func new_server(api MBTAWebServer, cacheTTL time.Duration, metrics *MetricsRegistry) *Server {
+	return &Server{
+		api:         api,
+		cache:       new_network_cache(api, cacheTTL, metrics),
+		metrics:     metrics,
+		now:         time.Now,
+		planOptions: default_plan_options(),
+	}
+}
+
+var serverPaths = []string{"/routes", "/stats", "/connections", "/plan", "/near", "/reach", "/departures", "/metrics"}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes", s.handle_routes)
+	mux.HandleFunc("/stats", s.handle_stats)
+	mux.HandleFunc("/connections", s.handle_connections)
+	mux.HandleFunc("/plan", s.handle_plan)
+	mux.HandleFunc("/near", s.handle_near)
+	mux.HandleFunc("/reach", s.handle_reach)
+	mux.HandleFunc("/departures", s.handle_departures)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics)
+	}
+	return s.count_requests(mux)
+}
+
+type status_recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *status_recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (s *Server) count_requests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &status_recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Anything we don't serve is lumped together, so that someone probing random URLs can't
+		// grow the metrics without bound.
+		path := "other"
+		for _, known := range serverPaths {
+			if r.URL.Path == known {
+				path = known
+			}
+		}
+		s.metrics.Inc("mbtacmd_http_requests_total", path, strconv.Itoa(recorder.status))
+	})
+}
+
+type RouteResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ConnectionResponse struct {
+	StopID   string   `json:"stop_id"`
+	StopName string   `json:"stop_name"`
+	Routes   []string `json:"routes"`
+}
+
+type PlanResponse struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Routes []RouteResponse `json:"routes"`
+	Legs   []LegResponse   `json:"legs"`
+	// Rejected explains why a quicker itinerary wasn't accessible, when asked for an accessible one.
+	Rejected []string `json:"rejected,omitempty"`
+	// Fares are only there when the server was started with fare data.
+	Fares []FareResponse `json:"fares,omitempty"`
+	// Alternatives ranks every itinerary found, the first being the one above, when asked for more than one.
+	Alternatives []ItineraryResponse `json:"alternatives,omitempty"`
+}
+
+type ItineraryResponse struct {
+	Routes    []RouteResponse `json:"routes"`
+	Legs      []LegResponse   `json:"legs"`
+	Transfers int             `json:"transfers"`
+	Stops     int             `json:"stops"`
+	Minutes   float64         `json:"minutes"`
+	Fares     []FareResponse  `json:"fares,omitempty"`
+}
+
+// FareResponse writes the amount as the exact decimal, e.g. 2.40, rather than through a float.
+type FareResponse struct {
+	Media         string      `json:"media"`
+	RiderCategory string      `json:"rider_category,omitempty"`
+	Amount        json.Number `json:"amount"`
+	Currency      string      `json:"currency,omitempty"`
+}
+
+// maxPlanAlternatives keeps a single request from asking the planner for an unbounded amount of work.
+const maxPlanAlternatives = 10
+
+// LegResponse is either a ride (with a route and how many stops along it) or a walk (with how many meters).
+type LegResponse struct {
+	Mode  string         `json:"mode"`
+	Route *RouteResponse `json:"route,omitempty"`
+	// Toward is where the route is headed, e.g. "Alewife", when the API told us.
+	Toward string  `json:"toward,omitempty"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Stops  int     `json:"stops,omitempty"`
+	Meters float64 `json:"meters,omitempty"`
+}
+
+type NearbyStopResponse struct {
+	StopID   string   `json:"stop_id"`
+	StopName string   `json:"stop_name"`
+	Meters   float64  `json:"meters"`
+	Routes   []string `json:"routes"`
+}
+
+type DeparturesResponse struct {
+	Stop       string           `json:"stop"`
+	Departures []DepartureGroup `json:"departures"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handle_routes(w http.ResponseWriter, r *http.Request) {
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	write_json(w, http.StatusOK, route_responses(network.Routes))
+}
+
+func (s *Server) handle_stats(w http.ResponseWriter, r *http.Request) {
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	minMaxData, err := collect_network_stop_data(network)
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	write_json(w, http.StatusOK, minMaxData)
+}
+
+func (s *Server) handle_connections(w http.ResponseWriter, r *http.Request) {
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	connections := []ConnectionResponse{}
+	for _, stop := range network.Stops {
+		routes := network.StopRoutes[stop]
+		if len(routes) > 1 {
+			connection := ConnectionResponse{StopID: stop.ID, StopName: stop.Attribute.Name, Routes: []string{}}
+			for _, route := range routes {
+				connection.Routes = append(connection.Routes, route.Attribute.LongName)
+			}
+			connections = append(connections, connection)
+		}
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].StopName < connections[j].StopName
+	})
+
+	write_json(w, http.StatusOK, connections)
+}
+
+func (s *Server) handle_plan(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		write_json(w, http.StatusBadRequest, ErrorResponse{Error: "both the from and to query parameters are required"})
+		return
+	}
+
+	options := s.planOptions
+	distances := []struct {
+		parameter string
+		meters    *float64
+	}{{"max_walk", &options.MaxWalkMeters}, {"max_access", &options.MaxAccessMeters}}
+	for _, distance := range distances {
+		parameter, meters := distance.parameter, distance.meters
+		value := r.URL.Query().Get(parameter)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: parameter + " must be a distance in meters"})
+			return
+		}
+		*meters = parsed
+	}
+	if accessible := r.URL.Query().Get("accessible"); accessible != "" {
+		parsed, err := strconv.ParseBool(accessible)
+		if err != nil {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: "accessible must be true or false"})
+			return
+		}
+		options.Accessible = parsed
+	}
+	if alternatives := r.URL.Query().Get("alternatives"); alternatives != "" {
+		parsed, err := strconv.Atoi(alternatives)
+		if err != nil || parsed < 1 || parsed > maxPlanAlternatives {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("alternatives must be a number from 1 to %d", maxPlanAlternatives)})
+			return
+		}
+		options.Alternatives = parsed
+	}
+	if avoid := r.URL.Query().Get("avoid"); avoid != "" {
+		options.Preferences.AvoidRoutes = split_names(avoid)
+	}
+	if via := r.URL.Query().Get("via"); via != "" {
+		options.Preferences.Via = split_names(via)
+	}
+	if prefer := r.URL.Query().Get("prefer_heavy_rail"); prefer != "" {
+		parsed, err := strconv.ParseBool(prefer)
+		if err != nil {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: "prefer_heavy_rail must be true or false"})
+			return
+		}
+		options.Preferences.PreferHeavyRail = parsed
+	}
+	if transfers := r.URL.Query().Get("max_transfers"); transfers != "" {
+		parsed, err := strconv.Atoi(transfers)
+		if err != nil || parsed < 0 {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: "max_transfers must be a number of transfers"})
+			return
+		}
+		options.Preferences.MaxRides = parsed + 1
+	}
+
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+	// Elevators break down by the hour, so unlike the network the outages always go to the API.
+	options, err = with_accessibility(s.api, options)
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	start := time.Now()
+	itineraries, err := plan_place_names(network, from, to, options)
+	s.metrics.Observe("mbtacmd_planner_duration_seconds", time.Since(start).Seconds())
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	response := PlanResponse{
+		From:     from,
+		To:       to,
+		Routes:   route_responses(itineraries[0].Routes()),
+		Legs:     leg_responses(itineraries[0]),
+		Rejected: itineraries[0].Rejected,
+		Fares:    fare_responses(itineraries[0].Fares),
+	}
+	if options.Alternatives > 1 {
+		response.Alternatives = []ItineraryResponse{}
+		estimates := estimate_trips(network, itineraries, options.TransferPenaltyMinutes)
+		for i, itinerary := range itineraries {
+			response.Alternatives = append(response.Alternatives, ItineraryResponse{
+				Routes:    route_responses(itinerary.Routes()),
+				Legs:      leg_responses(itinerary),
+				Transfers: itinerary.Transfers(),
+				Stops:     itinerary.Stops(),
+				Minutes:   math.Round(estimates[i].TotalMinutes()),
+				Fares:     fare_responses(itinerary.Fares),
+			})
+		}
+	}
+	write_json(w, http.StatusOK, response)
+}
+
+type ReachResponse struct {
+	From   string                  `json:"from"`
+	Budget string                  `json:"budget"`
+	Stops  []ReachableStopResponse `json:"stops"`
+}
+
+type ReachableStopResponse struct {
+	StopID    string        `json:"stop_id"`
+	StopName  string        `json:"stop_name"`
+	Transfers int           `json:"transfers"`
+	Stops     int           `json:"stops"`
+	Minutes   float64       `json:"minutes"`
+	Legs      []LegResponse `json:"legs"`
+}
+
+// handle_reach answers with every stop within a budget of transfers, stops or minutes of a stop, as
+// JSON, or as GeoJSON with format=geojson. Like /plan, it takes accessible=true.
+func (s *Server) handle_reach(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		write_json(w, http.StatusBadRequest, ErrorResponse{Error: "the from query parameter is required"})
+		return
+	}
+	limits := map[string]string{}
+	for _, kind := range budgetKinds {
+		limits[kind.String()] = r.URL.Query().Get(kind.String())
+	}
+	budget, err := parse_budget(limits)
+	if err != nil {
+		write_json(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	options := s.planOptions
+	if accessible := r.URL.Query().Get("accessible"); accessible != "" {
+		parsed, err := strconv.ParseBool(accessible)
+		if err != nil {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: "accessible must be true or false"})
+			return
+		}
+		options.Accessible = parsed
+	}
+
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+	options, err = with_accessibility(s.api, options)
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+	start, reachable, err := reachable_stops_from_name(network, from, budget, options)
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "geojson" {
+		write_json(w, http.StatusOK, reachable_geojson(start, reachable))
+		return
+	}
+	response := ReachResponse{From: from, Budget: budget.String(), Stops: []ReachableStopResponse{}}
+	for _, stop := range reachable {
+		response.Stops = append(response.Stops, ReachableStopResponse{
+			StopID:    stop.Stop.ID,
+			StopName:  stop.Stop.Attribute.Name,
+			Transfers: stop.Itinerary.Transfers(),
+			Stops:     stop.Itinerary.Stops(),
+			Minutes:   math.Round(stop.Estimate.TotalMinutes()),
+			Legs:      leg_responses(stop.Itinerary),
+		})
+	}
+	write_json(w, http.StatusOK, response)
+}
+
+func (s *Server) handle_near(w http.ResponseWriter, r *http.Request) {
+	point, err := parse_coordinate(r.URL.Query().Get("at"))
+	if err != nil {
+		write_json(w, http.StatusBadRequest, ErrorResponse{Error: "the at query parameter must be a coordinate as latitude,longitude"})
+		return
+	}
+	count := 5
+	if n := r.URL.Query().Get("n"); n != "" {
+		count, err = strconv.Atoi(n)
+		if err != nil || count < 1 {
+			write_json(w, http.StatusBadRequest, ErrorResponse{Error: "n must be a positive number"})
+			return
+		}
+	}
+
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	responses := []NearbyStopResponse{}
+	for _, nearby := range new_stop_index(network.Stops).Nearest(point, count) {
+		response := NearbyStopResponse{StopID: nearby.Stop.ID, StopName: nearby.Stop.Attribute.Name, Meters: nearby.Meters, Routes: []string{}}
+		for _, route := range network.StopRoutes[nearby.Stop] {
+			response.Routes = append(response.Routes, route.Attribute.LongName)
+		}
+		responses = append(responses, response)
+	}
+	write_json(w, http.StatusOK, responses)
+}
+
+func (s *Server) handle_departures(w http.ResponseWriter, r *http.Request) {
+	stopName := r.URL.Query().Get("stop")
+	if stopName == "" {
+		write_json(w, http.StatusBadRequest, ErrorResponse{Error: "the stop query parameter is required"})
+		return
+	}
+
+	network, err := s.cache.Get()
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	stop, ok := network.find_stop_by_name(stopName)
+	if !ok {
+		write_json_error(w, ErrNoStop)
+		return
+	}
+
+	// Predictions change by the second, so unlike the network they always go to the API.
+	predictions, err := s.api.GetPredictions(stop)
+	if err != nil {
+		write_json_error(w, err)
+		return
+	}
+
+	write_json(w, http.StatusOK, DeparturesResponse{
+		Stop:       stop.Attribute.Name,
+		Departures: group_departures(network, predictions.Data, s.now(), boardDeparturesPerRow),
+	})
+}
+
+func route_responses(routes []Route) []RouteResponse {
+	responses := []RouteResponse{}
+	for _, route := range routes {
+		responses = append(responses, RouteResponse{ID: route.ID, Name: route.Attribute.LongName})
+	}
+	return responses
+}
+
+func leg_responses(itinerary Itinerary) []LegResponse {
+	responses := []LegResponse{}
+	for _, leg := range itinerary.Legs {
+		response := LegResponse{Mode: "ride", From: leg.From.Attribute.Name, To: leg.To.Attribute.Name, Stops: leg.Stops}
+		if leg.Walk {
+			response = LegResponse{Mode: "walk", From: leg.From.Attribute.Name, To: leg.To.Attribute.Name, Meters: math.Round(leg.Meters)}
+		} else {
+			response.Route = &RouteResponse{ID: leg.Route.ID, Name: leg.Route.Attribute.LongName}
+			response.Toward = leg_destination(leg)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func fare_responses(fares []Fare) []FareResponse {
+	if len(fares) == 0 {
+		return nil
+	}
+	responses := []FareResponse{}
+	for _, fare := range fares {
+		responses = append(responses, FareResponse{Media: fare.Media, RiderCategory: fare.RiderCategory, Amount: json.Number(format_cents(fare.Amount)), Currency: fare.Currency})
+	}
+	return responses
+}
+
+func write_json_error(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case ErrNoStartStop, ErrNoEndStop, ErrNoStop, ErrNoRoute, ErrNoPath, ErrNoNearbyStops, ErrNoAddress:
+		status = http.StatusNotFound
+	case ErrEmptyNetwork, ErrWebFailure:
+		status = http.StatusBadGateway
+	}
+	if errors.Is(err, ErrNoAccessiblePath) {
+		status = http.StatusNotFound
+	}
+	write_json(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func write_json(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// run_server serves until it is sent SIGINT or SIGTERM, and then gives the requests in flight
+// a few seconds to finish before returning.
+func run_server(api MBTAWebServer, addr string, cacheTTL time.Duration, options PlanOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	metrics := new_mbta_metrics_registry()
+	if concrete, ok := api.(ConcreteMBTAWebServer); ok {
+		concrete.Metrics = metrics
+		api = concrete
+	}
+
+	server := new_server(api, cacheTTL, metrics)
+	server.planOptions = options
+	return serve_until_done(ctx, &http.Server{Addr: addr, Handler: server.handler()})
+}
+
+func serve_until_done(ctx context.Context, server *http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mock_server_api() *MockMBTAWebServer {
+	return &MockMBTAWebServer{
+		ReturnRouteWrapper: RouteWrapper{
+			Data: []Route{
+				{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}},
+				{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}},
+			},
+		},
+		ReturnStopWrapper: map[string]StopWrapper{
+			"Red": StopWrapper{Data: []Stop{
+				{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife", Latitude: 42.395428, Longitude: -71.142483}},
+				{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street", Latitude: 42.356395, Longitude: -71.062424}},
+			}},
+			"Green-B": StopWrapper{Data: []Stop{
+				{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street", Latitude: 42.356395, Longitude: -71.062424}},
+				{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore"}},
+			}},
+		},
+		ReturnPredictionWrapper: map[string]PredictionWrapper{
+			"place-pktrm": PredictionWrapper{Data: []Prediction{
+				{
+					Attribute:     PredictionAttribute{DepartureTime: "2020-01-01T12:05:00Z"},
+					Relationships: PredictionRelationships{Route: Relationship{Data: RelationshipData{ID: "Red"}}},
+				},
+			}},
+		},
+	}
+}
+
+func get_test_json(t *testing.T, server *httptest.Server, path string, into interface{}) int {
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", resp.Header.Get("Content-Type"))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		t.Fatalf("did not expect an error decoding: %s", err)
+	}
+	return resp.StatusCode
+}
+
+func Test_Server(t *testing.T) {
+	mockAPI := mock_server_api()
+	s := new_server(mockAPI, time.Hour, nil)
+	s.now = func() time.Time { return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC) }
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	t.Run("happy path - routes", func(t *testing.T) {
+		routes := []RouteResponse{}
+		status := get_test_json(t, server, "/routes", &routes)
+
+		expected := []RouteResponse{{ID: "Red", Name: "Red Line"}, {ID: "Green-B", Name: "Green Line B"}}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, routes) {
+			t.Errorf("expected %+v to be equal to %+v", expected, routes)
+		}
+	})
+
+	t.Run("happy path - stats", func(t *testing.T) {
+		stats := MinMaxData{}
+		status := get_test_json(t, server, "/stats", &stats)
+
+		expected := MinMaxData{
+			Min:       2,
+			MinRoutes: []string{"Red Line", "Green Line B"},
+			Max:       2,
+			MaxRoutes: []string{"Red Line", "Green Line B"},
+			Mean:      2,
+			Median:    2,
+			Histogram: map[int]int{2: 2},
+		}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, stats) {
+			t.Errorf("expected %+v to be equal to %+v", expected, stats)
+		}
+	})
+
+	t.Run("happy path - connections", func(t *testing.T) {
+		connections := []ConnectionResponse{}
+		status := get_test_json(t, server, "/connections", &connections)
+
+		expected := []ConnectionResponse{{StopID: "place-pktrm", StopName: "Park Street", Routes: []string{"Red Line", "Green Line B"}}}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, connections) {
+			t.Errorf("expected %+v to be equal to %+v", expected, connections)
+		}
+	})
+
+	t.Run("happy path - plan", func(t *testing.T) {
+		plan := PlanResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore", &plan)
+
+		expected := PlanResponse{
+			From:   "Alewife",
+			To:     "Kenmore",
+			Routes: []RouteResponse{{ID: "Red", Name: "Red Line"}, {ID: "Green-B", Name: "Green Line B"}},
+			Legs: []LegResponse{
+				{Mode: "ride", Route: &RouteResponse{ID: "Red", Name: "Red Line"}, From: "Alewife", To: "Park Street", Stops: 1},
+				{Mode: "ride", Route: &RouteResponse{ID: "Green-B", Name: "Green Line B"}, From: "Park Street", To: "Kenmore", Stops: 1},
+			},
+		}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, plan) {
+			t.Errorf("expected %+v to be equal to %+v", expected, plan)
+		}
+	})
+
+	t.Run("happy path - plan from a coordinate", func(t *testing.T) {
+		plan := PlanResponse{}
+		status := get_test_json(t, server, "/plan?from=42.3960,-71.1420&to=Kenmore&max_access=200", &plan)
+
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if len(plan.Legs) != 3 || plan.Legs[0].Mode != "walk" || plan.Legs[0].To != "Alewife" {
+			t.Errorf("expected to walk to Alewife and then ride twice, got %+v", plan.Legs)
+		}
+	})
+
+	t.Run("happy path - near", func(t *testing.T) {
+		nearby := []NearbyStopResponse{}
+		status := get_test_json(t, server, "/near?at=42.356,-71.061&n=1", &nearby)
+
+		expected := []NearbyStopResponse{{
+			StopID:   "place-pktrm",
+			StopName: "Park Street",
+			Meters:   haversine_meters(Coordinate{Latitude: 42.356, Longitude: -71.061}, Coordinate{Latitude: 42.356395, Longitude: -71.062424}),
+			Routes:   []string{"Red Line", "Green Line B"},
+		}}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, nearby) {
+			t.Errorf("expected %+v to be equal to %+v", expected, nearby)
+		}
+	})
+
+	t.Run("happy path - departures", func(t *testing.T) {
+		departures := DeparturesResponse{}
+		status := get_test_json(t, server, "/departures?stop=Park+Street", &departures)
+
+		expected := DeparturesResponse{
+			Stop:       "Park Street",
+			Departures: []DepartureGroup{{Label: "Red Line (direction 0)", Times: []string{"5 min"}}},
+		}
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, departures) {
+			t.Errorf("expected %+v to be equal to %+v", expected, departures)
+		}
+	})
+
+	t.Run("happy path - the network is only fetched once", func(t *testing.T) {
+		if len(mockAPI.RecvRoutes) != 2 {
+			t.Errorf("expected one stop request per route, got %d", len(mockAPI.RecvRoutes))
+		}
+	})
+
+	t.Run("sad path - missing plan parameters", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - no accessible plan", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&accessible=true", &body)
+
+		expected := "no accessible path between those stops: Alewife: no wheelchair accessibility information; " +
+			"Park Street: no wheelchair accessibility information; Kenmore: no wheelchair accessibility information"
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d to be %d", status, http.StatusNotFound)
+		}
+		if body.Error != expected {
+			t.Errorf("expected error %q to be %q", body.Error, expected)
+		}
+	})
+
+	t.Run("happy path - plan alternatives", func(t *testing.T) {
+		plan := PlanResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&alternatives=3", &plan)
+
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		// There is only the one way there in the mock network, and the transfer costs the default penalty.
+		if len(plan.Alternatives) != 1 || plan.Alternatives[0].Transfers != 1 || plan.Alternatives[0].Stops != 2 || plan.Alternatives[0].Minutes != 17 {
+			t.Errorf("expected one alternative with 1 transfer and 2 stops in 17 minutes, got %+v", plan.Alternatives)
+		}
+	})
+
+	t.Run("sad path - too many alternatives", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&alternatives=100", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - bad max walk", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&max_walk=far", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - avoiding the only route", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&avoid=Green%20Line%20B", &body)
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d to be %d", status, http.StatusNotFound)
+		}
+		if body.Error != ErrNoPath.Error() {
+			t.Errorf("expected error %q to be %q", body.Error, ErrNoPath.Error())
+		}
+	})
+
+	t.Run("sad path - bad max transfers", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore&max_transfers=-1", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("happy path - reach", func(t *testing.T) {
+		reach := ReachResponse{}
+		status := get_test_json(t, server, "/reach?from=Alewife&transfers=0", &reach)
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if reach.Budget != "0 transfers" || len(reach.Stops) != 1 || reach.Stops[0].StopName != "Park Street" || reach.Stops[0].Stops != 1 {
+			t.Errorf("expected only Park Street within no transfers, got %+v", reach)
+		}
+	})
+
+	t.Run("happy path - reach as GeoJSON", func(t *testing.T) {
+		collection := GeoJSONFeatureCollection{}
+		status := get_test_json(t, server, "/reach?from=Alewife&transfers=1&format=geojson", &collection)
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		// Kenmore has no coordinates in the mock, so only Alewife and Park Street are on the map.
+		if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+			t.Errorf("expected two features, got %+v", collection)
+		}
+	})
+
+	t.Run("sad path - bad reach budget", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/reach?from=Alewife&stops=3&minutes=20", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - no accessible reach", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/reach?from=Alewife&transfers=1&accessible=true", &body)
+
+		expected := "no accessible path between those stops: Alewife: no wheelchair accessibility information"
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d to be %d", status, http.StatusNotFound)
+		}
+		if body.Error != expected {
+			t.Errorf("expected error %q to be %q", body.Error, expected)
+		}
+	})
+
+	t.Run("sad path - reach can't fetch the outages", func(t *testing.T) {
+		mockAPI.ReturnFacilityWrapperError = ErrWebFailure
+		defer func() { mockAPI.ReturnFacilityWrapperError = nil }()
+
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/reach?from=Alewife&transfers=1&accessible=true", &body)
+		if status != http.StatusBadGateway {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadGateway)
+		}
+	})
+
+	t.Run("sad path - bad reach accessibility", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/reach?from=Alewife&transfers=1&accessible=maybe", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - bad near coordinate", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/near?at=Boston", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sad path - unknown stop", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Nowhere", &body)
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d to be %d", status, http.StatusNotFound)
+		}
+		if body.Error != ErrNoEndStop.Error() {
+			t.Errorf("expected error %q to be %q", body.Error, ErrNoEndStop.Error())
+		}
+	})
+
+	t.Run("sad path - missing departures parameter", func(t *testing.T) {
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/departures", &body)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func Test_Server_fares(t *testing.T) {
+	rules, err := load_fare_rules("testdata/fares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := new_server(mock_server_api(), time.Hour, nil)
+	s.planOptions.Fares = &rules
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	t.Run("happy path - plan with fares", func(t *testing.T) {
+		expected := []FareResponse{
+			{Media: "Card", Amount: "2.40", Currency: "USD"},
+			{Media: "Ticket", Amount: "2.40", Currency: "USD"},
+			{Media: "Card", RiderCategory: "Reduced", Amount: "1.10", Currency: "USD"},
+		}
+
+		plan := PlanResponse{}
+		status := get_test_json(t, server, "/plan?from=Alewife&to=Kenmore", &plan)
+		if status != http.StatusOK {
+			t.Errorf("expected status %d to be %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(expected, plan.Fares) {
+			t.Errorf("expected %+v to be equal to %+v", expected, plan.Fares)
+		}
+	})
+}
+
+func Test_Server_upstream_failures(t *testing.T) {
+	t.Run("sad path - network lookup fails", func(t *testing.T) {
+		server := httptest.NewServer(new_server(&MockMBTAWebServer{ReturnRouteWrapperError: ErrWebFailure}, time.Hour, nil).handler())
+		defer server.Close()
+
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/routes", &body)
+		if status != http.StatusBadGateway {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadGateway)
+		}
+	})
+
+	t.Run("sad path - predictions fail", func(t *testing.T) {
+		mockAPI := mock_server_api()
+		mockAPI.ReturnPredictionWrapperError = errors.New("custom mock error")
+		server := httptest.NewServer(new_server(mockAPI, time.Hour, nil).handler())
+		defer server.Close()
+
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/departures?stop=Park+Street", &body)
+		if status != http.StatusInternalServerError {
+			t.Errorf("expected status %d to be %d", status, http.StatusInternalServerError)
+		}
+		if body.Error != "custom mock error" {
+			t.Errorf("expected error %q to be %q", body.Error, "custom mock error")
+		}
+	})
+
+	t.Run("sad path - empty network stats", func(t *testing.T) {
+		server := httptest.NewServer(new_server(&MockMBTAWebServer{}, time.Hour, nil).handler())
+		defer server.Close()
+
+		body := ErrorResponse{}
+		status := get_test_json(t, server, "/stats", &body)
+		if status != http.StatusBadGateway {
+			t.Errorf("expected status %d to be %d", status, http.StatusBadGateway)
+		}
+	})
+}
+
+func Test_NetworkCache(t *testing.T) {
+	mockAPI := mock_server_api()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := new_network_cache(mockAPI, time.Minute, nil)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(); err != nil {
+			t.Fatal("did not expect an error")
+		}
+	}
+	if len(mockAPI.RecvRoutes) != 2 {
+		t.Errorf("expected the network to be fetched once, got %d stop requests", len(mockAPI.RecvRoutes))
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Get(); err != nil {
+		t.Fatal("did not expect an error")
+	}
+	if len(mockAPI.RecvRoutes) != 4 {
+		t.Errorf("expected the network to be fetched again after the ttl, got %d stop requests", len(mockAPI.RecvRoutes))
+	}
+
+	mockAPI.ReturnRouteWrapperError = ErrWebFailure
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Get(); err != ErrWebFailure {
+		t.Errorf("expected error %s to be %s", err, ErrWebFailure)
+	}
+}
+
+func Test_serve_until_done(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- serve_until_done(ctx, &http.Server{Addr: addr, Handler: new_server(mock_server_api(), time.Hour, nil).handler()})
+	}()
+
+	// Wait for the server to come up before shutting it down.
+	for i := 0; i < 100; i++ {
+		if resp, err := http.Get("http://" + addr + "/routes"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("did not expect an error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the server to shut down")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Snapshot is a copy of what the MBTA API told us at one point in time, saved to a JSON file so that
+// the rest of the tool can be run against it without network access (or without burning through the
+// rate limit while developing). Everything is keyed by the route or stop ID it was requested for.
+type Snapshot struct {
+	TakenAt     time.Time                  `json:"taken_at"`
+	Routes      []Route                    `json:"routes"`
+	RouteStops  map[string][]Stop          `json:"route_stops"`
+	Shapes      map[string][]Shape         `json:"shapes"`
+	Predictions map[string][]Prediction    `json:"predictions,omitempty"`
+	Alerts      map[string][]Alert         `json:"alerts,omitempty"`
+	Facilities  []Facility                 `json:"facilities,omitempty"`
+	Schedules   map[string]ScheduleWrapper `json:"schedules,omitempty"`
+	// AccessibilityAlerts are the elevator and escalator outages, which are live data like Alerts.
+	AccessibilityAlerts []Alert `json:"accessibility_alerts,omitempty"`
+}
+
+// SnapshotMBTAWebServer answers every request from a Snapshot, and so can stand in for the
+// ConcreteMBTAWebServer anywhere an MBTAWebServer is wanted.
+type SnapshotMBTAWebServer struct {
+	Snapshot Snapshot
+}
+
+func (s SnapshotMBTAWebServer) GetRoutes(type1 RouteRailType, type2 RouteRailType) (RouteWrapper, error) {
+	// The snapshot was taken with the same heavy and light rail filter that every caller uses,
+	// so there is nothing left to filter here.
+	return RouteWrapper{Data: s.Snapshot.Routes}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetStops(route Route) (StopWrapper, error) {
+	return StopWrapper{Data: s.Snapshot.RouteStops[route.ID]}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetShapes(route Route) (ShapeWrapper, error) {
+	return ShapeWrapper{Data: s.Snapshot.Shapes[route.ID]}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetFacilities() (FacilityWrapper, error) {
+	return FacilityWrapper{Data: s.Snapshot.Facilities}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetAccessibilityAlerts() (AlertWrapper, error) {
+	return AlertWrapper{Data: s.Snapshot.AccessibilityAlerts}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetSchedules(route Route) (ScheduleWrapper, error) {
+	return s.Snapshot.Schedules[route.ID], nil
+}
+
+func (s SnapshotMBTAWebServer) GetPredictions(stop Stop) (PredictionWrapper, error) {
+	return PredictionWrapper{Data: s.Snapshot.Predictions[stop.ID]}, nil
+}
+
+func (s SnapshotMBTAWebServer) GetAlerts(stop Stop) (AlertWrapper, error) {
+	return AlertWrapper{Data: s.Snapshot.Alerts[stop.ID]}, nil
+}
+
+// take_snapshot records the route network, the shapes and morning schedules of its routes and its
+// elevators and escalators, and when live is set also the current predictions and alerts for every stop
+// and the elevator outages. The live data costs two requests per stop, which is far beyond the anonymous
+// rate limit for the whole network, so it is opt-in.
+func take_snapshot(api MBTAWebServer, live bool, now time.Time) (Snapshot, error) {
+	network, err := build_network(api)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{
+		TakenAt:    now,
+		Routes:     network.Routes,
+		RouteStops: map[string][]Stop{},
+		Shapes:     map[string][]Shape{},
+	}
+	for route, stops := range network.RouteStops {
+		snapshot.RouteStops[route.ID] = stops
+	}
+
+	routeShapes, err := fetch_route_shapes(api, network)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for route, shapes := range routeShapes {
+		snapshot.Shapes[route.ID] = shapes
+	}
+
+	snapshot.Schedules = map[string]ScheduleWrapper{}
+	for _, route := range network.Routes {
+		schedules, err := route_schedules(api, network, route)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Schedules[route.ID] = schedules
+	}
+
+	facilities, err := api.GetFacilities()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.Facilities = facilities.Data
+
+	if !live {
+		return snapshot, nil
+	}
+
+	accessibilityAlerts, err := api.GetAccessibilityAlerts()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.AccessibilityAlerts = accessibilityAlerts.Data
+
+	snapshot.Predictions = map[string][]Prediction{}
+	snapshot.Alerts = map[string][]Alert{}
+	for _, stop := range network.Stops {
+		predictions, err := api.GetPredictions(stop)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Predictions[stop.ID] = predictions.Data
+
+		alerts, err := api.GetAlerts(stop)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Alerts[stop.ID] = alerts.Data
+	}
+
+	return snapshot, nil
+}
+
+func save_snapshot(path string, snapshot Snapshot) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+func load_snapshot(path string) (Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer file.Close()
+
+	snapshot := Snapshot{}
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&snapshot); err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mock_snapshot_api() *MockMBTAWebServer {
+	return &MockMBTAWebServer{
+		ReturnRouteWrapper: RouteWrapper{
+			Data: []Route{{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}},
+		},
+		ReturnStopWrapper: map[string]StopWrapper{
+			"Red": StopWrapper{Data: []Stop{
+				{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}},
+				{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}},
+			}},
+		},
+		ReturnPredictionWrapper: map[string]PredictionWrapper{
+			"place-pktrm": PredictionWrapper{Data: []Prediction{{ID: "prediction 1"}}},
+		},
+		ReturnAlertWrapper: map[string]AlertWrapper{
+			"place-alfcl": AlertWrapper{Data: []Alert{{ID: "alert 1"}}},
+		},
+		ReturnScheduleWrapper: map[string]ScheduleWrapper{
+			"Red": ScheduleWrapper{Data: []Schedule{{ID: "schedule 1"}}},
+		},
+		ReturnFacilityWrapper: FacilityWrapper{Data: []Facility{{ID: "804", Attribute: FacilityAttribute{Type: "ELEVATOR"}}}},
+		ReturnAccessibilityAlertWrapper: AlertWrapper{Data: []Alert{{
+			ID:        "alert 2",
+			Attribute: AlertAttribute{Effect: "ELEVATOR_CLOSURE", InformedEntity: []AlertEntity{{Facility: "804"}}},
+		}}},
+	}
+}
+
+func Test_take_snapshot(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("happy path - network only", func(t *testing.T) {
+		mockAPI := mock_snapshot_api()
+
+		snapshot, err := take_snapshot(mockAPI, false, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if snapshot.Predictions != nil || snapshot.Alerts != nil || snapshot.AccessibilityAlerts != nil {
+			t.Error("did not expect live data without asking for it")
+		}
+		if len(mockAPI.RecvPredictionStops) != 0 || len(mockAPI.RecvAlertStops) != 0 {
+			t.Error("did not expect any live data requests")
+		}
+		if !reflect.DeepEqual(mockAPI.ReturnStopWrapper["Red"].Data, snapshot.RouteStops["Red"]) {
+			t.Errorf("expected %+v to be equal to %+v", mockAPI.ReturnStopWrapper["Red"].Data, snapshot.RouteStops["Red"])
+		}
+		if !reflect.DeepEqual(mockAPI.ReturnScheduleWrapper["Red"], snapshot.Schedules["Red"]) {
+			t.Errorf("expected %+v to be equal to %+v", mockAPI.ReturnScheduleWrapper["Red"], snapshot.Schedules["Red"])
+		}
+	})
+
+	t.Run("happy path - live", func(t *testing.T) {
+		mockAPI := mock_snapshot_api()
+
+		snapshot, err := take_snapshot(mockAPI, true, now)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if len(snapshot.Predictions["place-pktrm"]) != 1 || len(snapshot.Alerts["place-alfcl"]) != 1 || len(snapshot.AccessibilityAlerts) != 1 {
+			t.Errorf("expected the live data to be recorded, got %+v", snapshot)
+		}
+	})
+
+	t.Run("sad path - live data fails", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := mock_snapshot_api()
+		mockAPI.ReturnAlertWrapperError = myErr
+
+		_, err := take_snapshot(mockAPI, true, now)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", err, myErr)
+		}
+	})
+}
+
+func Test_SnapshotMBTAWebServer(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockAPI := mock_snapshot_api()
+
+	snapshot, err := take_snapshot(mockAPI, true, now)
+	if err != nil {
+		t.Fatal("did not expect an error")
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := save_snapshot(path, snapshot); err != nil {
+		t.Fatalf("did not expect an error saving: %s", err)
+	}
+	loaded, err := load_snapshot(path)
+	if err != nil {
+		t.Fatalf("did not expect an error loading: %s", err)
+	}
+	if !reflect.DeepEqual(snapshot, loaded) {
+		t.Errorf("expected %+v to be equal to %+v", snapshot, loaded)
+	}
+
+	live, err := build_network(mockAPI)
+	if err != nil {
+		t.Fatal("did not expect an error")
+	}
+	offline, err := build_network(SnapshotMBTAWebServer{Snapshot: loaded})
+	if err != nil {
+		t.Fatal("did not expect an error")
+	}
+	if !reflect.DeepEqual(live, offline) {
+		t.Errorf("expected %+v to be equal to %+v", live, offline)
+	}
+
+	predictions, _ := SnapshotMBTAWebServer{Snapshot: loaded}.GetPredictions(Stop{ID: "place-pktrm"})
+	if !reflect.DeepEqual(mockAPI.ReturnPredictionWrapper["place-pktrm"], predictions) {
+		t.Errorf("expected %+v to be equal to %+v", mockAPI.ReturnPredictionWrapper["place-pktrm"], predictions)
+	}
+}
+
+func Test_load_snapshot(t *testing.T) {
+	_, err := load_snapshot(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// RouteStopChanges are the stops a route gained or lost between two networks, in the order of the route.
+type RouteStopChanges struct {
+	Route   Route
+	Added   []Stop
+	Removed []Stop
+}
+
+type StopRename struct {
+	Old Stop
+	New Stop
+}
+
+// TransferRouteChanges are the routes a transfer station gained or lost between two networks while staying
+// a transfer station.
+type TransferRouteChanges struct {
+	Stop    Stop
+	Added   []Route
+	Removed []Route
+}
+
+// NetworkDiff is what changed between a network before and after. Routes and stops are matched by ID, so a
+// stop that kept its ID but changed its name is a rename rather than one stop removed and another added.
+type NetworkDiff struct {
+	AddedRoutes   []Route
+	RemovedRoutes []Route
+	// RouteChanges are only for the routes in both networks; added and removed routes take their stops with them.
+	RouteChanges []RouteStopChanges
+	RenamedStops []StopRename
+	// NewTransferStops are the stops served by more than one route after but not before, and
+	// FormerTransferStops the other way around.
+	NewTransferStops    []Stop
+	FormerTransferStops []Stop
+	// TransferChanges are for the stops that are transfer stations both before and after.
+	TransferChanges []TransferRouteChanges
+}
+
+func (d NetworkDiff) empty() bool {
+	return len(d.AddedRoutes) == 0 && len(d.RemovedRoutes) == 0 && len(d.RouteChanges) == 0 &&
+		len(d.RenamedStops) == 0 && len(d.NewTransferStops) == 0 && len(d.FormerTransferStops) == 0 &&
+		len(d.TransferChanges) == 0
+}
+
+func stops_by_id(stops []Stop) map[string]Stop {
+	byID := map[string]Stop{}
+	for _, stop := range stops {
+		byID[stop.ID] = stop
+	}
+	return byID
+}
+
+// stops_missing are the stops in stops whose IDs aren't in others, in the order of stops.
+func stops_missing(stops []Stop, others []Stop) []Stop {
+	otherIDs := stops_by_id(others)
+	missing := []Stop{}
+	for _, stop := range stops {
+		if _, ok := otherIDs[stop.ID]; !ok {
+			missing = append(missing, stop)
+		}
+	}
+	return missing
+}
+
+// routes_missing are the routes in routes whose IDs aren't in others, in the order of routes.
+func routes_missing(routes []Route, others []Route) []Route {
+	otherIDs := map[string]bool{}
+	for _, route := range others {
+		otherIDs[route.ID] = true
+	}
+	missing := []Route{}
+	for _, route := range routes {
+		if !otherIDs[route.ID] {
+			missing = append(missing, route)
+		}
+	}
+	return missing
+}
+
+func transfer_stops(network Network) []Stop {
+	stops := []Stop{}
+	for _, stop := range network.Stops {
+		if is_transfer_stop(network, stop) {
+			stops = append(stops, stop)
+		}
+	}
+	return stops
+}
+
+func diff_networks(before Network, after Network) NetworkDiff {
+	diff := NetworkDiff{
+		AddedRoutes:         []Route{},
+		RemovedRoutes:       []Route{},
+		RouteChanges:        []RouteStopChanges{},
+		RenamedStops:        []StopRename{},
+		NewTransferStops:    stops_missing(transfer_stops(after), transfer_stops(before)),
+		FormerTransferStops: stops_missing(transfer_stops(before), transfer_stops(after)),
+		TransferChanges:     []TransferRouteChanges{},
+	}
+
+	beforeRoutes := map[string]Route{}
+	for _, route := range before.Routes {
+		beforeRoutes[route.ID] = route
+	}
+	afterRoutes := map[string]Route{}
+	for _, route := range after.Routes {
+		afterRoutes[route.ID] = route
+	}
+	for _, route := range before.Routes {
+		if _, ok := afterRoutes[route.ID]; !ok {
+			diff.RemovedRoutes = append(diff.RemovedRoutes, route)
+		}
+	}
+	for _, route := range after.Routes {
+		beforeRoute, ok := beforeRoutes[route.ID]
+		if !ok {
+			diff.AddedRoutes = append(diff.AddedRoutes, route)
+			continue
+		}
+		changes := RouteStopChanges{
+			Route:   route,
+			Added:   stops_missing(after.RouteStops[route], before.RouteStops[beforeRoute]),
+			Removed: stops_missing(before.RouteStops[beforeRoute], after.RouteStops[route]),
+		}
+		if len(changes.Added) > 0 || len(changes.Removed) > 0 {
+			diff.RouteChanges = append(diff.RouteChanges, changes)
+		}
+	}
+
+	beforeStops := stops_by_id(before.Stops)
+	for _, stop := range after.Stops {
+		if beforeStop, ok := beforeStops[stop.ID]; ok && beforeStop.Attribute.Name != stop.Attribute.Name {
+			diff.RenamedStops = append(diff.RenamedStops, StopRename{Old: beforeStop, New: stop})
+		}
+	}
+
+	beforeTransfers := stops_by_id(transfer_stops(before))
+	for _, stop := range transfer_stops(after) {
+		beforeStop, ok := beforeTransfers[stop.ID]
+		if !ok {
+			continue
+		}
+		changes := TransferRouteChanges{
+			Stop:    stop,
+			Added:   routes_missing(after.StopRoutes[stop], before.StopRoutes[beforeStop]),
+			Removed: routes_missing(before.StopRoutes[beforeStop], after.StopRoutes[stop]),
+		}
+		if len(changes.Added) > 0 || len(changes.Removed) > 0 {
+			diff.TransferChanges = append(diff.TransferChanges, changes)
+		}
+	}
+
+	return diff
+}
+
+// diff_snapshots compares the route networks of two snapshots, as build_route_network would see them.
+func diff_snapshots(before Snapshot, after Snapshot) (NetworkDiff, error) {
+	beforeNetwork, err := build_route_network(SnapshotMBTAWebServer{Snapshot: before})
+	if err != nil {
+		return NetworkDiff{}, err
+	}
+	afterNetwork, err := build_route_network(SnapshotMBTAWebServer{Snapshot: after})
+	if err != nil {
+		return NetworkDiff{}, err
+	}
+	return diff_networks(beforeNetwork, afterNetwork), nil
+}
+
+// print_network_diff prints one line per change, starting with + for what was added and - for what was
+// removed, and nothing at all when nothing changed, so that a cron job only has something to mail when
+// the network does.
+func print_network_diff(out io.Writer, diff NetworkDiff) {
+	for _, route := range diff.AddedRoutes {
+		fmt.Fprintf(out, "+ route %s (%s)\n", route.Attribute.LongName, route.ID)
+	}
+	for _, route := range diff.RemovedRoutes {
+		fmt.Fprintf(out, "- route %s (%s)\n", route.Attribute.LongName, route.ID)
+	}
+	for _, changes := range diff.RouteChanges {
+		for _, stop := range changes.Added {
+			fmt.Fprintf(out, "+ stop %s (%s) on %s\n", stop.Attribute.Name, stop.ID, changes.Route.Attribute.LongName)
+		}
+		for _, stop := range changes.Removed {
+			fmt.Fprintf(out, "- stop %s (%s) on %s\n", stop.Attribute.Name, stop.ID, changes.Route.Attribute.LongName)
+		}
+	}
+	for _, rename := range diff.RenamedStops {
+		fmt.Fprintf(out, "~ stop %s renamed from %s to %s\n", rename.New.ID, rename.Old.Attribute.Name, rename.New.Attribute.Name)
+	}
+	for _, stop := range diff.NewTransferStops {
+		fmt.Fprintf(out, "+ transfer station %s (%s)\n", stop.Attribute.Name, stop.ID)
+	}
+	for _, stop := range diff.FormerTransferStops {
+		fmt.Fprintf(out, "- transfer station %s (%s)\n", stop.Attribute.Name, stop.ID)
+	}
+	for _, changes := range diff.TransferChanges {
+		for _, route := range changes.Added {
+			fmt.Fprintf(out, "+ %s at transfer station %s (%s)\n", route.Attribute.LongName, changes.Stop.Attribute.Name, changes.Stop.ID)
+		}
+		for _, route := range changes.Removed {
+			fmt.Fprintf(out, "- %s at transfer station %s (%s)\n", route.Attribute.LongName, changes.Stop.Attribute.Name, changes.Stop.ID)
+		}
+	}
+}
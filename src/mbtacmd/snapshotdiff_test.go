@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func mock_diff_snapshots() (Snapshot, Snapshot) {
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	davis := Stop{ID: "place-davis", Attribute: StopAttribute{Name: "Davis"}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	downtown := Stop{ID: "place-dwnxg", Attribute: StopAttribute{Name: "Downtown Crossing"}}
+	state := Stop{ID: "place-state", Attribute: StopAttribute{Name: "State"}}
+	renamedState := Stop{ID: "place-state", Attribute: StopAttribute{Name: "State Street"}}
+	bowdoin := Stop{ID: "place-bomnl", Attribute: StopAttribute{Name: "Bowdoin"}}
+	sciencePark := Stop{ID: "place-spmnl", Attribute: StopAttribute{Name: "Science Park"}}
+	haymarket := Stop{ID: "place-haecl", Attribute: StopAttribute{Name: "Haymarket"}}
+
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}
+	orange := Route{ID: "Orange", Attribute: RouteAttribute{LongName: "Orange Line"}}
+	blue := Route{ID: "Blue", Attribute: RouteAttribute{LongName: "Blue Line"}}
+	greenE := Route{ID: "Green-E", Attribute: RouteAttribute{LongName: "Green Line E"}}
+
+	// Haymarket stays a transfer station, but trades the Blue Line for the Green Line E.
+	before := Snapshot{
+		Routes: []Route{red, orange, blue},
+		RouteStops: map[string][]Stop{
+			"Red":    {alewife, park, downtown},
+			"Orange": {downtown, state, haymarket},
+			"Blue":   {state, bowdoin, haymarket},
+		},
+	}
+	after := Snapshot{
+		Routes: []Route{red, orange, greenE},
+		RouteStops: map[string][]Stop{
+			"Red":     {alewife, davis, park},
+			"Orange":  {downtown, renamedState, haymarket},
+			"Green-E": {park, sciencePark, haymarket},
+		},
+	}
+	return before, after
+}
+
+func Test_diff_snapshots(t *testing.T) {
+	before, after := mock_diff_snapshots()
+
+	t.Run("happy path - every kind of change", func(t *testing.T) {
+		expected := NetworkDiff{
+			AddedRoutes:   []Route{after.Routes[2]},
+			RemovedRoutes: []Route{before.Routes[2]},
+			RouteChanges: []RouteStopChanges{{
+				Route:   after.Routes[0],
+				Added:   []Stop{after.RouteStops["Red"][1]},
+				Removed: []Stop{before.RouteStops["Red"][2]},
+			}},
+			RenamedStops:        []StopRename{{Old: before.RouteStops["Orange"][1], New: after.RouteStops["Orange"][1]}},
+			NewTransferStops:    []Stop{after.RouteStops["Red"][2]},
+			FormerTransferStops: []Stop{before.RouteStops["Orange"][0], before.RouteStops["Orange"][1]},
+			TransferChanges: []TransferRouteChanges{{
+				Stop:    after.RouteStops["Orange"][2],
+				Added:   []Route{after.Routes[2]},
+				Removed: []Route{before.Routes[2]},
+			}},
+		}
+
+		found, err := diff_snapshots(before, after)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+		if found.empty() {
+			t.Error("expected the diff not to be empty")
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		expected := `+ route Green Line E (Green-E)
+- route Blue Line (Blue)
++ stop Davis (place-davis) on Red Line
+- stop Downtown Crossing (place-dwnxg) on Red Line
+~ stop place-state renamed from State to State Street
++ transfer station Park Street (place-pktrm)
+- transfer station Downtown Crossing (place-dwnxg)
+- transfer station State (place-state)
++ Green Line E at transfer station Haymarket (place-haecl)
+- Blue Line at transfer station Haymarket (place-haecl)
+`
+		found, err := diff_snapshots(before, after)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		out := &bytes.Buffer{}
+		print_network_diff(out, found)
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+
+	t.Run("happy path - nothing changed", func(t *testing.T) {
+		found, err := diff_snapshots(before, before)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !found.empty() {
+			t.Errorf("expected %+v to be empty", found)
+		}
+
+		out := &bytes.Buffer{}
+		print_network_diff(out, found)
+		if out.String() != "" {
+			t.Errorf("expected %q to be empty", out.String())
+		}
+	})
+}
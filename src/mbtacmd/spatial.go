@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrBadCoordinate = errors.New("expected a coordinate as latitude,longitude (e.g. 42.35,-71.06)")
+
+const (
+	earthRadiusMeters = 6371000.0
+	metersPerDegree   = earthRadiusMeters * math.Pi / 180
+	// stopIndexCellDegrees is about a kilometer north to south, so a walking radius only ever needs
+	// to look at a handful of cells.
+	stopIndexCellDegrees = 0.01
+)
+
+func parse_coordinate(text string) (Coordinate, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 {
+		return Coordinate{}, ErrBadCoordinate
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return Coordinate{}, ErrBadCoordinate
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return Coordinate{}, ErrBadCoordinate
+	}
+	return Coordinate{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func haversine_meters(a Coordinate, b Coordinate) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// has_coordinates is false for stops we have no location for, which decode as 0,0 (in the Atlantic).
+func has_coordinates(stop Stop) bool {
+	return stop.Attribute.Latitude != 0 || stop.Attribute.Longitude != 0
+}
+
+type NearbyStop struct {
+	Stop   Stop
+	Meters float64
+}
+
+// StopIndex buckets stops into a grid of latitude/longitude cells, so that finding the stops near a
+// point only measures the distance to stops in the surrounding cells rather than to every stop.
+type StopIndex struct {
+	cells map[[2]int][]Stop
+	// minCell and maxCell bound the cells that hold any stops, so a search knows when to stop growing.
+	minCell [2]int
+	maxCell [2]int
+}
+
+func new_stop_index(stops []Stop) *StopIndex {
+	index := &StopIndex{cells: map[[2]int][]Stop{}}
+	first := true
+	for _, stop := range stops {
+		if !has_coordinates(stop) {
+			continue
+		}
+		cell := stop_index_cell(stop_coordinate(stop))
+		index.cells[cell] = append(index.cells[cell], stop)
+		if first {
+			index.minCell, index.maxCell = cell, cell
+			first = false
+		}
+		for i := range cell {
+			index.minCell[i] = min(index.minCell[i], cell[i])
+			index.maxCell[i] = max(index.maxCell[i], cell[i])
+		}
+	}
+	return index
+}
+
+func stop_index_cell(coordinate Coordinate) [2]int {
+	return [2]int{
+		int(math.Floor(coordinate.Latitude / stopIndexCellDegrees)),
+		int(math.Floor(coordinate.Longitude / stopIndexCellDegrees)),
+	}
+}
+
+// Within returns every stop within maxMeters of the point, nearest first.
+func (index *StopIndex) Within(point Coordinate, maxMeters float64) []NearbyStop {
+	latCells := int(math.Ceil(maxMeters/metersPerDegree/stopIndexCellDegrees)) + 1
+	lonScale := math.Max(math.Cos(point.Latitude*math.Pi/180), 0.01)
+	lonCells := int(math.Ceil(maxMeters/(metersPerDegree*lonScale)/stopIndexCellDegrees)) + 1
+	center := stop_index_cell(point)
+
+	nearby := []NearbyStop{}
+	for lat := center[0] - latCells; lat <= center[0]+latCells; lat++ {
+		for lon := center[1] - lonCells; lon <= center[1]+lonCells; lon++ {
+			for _, stop := range index.cells[[2]int{lat, lon}] {
+				meters := haversine_meters(point, stop_coordinate(stop))
+				if meters <= maxMeters {
+					nearby = append(nearby, NearbyStop{Stop: stop, Meters: meters})
+				}
+			}
+		}
+	}
+	sort_nearby_stops(nearby)
+	return nearby
+}
+
+// Nearest returns the k stops closest to the point, nearest first. It searches outward a ring of cells at
+// a time, and can stop once it has k stops that are all closer than anything the next ring could hold.
+func (index *StopIndex) Nearest(point Coordinate, k int) []NearbyStop {
+	if k <= 0 || len(index.cells) == 0 {
+		return []NearbyStop{}
+	}
+
+	center := stop_index_cell(point)
+	// The narrowest a cell gets is east to west, so that bounds how far away the next ring must be.
+	lonScale := math.Max(math.Cos(math.Min(math.Abs(point.Latitude)+stopIndexCellDegrees, 89.9)*math.Pi/180), 0.01)
+	cellMeters := stopIndexCellDegrees * metersPerDegree * lonScale
+
+	found := []NearbyStop{}
+	for ring := 0; ; ring++ {
+		for lat := center[0] - ring; lat <= center[0]+ring; lat++ {
+			for lon := center[1] - ring; lon <= center[1]+ring; lon++ {
+				if lat != center[0]-ring && lat != center[0]+ring && lon != center[1]-ring && lon != center[1]+ring {
+					continue
+				}
+				for _, stop := range index.cells[[2]int{lat, lon}] {
+					found = append(found, NearbyStop{Stop: stop, Meters: haversine_meters(point, stop_coordinate(stop))})
+				}
+			}
+		}
+
+		sort_nearby_stops(found)
+		if len(found) >= k && found[k-1].Meters <= float64(ring)*cellMeters {
+			return found[:k]
+		}
+		if center[0]-ring <= index.minCell[0] && center[0]+ring >= index.maxCell[0] &&
+			center[1]-ring <= index.minCell[1] && center[1]+ring >= index.maxCell[1] {
+			if len(found) > k {
+				found = found[:k]
+			}
+			return found
+		}
+	}
+}
+
+func sort_nearby_stops(nearby []NearbyStop) {
+	sort.SliceStable(nearby, func(i, j int) bool {
+		if nearby[i].Meters != nearby[j].Meters {
+			return nearby[i].Meters < nearby[j].Meters
+		}
+		return nearby[i].Stop.ID < nearby[j].Stop.ID
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_parse_coordinate(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		expected := Coordinate{Latitude: 42.35, Longitude: -71.06}
+
+		found, err := parse_coordinate("42.35, -71.06")
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if expected != found {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	for _, input := range []string{"", "42.35", "42.35,-71.06,0", "north,west", "91,0", "0,181"} {
+		t.Run("sad path - "+input, func(t *testing.T) {
+			_, err := parse_coordinate(input)
+			if err != ErrBadCoordinate {
+				t.Errorf("expected error %s to be %s", err, ErrBadCoordinate)
+			}
+		})
+	}
+}
+
+func Test_haversine_meters(t *testing.T) {
+	// Park Street to Downtown Crossing is a couple of hundred meters along the concourse.
+	meters := haversine_meters(Coordinate{Latitude: 42.356395, Longitude: -71.062424}, Coordinate{Latitude: 42.355518, Longitude: -71.060225})
+	if math.Abs(meters-205) > 1 {
+		t.Errorf("expected %f to be about 205", meters)
+	}
+
+	// A degree of latitude is about 111 km anywhere.
+	meters = haversine_meters(Coordinate{Latitude: 42, Longitude: -71}, Coordinate{Latitude: 43, Longitude: -71})
+	if math.Abs(meters-111195) > 1 {
+		t.Errorf("expected %f to be about 111195", meters)
+	}
+}
+
+func Test_StopIndex(t *testing.T) {
+	network := mock_walking_network()
+	// A stop without coordinates can't be near anything.
+	stops := append([]Stop{{ID: "nowhere", Attribute: StopAttribute{Name: "Nowhere"}}}, network.Stops...)
+	index := new_stop_index(stops)
+	point := Coordinate{Latitude: 42.356, Longitude: -71.061}
+
+	t.Run("happy path - nearest matches sorting every stop", func(t *testing.T) {
+		expected := []NearbyStop{}
+		for _, stop := range network.Stops {
+			expected = append(expected, NearbyStop{Stop: stop, Meters: haversine_meters(point, stop_coordinate(stop))})
+		}
+		sort_nearby_stops(expected)
+
+		for k := 0; k <= len(expected)+1; k++ {
+			found := index.Nearest(point, k)
+			want := expected[:min(k, len(expected))]
+			if !reflect.DeepEqual(want, found) {
+				t.Errorf("expected %+v to be equal to %+v", want, found)
+			}
+		}
+	})
+
+	t.Run("happy path - nearest from far away", func(t *testing.T) {
+		found := index.Nearest(Coordinate{Latitude: 42.0, Longitude: -70.0}, 1)
+		if len(found) != 1 || found[0].Stop.ID != "place-state" {
+			t.Errorf("expected %+v to be State", found)
+		}
+	})
+
+	t.Run("happy path - within", func(t *testing.T) {
+		found := index.Within(point, 300)
+
+		names := []string{}
+		for _, nearby := range found {
+			names = append(names, nearby.Stop.Attribute.Name)
+		}
+		expected := []string{"Downtown Crossing", "Park Street"}
+		if !reflect.DeepEqual(expected, names) {
+			t.Errorf("expected %s to be equal to %s", expected, names)
+		}
+	})
+
+	t.Run("sad path - empty index", func(t *testing.T) {
+		found := new_stop_index([]Stop{}).Nearest(point, 3)
+		if !reflect.DeepEqual([]NearbyStop{}, found) {
+			t.Errorf("expected %+v to be empty", found)
+		}
+	})
+}
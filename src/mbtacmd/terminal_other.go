@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+var ErrNoRawTerminal = errors.New("raw terminal mode is not supported on this platform")
+
+func is_terminal(fd uintptr) bool {
+	return false
+}
+
+func make_raw(fd uintptr) (func(), error) {
+	return nil, ErrNoRawTerminal
+}
+
+func terminal_size(fd uintptr) (int, int, error) {
+	return 0, 0, ErrNoRawTerminal
+}
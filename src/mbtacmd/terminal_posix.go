@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func get_termios(fd uintptr) (syscall.Termios, error) {
+	termios := syscall.Termios{}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return syscall.Termios{}, errno
+	}
+	return termios, nil
+}
+
+func set_termios(fd uintptr, termios syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlWriteTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func is_terminal(fd uintptr) bool {
+	_, err := get_termios(fd)
+	return err == nil
+}
+
+// make_raw puts the terminal into a mode where we see every key press as it happens and the terminal
+// does not echo them for us, which is what lets the line editor handle arrows and tab itself.
+// Output processing is left alone so that "\n" still moves to the start of the next line.
+func make_raw(fd uintptr) (func(), error) {
+	original, err := get_termios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := original
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := set_termios(fd, raw); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		set_termios(fd, original)
+	}, nil
+}
+
+func terminal_size(fd uintptr) (int, int, error) {
+	size := struct {
+		Rows, Cols, XPixel, YPixel uint16
+	}{}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0, 0, errno
+	}
+	return int(size.Cols), int(size.Rows), nil
+}
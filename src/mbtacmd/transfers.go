@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+// transfer_index is the network numbered for the all-pairs search: every stop and every branch of every
+// route is an index into stops and branches, so the search only touches slices. Each branch is ridden on
+// its own, as the planner does, so changing branches of the same route is another ride.
+type transfer_index struct {
+	stops        []Stop
+	branches     [][]int
+	stopBranches [][]int
+	longest      int
+}
+
+func new_transfer_index(network Network) transfer_index {
+	index := transfer_index{stops: network.Stops, branches: [][]int{}, stopBranches: make([][]int, len(network.Stops))}
+	numbers := map[Stop]int{}
+	for i, stop := range network.Stops {
+		numbers[stop] = i
+	}
+	for _, route := range network.Routes {
+		for _, branch := range network.branches(route) {
+			// A stop a branch comes back to counts where it first appears, as in ride_legs.
+			stops := []int{}
+			seen := map[int]bool{}
+			for _, stop := range branch {
+				if number, ok := numbers[stop]; ok && !seen[number] {
+					seen[number] = true
+					stops = append(stops, number)
+				}
+			}
+			branchNumber := len(index.branches)
+			index.branches = append(index.branches, stops)
+			index.longest = max(index.longest, len(stops))
+			for _, stop := range stops {
+				index.stopBranches[stop] = append(index.stopBranches[stop], branchNumber)
+			}
+		}
+	}
+	return index
+}
+
+// transfers_from finds, for every stop, the fewest routes to ride there from source and the fewest stops
+// along those routes, as the planner ranks them (without walking). Rides is -1 for stops out of reach.
+//
+// It is a breadth-first search one ride at a time: the stops first reached on the kth ride are reached
+// from the stops first reached on the one before, so a ride only needs to board at those. Along each
+// branch, a sweep in each direction carries the fewest stops from any boarding point so far, which finds
+// the best boarding point for every stop on the branch in one pass rather than one per pair of stops.
+func (t transfer_index) transfers_from(source int) ([]int, []int) {
+	rides, stops := make([]int, len(t.stops)), make([]int, len(t.stops))
+	for i := range rides {
+		rides[i] = -1
+	}
+	rides[source], stops[source] = 0, 0
+
+	// touched stamps each branch with the last ride it was swept on, so it is only swept once per ride.
+	touched := make([]int, len(t.branches))
+	sweep := make([]int, t.longest)
+	frontier := []int{source}
+	for ride := 1; len(frontier) > 0; ride++ {
+		next := []int{}
+		for _, stop := range frontier {
+			for _, branch := range t.stopBranches[stop] {
+				if touched[branch] == ride {
+					continue
+				}
+				touched[branch] = ride
+
+				positions := t.branches[branch]
+				run := math.MaxInt32
+				for i, along := range positions {
+					if run < math.MaxInt32 {
+						run++
+					}
+					if rides[along] == ride-1 && stops[along] < run {
+						run = stops[along]
+					}
+					sweep[i] = run
+				}
+				run = math.MaxInt32
+				for i := len(positions) - 1; i >= 0; i-- {
+					along := positions[i]
+					if run < math.MaxInt32 {
+						run++
+					}
+					if rides[along] == ride-1 && stops[along] < run {
+						run = stops[along]
+					}
+					best := min(sweep[i], run)
+					if best == math.MaxInt32 {
+						continue
+					}
+					if rides[along] < 0 {
+						rides[along], stops[along] = ride, best
+						next = append(next, along)
+					} else if rides[along] == ride && best < stops[along] {
+						stops[along] = best
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return rides, stops
+}
+
+// write_transfer_csv writes the fewest transfers and stops from every stop to every other stop it can
+// reach, one row per pair, working out one stop's row at a time so the whole matrix is never in memory.
+func write_transfer_csv(w io.Writer, network Network) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"from_stop_id", "from_stop_name", "to_stop_id", "to_stop_name", "transfers", "stops"}); err != nil {
+		return err
+	}
+
+	index := new_transfer_index(network)
+	for source, from := range index.stops {
+		rides, stops := index.transfers_from(source)
+		for target, to := range index.stops {
+			if target == source || rides[target] < 0 {
+				continue
+			}
+			row := []string{from.ID, from.Attribute.Name, to.ID, to.Attribute.Name, strconv.Itoa(rides[target] - 1), strconv.Itoa(stops[target])}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
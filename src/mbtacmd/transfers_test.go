@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// check_transfers_agree checks transfers_from against the planner for every pair of stops.
+func check_transfers_agree(t *testing.T, network Network) {
+	t.Helper()
+	index := new_transfer_index(network)
+	for source, from := range network.Stops {
+		rides, stops := index.transfers_from(source)
+		for target, to := range network.Stops {
+			itinerary, err := plan_itinerary(network, from, to, PlanOptions{})
+			if err == ErrNoPath {
+				if rides[target] >= 0 {
+					t.Errorf("expected no way from %s to %s, got %d rides", from.Attribute.Name, to.Attribute.Name, rides[target])
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("did not expect an error, got %s", err)
+			}
+			if rides[target] != len(itinerary.Routes()) || stops[target] != itinerary.Stops() {
+				t.Errorf("expected %d rides and %d stops from %s to %s, got %d and %d",
+					len(itinerary.Routes()), itinerary.Stops(), from.Attribute.Name, to.Attribute.Name, rides[target], stops[target])
+			}
+		}
+	}
+}
+
+func Test_transfers_from(t *testing.T) {
+	t.Run("happy path - agrees with the planner", func(t *testing.T) {
+		check_transfers_agree(t, mock_accessibility_network())
+	})
+
+	t.Run("happy path - agrees with the planner along branches", func(t *testing.T) {
+		check_transfers_agree(t, mock_branching_network())
+	})
+
+	t.Run("happy path - changing branches is a transfer", func(t *testing.T) {
+		network := mock_branching_network()
+		ashmont, _ := network.find_stop_by_name("Ashmont")
+		quincy, _ := network.find_stop_by_name("North Quincy")
+		alewife, _ := network.find_stop_by_name("Alewife")
+		braintree, _ := network.find_stop_by_name("Braintree")
+		index := new_transfer_index(network)
+
+		rides, stops := index.transfers_from(stop_position(network.Stops, ashmont))
+		if at := stop_position(network.Stops, quincy); rides[at] != 2 || stops[at] != 3 {
+			t.Errorf("expected 2 rides and 3 stops from Ashmont to North Quincy, got %d and %d", rides[at], stops[at])
+		}
+		rides, stops = index.transfers_from(stop_position(network.Stops, alewife))
+		if at := stop_position(network.Stops, braintree); rides[at] != 1 || stops[at] != 3 {
+			t.Errorf("expected 1 ride and 3 stops from Alewife to Braintree, got %d and %d", rides[at], stops[at])
+		}
+	})
+
+	t.Run("happy path - fewest stops for the fewest rides", func(t *testing.T) {
+		// Two routes from A to D, one stopping at every stop, and one back from C, which is a transfer away.
+		a, b, c, d := Stop{ID: "a"}, Stop{ID: "b"}, Stop{ID: "c"}, Stop{ID: "d"}
+		local, express := Route{ID: "local"}, Route{ID: "express"}
+		network := Network{
+			Routes:     []Route{local, express},
+			Stops:      []Stop{a, b, c, d},
+			RouteStops: map[Route][]Stop{local: {a, b, c, d}, express: {d, a}},
+			StopRoutes: map[Stop][]Route{a: {local, express}, b: {local}, c: {local}, d: {local, express}},
+		}
+		expectedRides, expectedStops := []int{1, 1, 1, 0}, []int{1, 2, 1, 0}
+
+		rides, stops := new_transfer_index(network).transfers_from(3)
+		if fmt.Sprint(expectedRides, expectedStops) != fmt.Sprint(rides, stops) {
+			t.Errorf("expected %v %v to be equal to %v %v", expectedRides, expectedStops, rides, stops)
+		}
+	})
+}
+
+func Test_write_transfer_csv(t *testing.T) {
+	t.Run("happy path - reachable pairs", func(t *testing.T) {
+		network := mock_walking_network()
+
+		expected := `from_stop_id,from_stop_name,to_stop_id,to_stop_name,transfers,stops
+place-kencl,Kenmore,place-pktrm,Park Street,0,1
+place-pktrm,Park Street,place-kencl,Kenmore,0,1
+place-dwnxg,Downtown Crossing,place-state,State,0,1
+place-state,State,place-dwnxg,Downtown Crossing,0,1
+`
+		out := &bytes.Buffer{}
+		if err := write_transfer_csv(out, network); err != nil {
+			t.Error("did not expect an error")
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+}
+
+// mock_grid_network is a bus-like network of size horizontal and size vertical routes over a grid of
+// size*size stops, where every stop is a transfer between two routes.
+func mock_grid_network(size int) Network {
+	network := Network{Routes: []Route{}, Stops: []Stop{}, RouteStops: map[Route][]Stop{}, StopRoutes: map[Stop][]Route{}}
+	grid := make([][]Stop, size)
+	for row := range grid {
+		grid[row] = make([]Stop, size)
+		for column := range grid[row] {
+			grid[row][column] = Stop{ID: fmt.Sprintf("%d-%d", row, column)}
+			network.Stops = append(network.Stops, grid[row][column])
+		}
+	}
+	for i := 0; i < size; i++ {
+		across, down := Route{ID: fmt.Sprintf("across-%d", i)}, Route{ID: fmt.Sprintf("down-%d", i)}
+		network.Routes = append(network.Routes, across, down)
+		for j := 0; j < size; j++ {
+			network.RouteStops[across] = append(network.RouteStops[across], grid[i][j])
+			network.RouteStops[down] = append(network.RouteStops[down], grid[j][i])
+			network.StopRoutes[grid[i][j]] = append(network.StopRoutes[grid[i][j]], across)
+			network.StopRoutes[grid[j][i]] = append(network.StopRoutes[grid[j][i]], down)
+		}
+	}
+	return network
+}
+
+// Benchmark_transfer_matrix times the whole matrix for grids from a few hundred stops up to about the
+// size of the MBTA bus network (around 7,000 stops on 150 routes), so the time per stop shows how it scales.
+func Benchmark_transfer_matrix(b *testing.B) {
+	for _, size := range []int{20, 40, 80} {
+		network := mock_grid_network(size)
+		b.Run(fmt.Sprintf("%d stops", size*size), func(b *testing.B) {
+			index := new_transfer_index(network)
+			for i := 0; i < b.N; i++ {
+				for source := range index.stops {
+					index.transfers_from(source)
+				}
+			}
+		})
+	}
+}
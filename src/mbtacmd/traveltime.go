@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// defaultTransferPenaltyMinutes is the time it takes to get from one platform to another when changing
+// routes, on top of waiting for the next train.
+const defaultTransferPenaltyMinutes = 3.0
+
+// TravelTimes are how long the trains take between neighbouring stations and how often they come,
+// worked out from the schedules. Anything the schedules didn't cover falls back to rough guesses (see
+// waitMinutesPerRide and friends).
+type TravelTimes struct {
+	// Segments are the minutes from one station to the next, keyed by the two station IDs in the
+	// direction of travel.
+	Segments map[[2]string]float64
+	// Headways are the minutes between departures, keyed by route ID and station ID.
+	Headways map[[2]string]float64
+}
+
+type schedule_stop_time struct {
+	station   string
+	sequence  int
+	direction int
+	arrival   time.Time
+	depart    time.Time
+}
+
+// schedule_trips groups the stop times by trip, in the order each trip makes them, at the parent stations
+// of the platforms they stop at.
+func schedule_trips(schedules ScheduleWrapper) map[string][]schedule_stop_time {
+	stations := map[string]string{}
+	for _, platform := range schedules.Included {
+		stations[platform.ID] = platform.Relationships.ParentStation.Data.ID
+	}
+
+	trips := map[string][]schedule_stop_time{}
+	for _, schedule := range schedules.Data {
+		platform := schedule.Relationships.Stop.Data.ID
+		station := stations[platform]
+		if station == "" {
+			station = platform
+		}
+		stopTime := schedule_stop_time{station: station, sequence: schedule.Attribute.StopSequence, direction: schedule.Attribute.DirectionID}
+		stopTime.arrival, _ = time.Parse(time.RFC3339, schedule.Attribute.ArrivalTime)
+		stopTime.depart, _ = time.Parse(time.RFC3339, schedule.Attribute.DepartureTime)
+		if stopTime.arrival.IsZero() {
+			stopTime.arrival = stopTime.depart
+		}
+		if stopTime.depart.IsZero() {
+			stopTime.depart = stopTime.arrival
+		}
+		trip := schedule.Relationships.Trip.Data.ID
+		trips[trip] = append(trips[trip], stopTime)
+	}
+
+	for _, stopTimes := range trips {
+		sort.Slice(stopTimes, func(i, j int) bool { return stopTimes[i].sequence < stopTimes[j].sequence })
+	}
+	return trips
+}
+
+// build_travel_times averages the time between each pair of neighbouring stations over every scheduled
+// trip, and the gap between departures at each station over both directions.
+func build_travel_times(routeSchedules map[Route]ScheduleWrapper) TravelTimes {
+	segmentTotals, segmentCounts := map[[2]string]float64{}, map[[2]string]int{}
+	headwayTotals, headwayCounts := map[[2]string]float64{}, map[[2]string]int{}
+
+	for route, schedules := range routeSchedules {
+		// Departures are keyed by the station and the station after it, which tells the two directions apart.
+		departures := map[[2]string][]time.Time{}
+		for _, stopTimes := range schedule_trips(schedules) {
+			for i := 1; i < len(stopTimes); i++ {
+				from, to := stopTimes[i-1], stopTimes[i]
+				minutes := to.arrival.Sub(from.depart).Minutes()
+				if from.station == to.station || minutes < 0 {
+					continue
+				}
+				segment := [2]string{from.station, to.station}
+				segmentTotals[segment] += minutes
+				segmentCounts[segment]++
+				departures[segment] = append(departures[segment], from.depart)
+			}
+		}
+
+		for segment, times := range departures {
+			if len(times) < 2 {
+				continue
+			}
+			sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+			key := [2]string{route.ID, segment[0]}
+			headwayTotals[key] += times[len(times)-1].Sub(times[0]).Minutes() / float64(len(times)-1)
+			headwayCounts[key]++
+		}
+	}
+
+	times := TravelTimes{Segments: map[[2]string]float64{}, Headways: map[[2]string]float64{}}
+	for segment, total := range segmentTotals {
+		times.Segments[segment] = total / float64(segmentCounts[segment])
+	}
+	for key, total := range headwayTotals {
+		times.Headways[key] = total / float64(headwayCounts[key])
+	}
+	return times
+}
+
+func (t TravelTimes) segment_minutes(from Stop, to Stop) float64 {
+	if minutes, ok := t.Segments[[2]string{from.ID, to.ID}]; ok {
+		return minutes
+	}
+	// Trains usually take about as long one way as the other, which beats a guess.
+	if minutes, ok := t.Segments[[2]string{to.ID, from.ID}]; ok {
+		return minutes
+	}
+	return rideMinutesPerStop
+}
+
+// wait_minutes is half the time between trains, which is how long we wait on average turning up at random.
+func (t TravelTimes) wait_minutes(route Route, stop Stop) float64 {
+	if headway, ok := t.Headways[[2]string{route.ID, stop.ID}]; ok {
+		return headway / 2
+	}
+	return waitMinutesPerRide
+}
+
+type LegEstimate struct {
+	Leg              Leg
+	WaitMinutes      float64
+	InVehicleMinutes float64
+	WalkMinutes      float64
+}
+
+func (e LegEstimate) TotalMinutes() float64 {
+	return e.WaitMinutes + e.InVehicleMinutes + e.WalkMinutes
+}
+
+type TripEstimate struct {
+	Legs []LegEstimate
+}
+
+func (e TripEstimate) WaitMinutes() float64 {
+	minutes := 0.0
+	for _, leg := range e.Legs {
+		minutes += leg.WaitMinutes
+	}
+	return minutes
+}
+
+func (e TripEstimate) InVehicleMinutes() float64 {
+	minutes := 0.0
+	for _, leg := range e.Legs {
+		minutes += leg.InVehicleMinutes
+	}
+	return minutes
+}
+
+func (e TripEstimate) WalkMinutes() float64 {
+	minutes := 0.0
+	for _, leg := range e.Legs {
+		minutes += leg.WalkMinutes
+	}
+	return minutes
+}
+
+func (e TripEstimate) TotalMinutes() float64 {
+	return e.WaitMinutes() + e.InVehicleMinutes() + e.WalkMinutes()
+}
+
+// estimate_leg is how long a leg takes: the walk, or the wait for the train and the scheduled time between
+// every pair of stations it passes, with transferPenaltyMinutes on the wait when it isn't the first train
+// of the trip.
+func estimate_leg(network Network, leg Leg, transfer bool, transferPenaltyMinutes float64) LegEstimate {
+	estimate := LegEstimate{Leg: leg}
+	if leg.Walk {
+		estimate.WalkMinutes = leg.Meters / walkMetersPerMinute
+		return estimate
+	}
+	stops := leg_stops(network, leg)
+	for i := 1; i < len(stops); i++ {
+		estimate.InVehicleMinutes += network.Times.segment_minutes(stops[i-1], stops[i])
+	}
+	estimate.WaitMinutes = network.Times.wait_minutes(leg.Route, leg.From)
+	if transfer {
+		estimate.WaitMinutes += transferPenaltyMinutes
+	}
+	return estimate
+}
+
+// estimate_trip is how long an itinerary takes, going by the network's travel times. It is the only
+// estimate there is: the planner ranks itineraries by it, and the summaries, the server and the
+// reachability search all report it.
+func estimate_trip(network Network, itinerary Itinerary, transferPenaltyMinutes float64) TripEstimate {
+	estimate := TripEstimate{Legs: []LegEstimate{}}
+	rides := 0
+	for _, leg := range itinerary.Legs {
+		estimate.Legs = append(estimate.Legs, estimate_leg(network, leg, rides > 0, transferPenaltyMinutes))
+		if !leg.Walk {
+			rides++
+		}
+	}
+	return estimate
+}
+
+func estimate_trips(network Network, itineraries []Itinerary, transferPenaltyMinutes float64) []TripEstimate {
+	estimates := []TripEstimate{}
+	for _, itinerary := range itineraries {
+		estimates = append(estimates, estimate_trip(network, itinerary, transferPenaltyMinutes))
+	}
+	return estimates
+}
+
+// print_trip_estimates prints how long each itinerary should take, numbering them when there are several
+// as print_itineraries does.
+func print_trip_estimates(out io.Writer, estimates []TripEstimate) {
+	for i, estimate := range estimates {
+		if len(estimate.Legs) == 0 {
+			continue
+		}
+		label := "Estimated travel time"
+		if len(estimates) > 1 {
+			label = fmt.Sprintf("Estimated travel time for %d", i+1)
+		}
+		fmt.Fprintf(out, "%s: about %.0f min (%.0f min riding, %.0f min waiting", label, estimate.TotalMinutes(), estimate.InVehicleMinutes(), estimate.WaitMinutes())
+		if walk := estimate.WalkMinutes(); walk > 0 {
+			fmt.Fprintf(out, ", %.0f min walking", walk)
+		}
+		fmt.Fprintln(out, ")")
+
+		for _, leg := range estimate.Legs {
+			if leg.Leg.Walk {
+				fmt.Fprintf(out, "  Walk from %s to %s: %.0f min\n", leg.Leg.From.Attribute.Name, leg.Leg.To.Attribute.Name, leg.WalkMinutes)
+			} else {
+				fmt.Fprintf(out, "  %s from %s to %s: %.0f min wait, %.0f min riding\n", leg.Leg.Route.Attribute.LongName, leg.Leg.From.Attribute.Name, leg.Leg.To.Attribute.Name, leg.WaitMinutes, leg.InVehicleMinutes)
+			}
+		}
+	}
+}
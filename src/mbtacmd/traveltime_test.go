@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mock_schedule_network() Network {
+	red := Route{ID: "Red", Attribute: RouteAttribute{LongName: "Red Line"}}
+	green := Route{ID: "Green-B", Attribute: RouteAttribute{LongName: "Green Line B"}}
+	alewife := Stop{ID: "place-alfcl", Attribute: StopAttribute{Name: "Alewife"}}
+	davis := Stop{ID: "place-davis", Attribute: StopAttribute{Name: "Davis"}}
+	park := Stop{ID: "place-pktrm", Attribute: StopAttribute{Name: "Park Street"}}
+	kenmore := Stop{ID: "place-kencl", Attribute: StopAttribute{Name: "Kenmore"}}
+
+	return Network{
+		Routes: []Route{red, green},
+		Stops:  []Stop{alewife, davis, park, kenmore},
+		RouteStops: map[Route][]Stop{
+			red:   []Stop{alewife, davis, park},
+			green: []Stop{park, kenmore},
+		},
+		StopRoutes: map[Stop][]Route{
+			alewife: []Route{red},
+			davis:   []Route{red},
+			park:    []Route{red, green},
+			kenmore: []Route{green},
+		},
+	}
+}
+
+func mock_schedule(trip string, platform string, sequence int, arrival string, departure string) Schedule {
+	return Schedule{
+		Attribute: ScheduleAttribute{ArrivalTime: arrival, DepartureTime: departure, StopSequence: sequence},
+		Relationships: ScheduleRelationships{
+			Stop: Relationship{Data: RelationshipData{ID: platform}},
+			Trip: Relationship{Data: RelationshipData{ID: trip}},
+		},
+	}
+}
+
+// mock_red_schedules has two trips from Alewife to Park Street ten minutes apart, the second of them
+// taking a little longer to Davis.
+func mock_red_schedules() ScheduleWrapper {
+	return ScheduleWrapper{
+		Data: []Schedule{
+			mock_schedule("trip 1", "70061", 1, "", "2020-01-01T08:00:00-05:00"),
+			mock_schedule("trip 1", "70063", 2, "2020-01-01T08:03:00-05:00", "2020-01-01T08:04:00-05:00"),
+			mock_schedule("trip 1", "70075", 3, "2020-01-01T08:14:00-05:00", ""),
+			mock_schedule("trip 2", "70075", 3, "2020-01-01T08:26:00-05:00", ""),
+			mock_schedule("trip 2", "70063", 2, "2020-01-01T08:15:00-05:00", "2020-01-01T08:16:00-05:00"),
+			mock_schedule("trip 2", "70061", 1, "", "2020-01-01T08:10:00-05:00"),
+		},
+		Included: []ScheduleStop{
+			{ID: "70061", Relationships: ScheduleStopRelationships{ParentStation: Relationship{Data: RelationshipData{ID: "place-alfcl"}}}},
+			{ID: "70063", Relationships: ScheduleStopRelationships{ParentStation: Relationship{Data: RelationshipData{ID: "place-davis"}}}},
+			{ID: "70075", Relationships: ScheduleStopRelationships{ParentStation: Relationship{Data: RelationshipData{ID: "place-pktrm"}}}},
+		},
+	}
+}
+
+func Test_build_travel_times(t *testing.T) {
+	network := mock_schedule_network()
+	red := network.Routes[0]
+
+	t.Run("happy path - averaged over trips", func(t *testing.T) {
+		expected := TravelTimes{
+			Segments: map[[2]string]float64{
+				{"place-alfcl", "place-davis"}: 4,
+				{"place-davis", "place-pktrm"}: 10,
+			},
+			Headways: map[[2]string]float64{
+				{"Red", "place-alfcl"}: 10,
+				{"Red", "place-davis"}: 12,
+			},
+		}
+
+		found := build_travel_times(map[Route]ScheduleWrapper{red: mock_red_schedules()})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - no schedules", func(t *testing.T) {
+		expected := TravelTimes{Segments: map[[2]string]float64{}, Headways: map[[2]string]float64{}}
+
+		found := build_travel_times(map[Route]ScheduleWrapper{red: ScheduleWrapper{}})
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+}
+
+func Test_build_network_travel_times(t *testing.T) {
+	network := mock_schedule_network()
+	red, green := network.Routes[0], network.Routes[1]
+
+	t.Run("happy path - from the schedules the network fetched", func(t *testing.T) {
+		mockAPI := &MockMBTAWebServer{
+			ReturnRouteWrapper: RouteWrapper{Data: network.Routes},
+			ReturnStopWrapper: map[string]StopWrapper{
+				"Red":     {Data: network.RouteStops[red]},
+				"Green-B": {Data: network.RouteStops[green]},
+			},
+			ReturnScheduleWrapper: map[string]ScheduleWrapper{"Red": mock_red_schedules()},
+		}
+
+		found, err := build_network(mockAPI)
+		if err != nil {
+			t.Error("did not expect an error")
+		}
+		if !reflect.DeepEqual(network.Routes, mockAPI.RecvScheduleRoutes) {
+			t.Errorf("expected %+v to be equal to %+v", network.Routes, mockAPI.RecvScheduleRoutes)
+		}
+		expected := build_travel_times(map[Route]ScheduleWrapper{red: mock_red_schedules()})
+		if !reflect.DeepEqual(expected, found.Times) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found.Times)
+		}
+		if len(found.Times.Segments) != 2 {
+			t.Errorf("expected two segments, got %+v", found.Times.Segments)
+		}
+	})
+
+	t.Run("sad path - schedules fail", func(t *testing.T) {
+		myErr := errors.New("custom mock error")
+		mockAPI := &MockMBTAWebServer{
+			ReturnRouteWrapper:         RouteWrapper{Data: network.Routes},
+			ReturnScheduleWrapperError: myErr,
+		}
+
+		_, err := build_network(mockAPI)
+		if err != myErr {
+			t.Errorf("expected error %s to be %s", myErr, err)
+		}
+	})
+}
+
+func Test_estimate_trip(t *testing.T) {
+	network := mock_schedule_network()
+	red, green := network.Routes[0], network.Routes[1]
+	alewife, davis, park, kenmore := network.Stops[0], network.Stops[1], network.Stops[2], network.Stops[3]
+	network.Times = build_travel_times(map[Route]ScheduleWrapper{red: mock_red_schedules()})
+	itinerary := Itinerary{Legs: []Leg{
+		{Route: red, From: alewife, To: park, Stops: 2},
+		{Route: green, From: park, To: kenmore, Stops: 1},
+	}}
+
+	t.Run("happy path - scheduled and guessed legs", func(t *testing.T) {
+		// Green Line B has no schedules, so it falls back to the guesses, and pays the transfer penalty.
+		expected := TripEstimate{Legs: []LegEstimate{
+			{Leg: itinerary.Legs[0], WaitMinutes: 5, InVehicleMinutes: 14},
+			{Leg: itinerary.Legs[1], WaitMinutes: waitMinutesPerRide + 3, InVehicleMinutes: rideMinutesPerStop},
+		}}
+
+		found := estimate_trip(network, itinerary, 3)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+		if found.TotalMinutes() != 29 {
+			t.Errorf("expected %v minutes to be 29", found.TotalMinutes())
+		}
+	})
+
+	t.Run("happy path - the other way uses the same times", func(t *testing.T) {
+		leg := Leg{Route: red, From: park, To: davis, Stops: 1}
+		expected := TripEstimate{Legs: []LegEstimate{{Leg: leg, WaitMinutes: waitMinutesPerRide, InVehicleMinutes: 10}}}
+
+		found := estimate_trip(network, Itinerary{Legs: []Leg{leg}}, 3)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %+v to be equal to %+v", expected, found)
+		}
+	})
+
+	t.Run("happy path - printed", func(t *testing.T) {
+		walk := Leg{Walk: true, From: kenmore, To: davis, Meters: 160}
+		estimate := estimate_trip(network, Itinerary{Legs: append(itinerary.Legs, walk)}, 3)
+
+		expected := `Estimated travel time: about 31 min (16 min riding, 13 min waiting, 2 min walking)
+  Red Line from Alewife to Park Street: 5 min wait, 14 min riding
+  Green Line B from Park Street to Kenmore: 8 min wait, 2 min riding
+  Walk from Kenmore to Davis: 2 min
+`
+		out := &bytes.Buffer{}
+		print_trip_estimates(out, []TripEstimate{estimate})
+		if out.String() != expected {
+			t.Errorf("expected %q to be equal to %q", out.String(), expected)
+		}
+	})
+}